@@ -1,33 +1,191 @@
 package backend
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/zimmski/feedme"
 )
 
 type Backend interface {
 	Init(params Parameters) error
+	Ping(ctx context.Context) error
+	InitSchema(ctx context.Context) error
+	CheckSchema(ctx context.Context) error
+	Migrate(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (current int, known int, err error)
 
-	CreateItems(feed *feedme.Feed, items []feedme.Item) error
+	CreateItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) (created []feedme.Item, updated []feedme.Item, err error)
+	BackfillItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) (created []feedme.Item, err error)
+	MarkUnseen(ctx context.Context, feed *feedme.Feed, seenGUIDs []string) (int, error)
+	UpdateItemMedia(ctx context.Context, feed *feedme.Feed, item *feedme.Item) error
+	UpdateItemHidden(ctx context.Context, feed *feedme.Feed, id int, hidden bool) error
+	SearchMedia(ctx context.Context) ([]string, error)
 
-	FindFeed(feedName string) (*feedme.Feed, error)
-	SearchFeeds(feedNames []string) ([]feedme.Feed, error)
+	CreateFeed(ctx context.Context, feed *feedme.Feed) error
+	FindFeed(ctx context.Context, feedName string) (*feedme.Feed, error)
+	SearchFeeds(ctx context.Context, feedNames []string, category string, includeDisabled bool) ([]feedme.Feed, error)
+	SearchDueFeeds(ctx context.Context, now time.Time, category string, includeDisabled bool) ([]feedme.Feed, error)
+	UpdateFeed(ctx context.Context, feed *feedme.Feed) error
+	UpdateFeedLastCrawled(ctx context.Context, feed *feedme.Feed, crawled time.Time) error
+	UpdateFeedFailure(ctx context.Context, feed *feedme.Feed, lastError string, maxFailures int) error
+	UpdateFeedEmptyRuns(ctx context.Context, feed *feedme.Feed, empty bool) error
+	DeleteFeed(ctx context.Context, feed *feedme.Feed, keepItems bool) error
 
-	FindItemByURI(feed *feedme.Feed, uri string) (*feedme.Item, error)
-	SearchItems(feed *feedme.Feed) ([]feedme.Item, error)
+	FeedStats(ctx context.Context) ([]FeedStat, error)
+
+	RecordCrawl(ctx context.Context, feed *feedme.Feed, run *feedme.CrawlRun) error
+	SearchCrawlRuns(ctx context.Context, feed *feedme.Feed, limit int) ([]feedme.CrawlRun, error)
+
+	CountItems(ctx context.Context) (map[int]int, error)
+	FindItemByID(ctx context.Context, feed *feedme.Feed, id int) (*feedme.Item, error)
+	FindItemByURI(ctx context.Context, feed *feedme.Feed, uri string) (*feedme.Item, error)
+	SearchItems(ctx context.Context, feed *feedme.Feed) ([]feedme.Item, error)
+	SearchItemsAll(ctx context.Context, limit int) ([]feedme.Item, error)
+	SearchItemsPage(ctx context.Context, feed *feedme.Feed, before time.Time, beforeID int, limit int) ([]feedme.Item, error)
+	SearchItemsQuery(ctx context.Context, query ItemQuery) ([]feedme.Item, error)
+	WalkItems(ctx context.Context, feed *feedme.Feed, since time.Time, walk func(item *feedme.Item) error) error
+
+	ListenItems(ctx context.Context) (<-chan ItemEvent, error)
+
+	FindRobotsFile(ctx context.Context, origin string) (*feedme.RobotsFile, error)
+	UpdateRobotsFile(ctx context.Context, robots *feedme.RobotsFile) error
+
+	LockCrawler(ctx context.Context, wait time.Duration) (unlock func(), err error)
+}
+
+// FeedStat holds the aggregated item and crawl state of a feed
+type FeedStat struct {
+	Feed int `db:"feed"`
+	// Items is the count of stored items, RecentItems the count of items created within RecentItemsAge and NewestItem the creation time of the newest one
+	Items       int        `db:"items"`
+	RecentItems int        `db:"recent_items"`
+	NewestItem  *time.Time `db:"newest_item"`
+	// LastRun is the start of the newest recorded crawl run and LastRunError its error
+	LastRun      *time.Time `db:"last_run"`
+	LastRunError string     `db:"last_run_error"`
+}
+
+// ItemQuery defines the items which are searched by SearchItemsQuery
+type ItemQuery struct {
+	// Query is matched case insensitive against the title and the description
+	Query string
+	// Feeds holds the IDs of the searched feeds
+	Feeds []int
+	// Since is the inclusive start and Until the exclusive end of the creation time
+	Since time.Time
+	Until time.Time
+	// Limit is the max count of the matching items, which is at most ItemQueryMaxLimit
+	Limit int
+	// Order is ItemOrderDate for the newest items first or ItemOrderRank for the most relevant items first
+	Order string
+	// Active excludes expired items
+	Active bool
+}
+
+const (
+	// ItemOrderDate orders searched items by their creation time
+	ItemOrderDate = "date"
+	// ItemOrderRank orders searched items by their relevance for the query
+	ItemOrderRank = "rank"
+)
+
+// ItemQueryMaxLimit is the max count of items returned by SearchItemsQuery
+const ItemQueryMaxLimit = 500
+
+func (q *ItemQuery) limit() int {
+	if q.Limit <= 0 || q.Limit > ItemQueryMaxLimit {
+		return ItemQueryMaxLimit
+	}
+
+	return q.Limit
 }
 
+// ItemEvent announces an item which was created by CreateItems to the listeners of ListenItems
+type ItemEvent struct {
+	Feed     int    `json:"feed"`
+	FeedName string `json:"feed_name"`
+	// Private is true if the feed of the item needs a token
+	Private bool   `json:"private"`
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	URI     string `json:"uri"`
+}
+
+// lockPollInterval is the interval of retrying to acquire the crawler lock while waiting for it
+const lockPollInterval = time.Second
+
+// CrawlRunsRetention is the count of the newest crawl runs which are kept per feed
+const CrawlRunsRetention = 50
+
+// RecentItemsAge is the max age of the items which are counted as recent items by FeedStats
+const RecentItemsAge = 7 * 24 * time.Hour
+
+var (
+	// ErrSchemaMissing is returned by CheckSchema if the database schema was never initialized
+	ErrSchemaMissing = errors.New("database schema is missing")
+	// ErrSchemaOutdated is returned by CheckSchema if the database schema has pending migrations
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+	// ErrNotFound is returned by the Find methods if there is no such feed or item
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned by CreateFeed if a feed with the same name already exists
+	ErrDuplicate = errors.New("already exists")
+	// ErrLocked is returned by LockCrawler if another crawler holds the lock
+	ErrLocked = errors.New("another crawler is running")
+	// ErrNotSupported is returned by ListenItems if the backend cannot notify about new items
+	ErrNotSupported = errors.New("not supported by the backend")
+)
+
 type Parameters struct {
 	Spec         string
 	MaxIdleConns int
 	MaxOpenConns int
+	// ConnMaxLifetime and ConnMaxIdleTime limit the time a connection is reused and kept idle, e.g. to replace connections before a firewall kills them (0 keeps connections forever)
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectRetries is the count of retries of a failed connection of Init which start after ConnectBackoff and double the backoff after every try
+	ConnectRetries int
+	ConnectBackoff time.Duration
+	// CopyThreshold is the count of items above which CreateItems copies the items instead of inserting them with statements (0 never copies items)
+	CopyThreshold int
+	// Log logs the failed connections of Init (Default is the default logger)
+	Log *slog.Logger
 }
 
+// maxConnectBackoff is the max backoff between the retries of connections of Init
+const maxConnectBackoff = time.Minute
+
 func NewBackend(name string) (Backend, error) {
-	if name == "postgresql" {
+	switch name {
+	case "memory":
+		return NewBackendMemory(), nil
+	case "postgresql":
 		return NewBackendPostgresql(), nil
 	}
 
 	return nil, fmt.Errorf("unknown backend \"%s\"", name)
 }
+
+// sleepUntil waits for the poll interval of the crawler lock unless the deadline is reached
+func sleepUntil(ctx context.Context, deadline time.Time) error {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return ErrLocked
+	}
+	if remaining > lockPollInterval {
+		remaining = lockPollInterval
+	}
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
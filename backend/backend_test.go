@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zimmski/feedme"
+)
+
+// testUpdateFeedNotFound checks that the updates of a deleted feed fail with ErrNotFound
+func testUpdateFeedNotFound(t *testing.T, b Backend, feed *feedme.Feed) {
+	t.Helper()
+
+	err := b.DeleteFeed(context.Background(), feed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, update := range map[string]func() error{
+		"failure": func() error {
+			return b.UpdateFeedFailure(context.Background(), feed, "error", 0)
+		},
+		"empty runs": func() error {
+			return b.UpdateFeedEmptyRuns(context.Background(), feed, true)
+		},
+	} {
+		err := update()
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected the %s update of a deleted feed to fail with %v, got %v", name, ErrNotFound, err)
+		}
+	}
+}
@@ -0,0 +1,726 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// Memory is a backend which holds all feeds and items in memory
+type Memory struct {
+	lock sync.RWMutex
+
+	feeds map[int]feedme.Feed
+	items map[int][]feedme.Item
+	guids map[int]map[string]int
+	runs  map[int][]feedme.CrawlRun
+
+	// orphans holds the kept items of deleted feeds
+	orphans []feedme.Item
+
+	robots map[string]feedme.RobotsFile
+
+	crawlerLock chan struct{}
+
+	lastFeedID     int
+	lastItemID     int
+	lastCrawlRunID int
+}
+
+func NewBackendMemory() Backend {
+	return &Memory{
+		feeds: make(map[int]feedme.Feed),
+		items: make(map[int][]feedme.Item),
+		guids: make(map[int]map[string]int),
+		runs:  make(map[int][]feedme.CrawlRun),
+
+		robots: make(map[string]feedme.RobotsFile),
+
+		crawlerLock: make(chan struct{}, 1),
+	}
+}
+
+func (m *Memory) Init(params Parameters) error {
+	return nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) InitSchema(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) CheckSchema(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Migrate(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) SchemaVersion(ctx context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+func (m *Memory) CreateItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, []feedme.Item, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	guids, ok := m.guids[feed.ID]
+	if !ok {
+		guids = make(map[string]int)
+
+		m.guids[feed.ID] = guids
+	}
+
+	var created []feedme.Item
+	var updated []feedme.Item
+
+	now := time.Now()
+
+	for _, item := range items {
+		if i, ok := guids[item.GUID]; ok {
+			stored := &m.items[feed.ID][i]
+
+			changed := stored.Title != item.Title || stored.Description != item.Description
+
+			stored.Title = item.Title
+			stored.URI = item.URI
+			stored.Description = item.Description
+			stored.Fields = item.Fields
+			stored.LastSeen = &now
+			stored.Expired = false
+
+			if changed {
+				stored.Updated = &now
+
+				updated = append(updated, *stored)
+			}
+
+			continue
+		}
+
+		m.lastItemID++
+
+		item.Feed = feed.ID
+		item.ID = m.lastItemID
+		// like the CURRENT_TIMESTAMP of PostgreSQL, only backfilled items keep their dates
+		item.Created = now
+		item.LastSeen = &now
+		item.Expired = false
+
+		guids[item.GUID] = len(m.items[feed.ID])
+		m.items[feed.ID] = append(m.items[feed.ID], item)
+
+		created = append(created, item)
+	}
+
+	return created, updated, nil
+}
+
+func (m *Memory) BackfillItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	guids, ok := m.guids[feed.ID]
+	if !ok {
+		guids = make(map[string]int)
+
+		m.guids[feed.ID] = guids
+	}
+
+	var created []feedme.Item
+
+	now := time.Now()
+
+	for _, item := range items {
+		if _, ok := guids[item.GUID]; ok {
+			continue
+		}
+
+		m.lastItemID++
+
+		item.Feed = feed.ID
+		item.ID = m.lastItemID
+		item.LastSeen = &now
+		item.Expired = false
+
+		guids[item.GUID] = len(m.items[feed.ID])
+		m.items[feed.ID] = append(m.items[feed.ID], item)
+
+		created = append(created, item)
+	}
+
+	return created, nil
+}
+
+func (m *Memory) MarkUnseen(ctx context.Context, feed *feedme.Feed, seenGUIDs []string) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	seen := make(map[string]bool, len(seenGUIDs))
+	for _, guid := range seenGUIDs {
+		seen[guid] = true
+	}
+
+	var marked int
+
+	for i := range m.items[feed.ID] {
+		item := &m.items[feed.ID][i]
+
+		if !item.Expired && !seen[item.GUID] {
+			item.Expired = true
+
+			marked++
+		}
+	}
+
+	return marked, nil
+}
+
+func (m *Memory) UpdateItemMedia(ctx context.Context, feed *feedme.Feed, item *feedme.Item) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i := range m.items[feed.ID] {
+		stored := &m.items[feed.ID][i]
+
+		if stored.ID == item.ID {
+			stored.Media = item.Media
+			stored.Enclosure = item.Enclosure
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("item %d of feed %q %w", item.ID, feed.Name, ErrNotFound)
+}
+
+func (m *Memory) UpdateItemHidden(ctx context.Context, feed *feedme.Feed, id int, hidden bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i := range m.items[feed.ID] {
+		stored := &m.items[feed.ID][i]
+
+		if stored.ID == id {
+			stored.Hidden = hidden
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("item %d of feed %q %w", id, feed.Name, ErrNotFound)
+}
+
+func (m *Memory) SearchMedia(ctx context.Context) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var media []string
+
+	seen := make(map[string]bool)
+	add := func(items []feedme.Item) {
+		for _, item := range items {
+			if item.Media != "" && !seen[item.Media] {
+				seen[item.Media] = true
+
+				media = append(media, item.Media)
+			}
+		}
+	}
+
+	for _, items := range m.items {
+		add(items)
+	}
+	add(m.orphans)
+
+	return media, nil
+}
+
+// ListenItems is not supported by the memory backend
+func (m *Memory) ListenItems(ctx context.Context) (<-chan ItemEvent, error) {
+	// the items of other processes, e.g. of the crawler, cannot be seen
+	return nil, ErrNotSupported
+}
+
+func (m *Memory) CreateFeed(ctx context.Context, feed *feedme.Feed) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, f := range m.feeds {
+		if f.Name == feed.Name {
+			return fmt.Errorf("feed %q %w", feed.Name, ErrDuplicate)
+		}
+	}
+
+	m.lastFeedID++
+
+	feed.ID = m.lastFeedID
+	m.feeds[feed.ID] = *feed
+
+	return nil
+}
+
+func (m *Memory) FindFeed(ctx context.Context, feedName string) (*feedme.Feed, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, feed := range m.feeds {
+		if feed.Name == feedName {
+			return &feed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("feed %q %w", feedName, ErrNotFound)
+}
+
+func (m *Memory) SearchFeeds(ctx context.Context, feedNames []string, category string, includeDisabled bool) ([]feedme.Feed, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var names map[string]bool
+	if len(feedNames) != 0 {
+		names = make(map[string]bool, len(feedNames))
+
+		for _, name := range feedNames {
+			names[name] = true
+		}
+	}
+
+	return m.searchFeeds(func(feed *feedme.Feed) bool {
+		return (names == nil || names[feed.Name]) && (category == "" || feed.Category == category) && (feed.Enabled || includeDisabled)
+	}), nil
+}
+
+func (m *Memory) SearchDueFeeds(ctx context.Context, now time.Time, category string, includeDisabled bool) ([]feedme.Feed, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.searchFeeds(func(feed *feedme.Feed) bool {
+		return feed.Due(now) && (category == "" || feed.Category == category) && (feed.Enabled || includeDisabled)
+	}), nil
+}
+
+// searchFeeds returns all feeds accepted by the given function ordered by their names
+func (m *Memory) searchFeeds(accept func(feed *feedme.Feed) bool) []feedme.Feed {
+	feeds := []feedme.Feed{}
+
+	// the caller holds the lock
+	for _, feed := range m.feeds {
+		if accept(&feed) {
+			feeds = append(feeds, feed)
+		}
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Name < feeds[j].Name
+	})
+
+	return feeds
+}
+
+func (m *Memory) UpdateFeed(ctx context.Context, feed *feedme.Feed) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored, ok := m.feeds[feed.ID]
+	if !ok {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	stored.URL = feed.URL
+	stored.Transform = feed.Transform
+	stored.Interval = feed.Interval
+	stored.Schedule = feed.Schedule
+	stored.Category = feed.Category
+	stored.DisplayTitle = feed.DisplayTitle
+	stored.Description = feed.Description
+	stored.Language = feed.Language
+	stored.SiteURL = feed.SiteURL
+	stored.HideSource = feed.HideSource
+
+	m.feeds[feed.ID] = stored
+
+	return nil
+}
+
+func (m *Memory) UpdateFeedLastCrawled(ctx context.Context, feed *feedme.Feed, crawled time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	feed.LastCrawled = &crawled
+	feed.FailureCount = 0
+	feed.LastError = ""
+
+	if stored, ok := m.feeds[feed.ID]; ok {
+		stored.LastCrawled = feed.LastCrawled
+		stored.FailureCount = feed.FailureCount
+		stored.LastError = feed.LastError
+
+		m.feeds[feed.ID] = stored
+	}
+
+	return nil
+}
+
+func (m *Memory) UpdateFeedFailure(ctx context.Context, feed *feedme.Feed, lastError string, maxFailures int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored, ok := m.feeds[feed.ID]
+	if !ok {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	stored.FailureCount++
+	stored.LastError = lastError
+	if maxFailures > 0 && stored.FailureCount >= maxFailures {
+		stored.Enabled = false
+	}
+
+	m.feeds[feed.ID] = stored
+
+	feed.FailureCount = stored.FailureCount
+	feed.LastError = stored.LastError
+	feed.Enabled = stored.Enabled
+
+	return nil
+}
+
+func (m *Memory) UpdateFeedEmptyRuns(ctx context.Context, feed *feedme.Feed, empty bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored, ok := m.feeds[feed.ID]
+	if !ok {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	if empty {
+		stored.EmptyRuns++
+	} else {
+		stored.EmptyRuns = 0
+	}
+
+	m.feeds[feed.ID] = stored
+
+	feed.EmptyRuns = stored.EmptyRuns
+
+	return nil
+}
+
+func (m *Memory) DeleteFeed(ctx context.Context, feed *feedme.Feed, keepItems bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.feeds[feed.ID]; !ok {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	if keepItems {
+		for _, item := range m.items[feed.ID] {
+			item.Feed = 0
+			m.orphans = append(m.orphans, item)
+		}
+	}
+
+	delete(m.feeds, feed.ID)
+	delete(m.items, feed.ID)
+	delete(m.guids, feed.ID)
+	delete(m.runs, feed.ID)
+
+	return nil
+}
+
+func (m *Memory) FeedStats(ctx context.Context) ([]FeedStat, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	recent := time.Now().Add(-RecentItemsAge)
+
+	stats := make([]FeedStat, 0, len(m.feeds))
+	for id := range m.feeds {
+		stat := FeedStat{
+			Feed:  id,
+			Items: len(m.items[id]),
+		}
+
+		for i := range m.items[id] {
+			created := m.items[id][i].Created
+
+			if stat.NewestItem == nil || created.After(*stat.NewestItem) {
+				stat.NewestItem = &created
+			}
+			if !created.Before(recent) {
+				stat.RecentItems++
+			}
+		}
+
+		// runs are kept newest first
+		if runs := m.runs[id]; len(runs) != 0 {
+			started := runs[0].Started
+
+			stat.LastRun = &started
+			stat.LastRunError = runs[0].Error
+		}
+
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Feed < stats[j].Feed
+	})
+
+	return stats, nil
+}
+
+func (m *Memory) RecordCrawl(ctx context.Context, feed *feedme.Feed, run *feedme.CrawlRun) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.lastCrawlRunID++
+
+	run.Feed = feed.ID
+	run.ID = m.lastCrawlRunID
+
+	// runs are kept newest first
+	runs := append([]feedme.CrawlRun{*run}, m.runs[feed.ID]...)
+	if len(runs) > CrawlRunsRetention {
+		runs = runs[:CrawlRunsRetention]
+	}
+	m.runs[feed.ID] = runs
+
+	return nil
+}
+
+func (m *Memory) SearchCrawlRuns(ctx context.Context, feed *feedme.Feed, limit int) ([]feedme.CrawlRun, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	runs := m.runs[feed.ID]
+	if limit >= 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return append([]feedme.CrawlRun{}, runs...), nil
+}
+
+func (m *Memory) CountItems(ctx context.Context) (map[int]int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	counts := make(map[int]int, len(m.items))
+	for feed, items := range m.items {
+		counts[feed] = len(items)
+	}
+
+	return counts, nil
+}
+
+func (m *Memory) FindItemByID(ctx context.Context, feed *feedme.Feed, id int) (*feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, item := range m.items[feed.ID] {
+		if item.ID == id {
+			return &item, nil
+		}
+	}
+
+	return nil, fmt.Errorf("item %d of feed %q %w", id, feed.Name, ErrNotFound)
+}
+
+func (m *Memory) FindItemByURI(ctx context.Context, feed *feedme.Feed, uri string) (*feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, item := range m.items[feed.ID] {
+		if item.URI == uri {
+			return &item, nil
+		}
+	}
+
+	return nil, fmt.Errorf("item %q of feed %q %w", uri, feed.Name, ErrNotFound)
+}
+
+func (m *Memory) SearchItems(ctx context.Context, feed *feedme.Feed) ([]feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	items := visibleItems([]feedme.Item{}, m.items[feed.ID])
+
+	return newestItems(items, 10), nil
+}
+
+func (m *Memory) SearchItemsAll(ctx context.Context, limit int) ([]feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	items := []feedme.Item{}
+	for _, feedItems := range m.items {
+		items = visibleItems(items, feedItems)
+	}
+
+	return newestItems(items, limit), nil
+}
+
+func (m *Memory) SearchItemsPage(ctx context.Context, feed *feedme.Feed, before time.Time, beforeID int, limit int) ([]feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	items := []feedme.Item{}
+	for _, item := range m.items[feed.ID] {
+		if !item.Hidden && (before.IsZero() || item.Created.Before(before) || (item.Created.Equal(before) && item.ID < beforeID)) {
+			items = append(items, item)
+		}
+	}
+
+	return newestItems(items, limit), nil
+}
+
+func (m *Memory) SearchItemsQuery(ctx context.Context, query ItemQuery) ([]feedme.Item, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	feeds := make(map[int]bool, len(query.Feeds))
+	for _, id := range query.Feeds {
+		feeds[id] = true
+	}
+
+	q := strings.ToLower(query.Query)
+
+	items := []feedme.Item{}
+	for feed, feedItems := range m.items {
+		if len(feeds) != 0 && !feeds[feed] {
+			continue
+		}
+
+		for _, item := range feedItems {
+			switch {
+			case item.Hidden:
+			case q != "" && !strings.Contains(strings.ToLower(item.Title), q) && !strings.Contains(strings.ToLower(item.Description), q):
+			case !query.Since.IsZero() && item.Created.Before(query.Since):
+			case !query.Until.IsZero() && !item.Created.Before(query.Until):
+			case query.Active && item.Expired:
+			default:
+				items = append(items, item)
+			}
+		}
+	}
+
+	if query.Order == ItemOrderRank && q != "" {
+		rank := func(item feedme.Item) int {
+			return strings.Count(strings.ToLower(item.Title), q) + strings.Count(strings.ToLower(item.Description), q)
+		}
+
+		items = newestItems(items, -1)
+		sort.SliceStable(items, func(i, j int) bool {
+			return rank(items[i]) > rank(items[j])
+		})
+
+		if len(items) > query.limit() {
+			items = items[:query.limit()]
+		}
+
+		return items, nil
+	}
+
+	return newestItems(items, query.limit()), nil
+}
+
+func (m *Memory) WalkItems(ctx context.Context, feed *feedme.Feed, since time.Time, walk func(item *feedme.Item) error) error {
+	m.lock.RLock()
+	items := []feedme.Item{}
+	for _, item := range m.items[feed.ID] {
+		if !item.Hidden && !item.Created.Before(since) {
+			items = append(items, item)
+		}
+	}
+	m.lock.RUnlock()
+
+	items = newestItems(items, -1)
+
+	for i := len(items) - 1; i >= 0; i-- {
+		err := walk(&items[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visibleItems appends the items which are not hidden to the list
+func visibleItems(list []feedme.Item, items []feedme.Item) []feedme.Item {
+	for _, item := range items {
+		if !item.Hidden {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// newestItems sorts the items by their creation time and ID, newest first, and returns at most limit items
+func newestItems(items []feedme.Item, limit int) []feedme.Item {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Created.Equal(items[j].Created) {
+			return items[i].Created.After(items[j].Created)
+		}
+
+		return items[i].ID > items[j].ID
+	})
+
+	if limit >= 0 && len(items) > limit {
+		items = items[:limit]
+	}
+
+	return items
+}
+
+func (m *Memory) FindRobotsFile(ctx context.Context, origin string) (*feedme.RobotsFile, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	robots, ok := m.robots[origin]
+	if !ok {
+		return nil, fmt.Errorf("robots.txt of %s %w", origin, ErrNotFound)
+	}
+
+	return &robots, nil
+}
+
+func (m *Memory) UpdateRobotsFile(ctx context.Context, robots *feedme.RobotsFile) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.robots[robots.Origin] = *robots
+
+	return nil
+}
+
+func (m *Memory) LockCrawler(ctx context.Context, wait time.Duration) (func(), error) {
+	deadline := time.Now().Add(wait)
+
+	for {
+		select {
+		case m.crawlerLock <- struct{}{}:
+			return func() {
+				<-m.crawlerLock
+			}, nil
+		default:
+		}
+
+		if err := sleepUntil(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+}
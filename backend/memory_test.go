@@ -0,0 +1,242 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// testMemoryFeed returns a memory backend with a feed of the given name
+func testMemoryFeed(t *testing.T, name string) (*Memory, *feedme.Feed) {
+	t.Helper()
+
+	m := NewBackendMemory().(*Memory)
+
+	feed := &feedme.Feed{
+		Name:    name,
+		URL:     "http://example.com/" + name,
+		Enabled: true,
+	}
+
+	err := m.CreateFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m, feed
+}
+
+// testItems returns items whose GUIDs and titles are the given titles
+func testItems(titles ...string) []feedme.Item {
+	items := make([]feedme.Item, len(titles))
+	for i, title := range titles {
+		items[i] = feedme.Item{
+			GUID:  title,
+			Title: title,
+			URI:   "/" + title,
+		}
+	}
+
+	return items
+}
+
+// titles returns the titles of the items
+func titles(items []feedme.Item) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+
+	return titles
+}
+
+func TestMemoryCreateItemsCreated(t *testing.T) {
+	m, feed := testMemoryFeed(t, "news")
+
+	items := testItems("a", "b")
+	// dates of pages are ignored like by the PostgreSQL backend
+	items[0].Created = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	before := time.Now()
+	created, updated, err := m.CreateItems(context.Background(), feed, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	if len(created) != 2 || len(updated) != 0 {
+		t.Fatalf("expected 2 created and 0 updated items, got %d and %d", len(created), len(updated))
+	}
+
+	stored, err := m.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, list := range [][]feedme.Item{created, stored} {
+		for _, item := range list {
+			if item.Created.Before(before) || item.Created.After(after) {
+				t.Errorf("expected item %s to be created between %s and %s, got %s", item.Title, before, after, item.Created)
+			}
+			if item.LastSeen == nil || !item.LastSeen.Equal(item.Created) {
+				t.Errorf("expected item %s to be last seen at its creation, got %v", item.Title, item.LastSeen)
+			}
+		}
+	}
+
+	// a later crawl keeps the creation time
+	time.Sleep(time.Millisecond)
+
+	_, _, err = m.CreateItems(context.Background(), feed, testItems("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := m.FindItemByID(context.Background(), feed, created[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Created.Equal(created[0].Created) {
+		t.Errorf("expected the creation time %s to be kept, got %s", created[0].Created, again.Created)
+	}
+	if !again.LastSeen.After(again.Created) {
+		t.Errorf("expected the last seen time to be updated, got %s", again.LastSeen)
+	}
+}
+
+func TestMemoryBackfillItemsCreated(t *testing.T) {
+	m, feed := testMemoryFeed(t, "news")
+
+	date := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	items := testItems("old")
+	items[0].Created = date
+
+	created, err := m.BackfillItems(context.Background(), feed, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != 1 || !created[0].Created.Equal(date) {
+		t.Fatalf("expected the backfilled item to keep its date %s, got %+v", date, created)
+	}
+}
+
+func TestMemoryCreateItemsDuplicates(t *testing.T) {
+	m, feed := testMemoryFeed(t, "news")
+
+	other := &feedme.Feed{
+		Name: "other",
+	}
+	err := m.CreateFeed(context.Background(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, _, err := m.CreateItems(context.Background(), feed, testItems("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 created items, got %d", len(created))
+	}
+
+	changed := testItems("a", "b", "c")
+	changed[1].Title = "B"
+
+	created, updated, err := m.CreateItems(context.Background(), feed, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(titles(created)) != "[c]" {
+		t.Errorf("expected only the new item to be created, got %v", titles(created))
+	}
+	if fmt.Sprint(titles(updated)) != "[B]" {
+		t.Errorf("expected only the changed item to be updated, got %v", titles(updated))
+	}
+	if len(updated) == 1 && (updated[0].Updated == nil || updated[0].ID != 2) {
+		t.Errorf("expected the stored item to be updated, got %+v", updated[0])
+	}
+
+	// the links of known items are updated, e.g. relative links which are now stored as absolute links
+	moved := testItems("a")
+	moved[0].URI = "http://example.com/a"
+
+	_, _, err = m.CreateItems(context.Background(), feed, moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := m.FindItemByID(context.Background(), feed, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.URI != "http://example.com/a" {
+		t.Errorf("expected the link of the stored item to be updated, got %s", stored.URI)
+	}
+
+	// GUIDs are unique per feed
+	created, _, err = m.CreateItems(context.Background(), other, testItems("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 {
+		t.Errorf("expected the item of another feed to be created, got %d items", len(created))
+	}
+
+	counts, err := m.CountItems(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[feed.ID] != 3 {
+		t.Errorf("expected 3 stored items, got %d", counts[feed.ID])
+	}
+}
+
+func TestMemorySearchItems(t *testing.T) {
+	m, feed := testMemoryFeed(t, "news")
+
+	// items of one crawl have the same creation time and are ordered by their IDs
+	var names []string
+	for i := 0; i < 12; i++ {
+		names = append(names, fmt.Sprintf("item%02d", i))
+	}
+
+	_, _, err := m.CreateItems(context.Background(), feed, testItems(names...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.UpdateItemHidden(context.Background(), feed, 12, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := m.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[item10 item09 item08 item07 item06 item05 item04 item03 item02 item01]"
+	if fmt.Sprint(titles(items)) != expected {
+		t.Errorf("expected the newest 10 visible items %s, got %v", expected, titles(items))
+	}
+
+	all, err := m.SearchItemsAll(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(titles(all)) != "[item10 item09 item08]" {
+		t.Errorf("expected the newest 3 visible items, got %v", titles(all))
+	}
+}
+
+func TestMemoryUpdateFeedNotFound(t *testing.T) {
+	m, feed := testMemoryFeed(t, "news")
+
+	testUpdateFeedNotFound(t, m, feed)
+}
@@ -1,82 +1,757 @@
 package backend
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/zimmski/feedme"
 )
 
+// postgresqlUniqueViolation is the error code of PostgreSQL for violated unique constraints
+const postgresqlUniqueViolation = "23505"
+
+// postgresqlCrawlerLock is the key of the advisory lock which is held by a running crawler
+const postgresqlCrawlerLock = 0x6665656d65
+
+// postgresqlInsertBatchSize limits the items per INSERT
+const postgresqlInsertBatchSize = 1000
+
+// postgresqlItemInsertColumns are the columns of inserted items besides their feed and their times
+const postgresqlItemInsertColumns = "guid, title, uri, description, author, categories, enclosure_url, enclosure_type, enclosure_length, image, fields"
+
+// postgresqlItemUpsert is the conflict clause of inserted items
+const postgresqlItemUpsert = " ON CONFLICT (feed, guid) DO UPDATE SET title = EXCLUDED.title, uri = EXCLUDED.uri, description = EXCLUDED.description, fields = EXCLUDED.fields" +
+	// every found item records that it was seen
+	", last_seen = EXCLUDED.last_seen, expired = FALSE" +
+	// the update time is only set to the time of the crawl if the title or the description changed
+	", updated = CASE WHEN items.title IS DISTINCT FROM EXCLUDED.title OR items.description IS DISTINCT FROM EXCLUDED.description THEN EXCLUDED.last_seen ELSE items.updated END" +
+	" RETURNING id, guid, created, updated, xmax = 0, updated IS NOT DISTINCT FROM last_seen"
+
+// postgresqlItemsChannel is the notification channel of the items which are created by CreateItems
+const postgresqlItemsChannel = "feedme_items"
+
+// postgresqlNotifyMaxPayload is the max size of a notification payload
+const postgresqlNotifyMaxPayload = 7999
+
+// postgresqlListenerPing is the interval of checking the connection of an idle listener of ListenItems
+const postgresqlListenerPing = 90 * time.Second
+
+const (
+	postgresqlFeedColumns     = "id, name, url, transform, crawl_interval, schedule, last_crawled, COALESCE(category, '') AS category, enabled, failure_count, last_error, empty_runs, token, display_title, description, language, site_url, hide_source"
+	postgresqlCrawlRunColumns = "feed, id, started, duration, items_found, items_inserted, error"
+	postgresqlItemColumns     = "feed, id, guid, title, uri, description, author, categories, enclosure_url, enclosure_type, enclosure_length, created, updated, last_seen, expired, hidden, image, media, fields"
+)
+
+// postgresqlSearchVector is the expression of the full-text search index of items
+const postgresqlSearchVector = "to_tsvector('simple', title || ' ' || description)"
+
+// postgresqlLikeEscaper escapes the wildcards of LIKE patterns
+var postgresqlLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type Postgresql struct {
 	Db *sqlx.DB
+
+	spec          string
+	copyThreshold int
 }
 
 func NewBackendPostgresql() Backend {
 	return new(Postgresql)
 }
 
+// Init connects to the database
 func (p *Postgresql) Init(params Parameters) error {
 	var err error
 
-	p.Db, err = sqlx.Connect("postgres", params.Spec)
-	if err != nil {
-		return fmt.Errorf("cannot connect to database: %v", err)
+	log := params.Log
+	if log == nil {
+		log = slog.Default()
 	}
 
-	err = p.Db.Ping()
-	if err != nil {
-		return fmt.Errorf("cannot ping database: %v", err)
+	backoff := params.ConnectBackoff
+
+	// the database can start after the processes which use it
+	for try := 0; ; try++ {
+		p.Db, err = sqlx.Connect("postgres", params.Spec)
+		if err == nil {
+			break
+		} else if try >= params.ConnectRetries {
+			return fmt.Errorf("cannot connect to database: %v", err)
+		}
+
+		log.Warn("cannot connect to database", "try", try+1, "retries", params.ConnectRetries, "backoff", backoff, "error", err)
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
 	}
 
 	p.Db.SetMaxIdleConns(params.MaxIdleConns)
 	p.Db.SetMaxOpenConns(params.MaxOpenConns)
+	p.Db.SetConnMaxLifetime(params.ConnMaxLifetime)
+	p.Db.SetConnMaxIdleTime(params.ConnMaxIdleTime)
+
+	p.spec = params.Spec
+	p.copyThreshold = params.CopyThreshold
+
+	return nil
+}
+
+func (p *Postgresql) Ping(ctx context.Context) error {
+	return p.Db.PingContext(ctx)
+}
+
+func (p *Postgresql) InitSchema(ctx context.Context) error {
+	return p.Migrate(ctx)
+}
+
+func (p *Postgresql) CheckSchema(ctx context.Context) error {
+	current, known, err := p.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		var feeds *string
+
+		err = p.Db.GetContext(ctx, &feeds, "SELECT to_regclass('feeds')::TEXT")
+		if err != nil {
+			return fmt.Errorf("cannot query tables: %v", err)
+		}
+
+		if feeds == nil {
+			return ErrSchemaMissing
+		}
+	}
+
+	if current < known {
+		return fmt.Errorf("%w: version %d of %d", ErrSchemaOutdated, current, known)
+	} else if current > known {
+		return fmt.Errorf("database schema version %d is newer than the known version %d", current, known)
+	}
 
 	return nil
 }
 
-func (p *Postgresql) CreateItems(feed *feedme.Feed, items []feedme.Item) error {
+func (p *Postgresql) Migrate(ctx context.Context) error {
 	var err error
 
-	tx, err := p.Db.Begin()
+	tx, err := p.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresqlMigrationLock)
 	if err != nil {
+		return fmt.Errorf("cannot lock schema: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("cannot create schema_version table: %v", err)
+	}
+
+	var version int
+
+	err = tx.GetContext(ctx, &version, "SELECT COALESCE(MAX(version), 0) FROM schema_version")
+	if err != nil {
+		return fmt.Errorf("cannot query schema version: %v", err)
+	}
+
+	// the schema version of a database is the count of its applied migrations
+	if version > len(postgresqlMigrations) {
+		err = fmt.Errorf("database schema version %d is newer than the known version %d", version, len(postgresqlMigrations))
+
 		return err
 	}
 
+	for ; version < len(postgresqlMigrations); version++ {
+		_, err = tx.ExecContext(ctx, postgresqlMigrations[version])
+		if err != nil {
+			return fmt.Errorf("cannot apply migration %d: %v", version+1, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM schema_version")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_version(version) VALUES ($1)", version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgresql) SchemaVersion(ctx context.Context) (int, int, error) {
+	var table *string
+
+	err := p.Db.GetContext(ctx, &table, "SELECT to_regclass('schema_version')::TEXT")
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot query tables: %v", err)
+	}
+
+	if table == nil {
+		return 0, len(postgresqlMigrations), nil
+	}
+
+	var version int
+
+	err = p.Db.GetContext(ctx, &version, "SELECT COALESCE(MAX(version), 0) FROM schema_version")
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot query schema version: %v", err)
+	}
+
+	return version, len(postgresqlMigrations), nil
+}
+
+func (p *Postgresql) CreateItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, []feedme.Item, error) {
+	var err error
+
+	if len(items) == 0 {
+		return nil, nil, nil
+	}
+
+	// a GUID must not be affected twice by one upsert statement
+	guids := make(map[string]int, len(items))
+	unique := make([]feedme.Item, 0, len(items))
+
 	for _, i := range items {
-		_, err = tx.Exec("INSERT INTO items(feed, title, uri, description, created) SELECT $1, $2, $3, $4, CURRENT_TIMESTAMP WHERE NOT EXISTS(SELECT id FROM items WHERE feed = $1 AND title = $2 AND uri = $3 AND description = $4)", feed.ID, i.Title, i.URI, i.Description)
+		if _, ok := guids[i.GUID]; !ok {
+			guids[i.GUID] = len(unique)
+
+			unique = append(unique, i)
+		}
+	}
+	items = unique
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var created []feedme.Item
+	var updated []feedme.Item
+
+	// upserted collects the created and the changed items of the rows returned by an upsert
+	upserted := func(rows *sql.Rows) error {
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int
+			var guid string
+			var createdAt time.Time
+			var updatedAt *time.Time
+			var inserted bool
+			var changed bool
+
+			err := rows.Scan(&id, &guid, &createdAt, &updatedAt, &inserted, &changed)
+			if err != nil {
+				return err
+			}
+
+			if !inserted && !changed {
+				continue
+			}
+
+			i := items[guids[guid]]
+			i.Feed = feed.ID
+			i.ID = id
+
+			if inserted {
+				created = append(created, i)
+			} else {
+				i.Created = createdAt
+				i.Updated = updatedAt
+
+				updated = append(updated, i)
+			}
+		}
+
+		return rows.Err()
+	}
+
+	if p.copyThreshold > 0 && len(items) > p.copyThreshold {
+		// copying is much faster than statements for big counts of items
+		err = copyItems(ctx, tx, feed, items, upserted)
+	} else {
+		err = insertItems(ctx, tx, feed, items, upserted)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = notifyItems(ctx, tx, feed, created)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return created, updated, nil
+}
+
+// insertItems upserts the items in batches of multi-row statements
+func insertItems(ctx context.Context, tx *sql.Tx, feed *feedme.Feed, items []feedme.Item, upserted func(rows *sql.Rows) error) error {
+	var err error
+
+	var full *sql.Stmt
+	defer func() {
+		if full != nil {
+			full.Close()
+		}
+	}()
+
+	// PostgreSQL allows at most 65535 parameters per statement
+	for start := 0; start < len(items); start += postgresqlInsertBatchSize {
+		end := start + postgresqlInsertBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		batch := items[start:end]
+
+		var params []interface{}
+		for i := range batch {
+			params = append(params, feed.ID)
+			params = append(params, itemInsertValues(&batch[i])...)
+		}
+
+		// the savepoint allows to find the broken item of a failed batch
+		_, err = tx.ExecContext(ctx, "SAVEPOINT items_batch")
+		if err != nil {
+			return fmt.Errorf("cannot create savepoint: %v", err)
+		}
+
+		var rows *sql.Rows
+
+		if len(batch) == postgresqlInsertBatchSize {
+			// the statement of full batches is prepared once per transaction
+			if full == nil {
+				full, err = tx.PrepareContext(ctx, insertItemsStatement(len(batch)))
+				if err != nil {
+					return fmt.Errorf("cannot prepare insert of items: %v", err)
+				}
+			}
+
+			rows, err = full.QueryContext(ctx, params...)
+		} else {
+			rows, err = tx.QueryContext(ctx, insertItemsStatement(len(batch)), params...)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot insert items %d to %d: %s", start, end-1, brokenItemError(ctx, tx, feed, batch, err))
+		}
+
+		err = upserted(rows)
 		if err != nil {
 			return err
 		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT items_batch")
+		if err != nil {
+			return fmt.Errorf("cannot release savepoint: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// brokenItemError returns the error of the first item of the failed batch which cannot be inserted on its own
+func brokenItemError(ctx context.Context, tx *sql.Tx, feed *feedme.Feed, batch []feedme.Item, batchErr error) string {
+	// the savepoint was taken before the batch
+	_, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT items_batch")
+	if err != nil {
+		return postgresqlError(batchErr)
+	}
+
+	for i := range batch {
+		params := append([]interface{}{feed.ID}, itemInsertValues(&batch[i])...)
+
+		rows, err := tx.QueryContext(ctx, insertItemsStatement(1), params...)
+		if err != nil {
+			return fmt.Sprintf("item %q with the URI %q and the title %q: %s", batch[i].GUID, batch[i].URI, batch[i].Title, postgresqlError(err))
+		}
+		rows.Close()
+	}
+
+	// no item fails alone
+	return postgresqlError(batchErr)
+}
+
+// postgresqlError returns the message of the error with the detail and the context of PostgreSQL errors
+func postgresqlError(err error) string {
+	message := err.Error()
+
+	if e, ok := err.(*pq.Error); ok {
+		if e.Detail != "" {
+			message += ", " + e.Detail
+		}
+		if e.Where != "" {
+			message += ", " + e.Where
+		}
+	}
+
+	return message
+}
+
+// insertItemsStatement returns the upsert statement of the given count of items
+func insertItemsStatement(count int) string {
+	columns := strings.Count(postgresqlItemInsertColumns, ",") + 2
+
+	values := make([]string, count)
+	for i := range values {
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+
+		values[i] = "(" + strings.Join(placeholders, ", ") + ", CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)"
+	}
+
+	return "INSERT INTO items(feed, " + postgresqlItemInsertColumns + ", created, last_seen) VALUES " + strings.Join(values, ",") + postgresqlItemUpsert
+}
+
+// copyItems upserts the items by copying them into a temporary table which is then merged into the items
+func copyItems(ctx context.Context, tx *sql.Tx, feed *feedme.Feed, items []feedme.Item, upserted func(rows *sql.Rows) error) error {
+	// the savepoint allows to find the broken item of a failed copy
+	_, err := tx.ExecContext(ctx, "SAVEPOINT items_batch")
+	if err != nil {
+		return fmt.Errorf("cannot create savepoint: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE TEMPORARY TABLE items_copy (guid TEXT NOT NULL, title TEXT NOT NULL, uri TEXT NOT NULL, description TEXT NOT NULL, author TEXT NOT NULL, categories TEXT NOT NULL, enclosure_url TEXT NOT NULL, enclosure_type TEXT NOT NULL, enclosure_length BIGINT NOT NULL, image TEXT NOT NULL, fields JSONB NOT NULL) ON COMMIT DROP")
+	if err != nil {
+		return fmt.Errorf("cannot create table for copying items: %v", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("items_copy", strings.Split(postgresqlItemInsertColumns, ", ")...))
+	if err != nil {
+		return fmt.Errorf("cannot copy items: %v", err)
+	}
+
+	for i := range items {
+		_, err = stmt.ExecContext(ctx, itemInsertValues(&items[i])...)
+		if err != nil {
+			stmt.Close()
+
+			return fmt.Errorf("cannot copy items: %s", brokenItemError(ctx, tx, feed, items, err))
+		}
+	}
+
+	// the copy is finished by an execution without values
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+
+		return fmt.Errorf("cannot copy items: %s", brokenItemError(ctx, tx, feed, items, err))
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return fmt.Errorf("cannot copy items: %s", brokenItemError(ctx, tx, feed, items, err))
+	}
+
+	rows, err := tx.QueryContext(ctx, "INSERT INTO items(feed, "+postgresqlItemInsertColumns+", created, last_seen) SELECT $1, "+postgresqlItemInsertColumns+", CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM items_copy"+postgresqlItemUpsert, feed.ID)
+	if err != nil {
+		return fmt.Errorf("cannot merge copied items: %s", brokenItemError(ctx, tx, feed, items, err))
+	}
+
+	return upserted(rows)
+}
+
+// itemInsertValues returns the values of the postgresqlItemInsertColumns of the item
+func itemInsertValues(i *feedme.Item) []interface{} {
+	return []interface{}{i.GUID, i.Title, i.URI, i.Description, i.Author, i.Categories, i.Enclosure.URL, i.Enclosure.Type, i.Enclosure.Length, i.Image, i.Fields}
+}
+
+// BackfillItems inserts the items which are not stored yet with their creation times
+func (p *Postgresql) BackfillItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, error) {
+	var err error
+
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	guids := make(map[string]int, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		guids[items[i].GUID] = i
+	}
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	columns := strings.Count(postgresqlItemInsertColumns, ",") + 3
+
+	var created []feedme.Item
+
+	for start := 0; start < len(items); start += postgresqlInsertBatchSize {
+		end := start + postgresqlInsertBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		var values []string
+		var params []interface{}
+		for i := start; i < end; i++ {
+			placeholders := make([]string, columns)
+			for j := range placeholders {
+				placeholders[j] = fmt.Sprintf("$%d", len(params)+j+1)
+			}
+			values = append(values, "("+strings.Join(placeholders, ", ")+", CURRENT_TIMESTAMP)")
+
+			params = append(params, feed.ID)
+			params = append(params, itemInsertValues(&items[i])...)
+			params = append(params, items[i].Created)
+		}
+
+		var rows *sql.Rows
+		// stored items are left untouched and the listeners of ListenItems are not notified as backfilled items are old
+		rows, err = tx.QueryContext(ctx, "INSERT INTO items(feed, "+postgresqlItemInsertColumns+", created, last_seen) VALUES "+strings.Join(values, ",")+" ON CONFLICT (feed, guid) DO NOTHING RETURNING id, guid", params...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot insert items %d to %d: %v", start, end-1, err)
+		}
+
+		for rows.Next() {
+			var id int
+			var guid string
+
+			err = rows.Scan(&id, &guid)
+			if err != nil {
+				rows.Close()
+
+				return nil, err
+			}
+
+			i := items[guids[guid]]
+			i.Feed = feed.ID
+			i.ID = id
+
+			created = append(created, i)
+		}
+		rows.Close()
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (p *Postgresql) MarkUnseen(ctx context.Context, feed *feedme.Feed, seenGUIDs []string) (int, error) {
+	res, err := p.Db.ExecContext(ctx, "UPDATE items SET expired = TRUE WHERE feed = $1 AND NOT expired AND NOT (guid = ANY($2))", feed.ID, pq.Array(seenGUIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
+
+func (p *Postgresql) UpdateItemMedia(ctx context.Context, feed *feedme.Feed, item *feedme.Item) error {
+	_, err := p.Db.ExecContext(ctx, "UPDATE items SET media = $3, enclosure_url = $4, enclosure_type = $5, enclosure_length = $6 WHERE feed = $1 AND id = $2", feed.ID, item.ID, item.Media, item.Enclosure.URL, item.Enclosure.Type, item.Enclosure.Length)
+
+	return err
+}
+
+func (p *Postgresql) UpdateItemHidden(ctx context.Context, feed *feedme.Feed, id int, hidden bool) error {
+	res, err := p.Db.ExecContext(ctx, "UPDATE items SET hidden = $3 WHERE feed = $1 AND id = $2", feed.ID, id, hidden)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return fmt.Errorf("item %d of feed %q %w", id, feed.Name, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (p *Postgresql) SearchMedia(ctx context.Context) ([]string, error) {
+	var media []string
+
+	err := p.Db.SelectContext(ctx, &media, "SELECT DISTINCT media FROM items WHERE media <> ''")
+	if err != nil {
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// notifyItems notifies the listeners of ListenItems about the created items
+func notifyItems(ctx context.Context, tx *sql.Tx, feed *feedme.Feed, items []feedme.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	payloads := make([]string, 0, len(items))
+
+	for _, i := range items {
+		event := ItemEvent{
+			Feed:     feed.ID,
+			FeedName: feed.Name,
+			Private:  feed.Private(),
+			ID:       i.ID,
+			Title:    i.Title,
+			URI:      i.URI,
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		// an oversized payload would fail the whole transaction, so the title is dropped and if that is not enough the notification
+		// PostgreSQL only allows payloads shorter than 8000 bytes
+		if len(data) > postgresqlNotifyMaxPayload {
+			event.Title = ""
+
+			data, err = json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if len(data) > postgresqlNotifyMaxPayload {
+				continue
+			}
+		}
+
+		payloads = append(payloads, string(data))
+	}
+
+	// the notifications are only delivered once the transaction is committed
+	_, err := tx.ExecContext(ctx, "SELECT pg_notify($1, payload) FROM unnest($2::text[]) AS payload", postgresqlItemsChannel, pq.Array(payloads))
+	if err != nil {
+		return fmt.Errorf("cannot notify about new items: %v", err)
+	}
 
 	return nil
 }
 
-func (p *Postgresql) FindFeed(feedName string) (*feedme.Feed, error) {
+// ListenItems listens with its own connection for the notifications of CreateItems until the context is done
+func (p *Postgresql) ListenItems(ctx context.Context) (<-chan ItemEvent, error) {
+	listener := pq.NewListener(p.spec, time.Second, time.Minute, nil)
+
+	err := listener.Listen(postgresqlItemsChannel)
+	if err != nil {
+		listener.Close()
+
+		return nil, fmt.Errorf("cannot listen for new items: %v", err)
+	}
+
+	events := make(chan ItemEvent)
+
+	go func() {
+		defer close(events)
+		defer listener.Close()
+
+		ping := time.NewTicker(postgresqlListenerPing)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ping.C:
+				go listener.Ping()
+			case n := <-listener.Notify:
+				// nil announces a reestablished connection, notifications while reconnecting are lost
+				if n == nil {
+					continue
+				}
+
+				var event ItemEvent
+				if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+func (p *Postgresql) CreateFeed(ctx context.Context, feed *feedme.Feed) error {
+	err := p.Db.GetContext(ctx, &feed.ID, "INSERT INTO feeds(name, url, transform, crawl_interval, category, enabled, token, display_title, description, language, site_url, schedule, hide_source) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id", feed.Name, feed.URL, feed.Transform, feed.Interval, feed.Category, feed.Enabled, feed.Token, feed.DisplayTitle, feed.Description, feed.Language, feed.SiteURL, feed.Schedule, feed.HideSource)
+	if e, ok := err.(*pq.Error); ok && e.Code == postgresqlUniqueViolation {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrDuplicate)
+	}
+
+	return err
+}
+
+func (p *Postgresql) FindFeed(ctx context.Context, feedName string) (*feedme.Feed, error) {
 	feed := &feedme.Feed{}
 
-	err := p.Db.Get(feed, "SELECT * FROM feeds WHERE name = $1", feedName)
+	err := p.Db.GetContext(ctx, feed, "SELECT "+postgresqlFeedColumns+" FROM feeds WHERE name = $1", feedName)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, fmt.Errorf("feed %q %w", feedName, ErrNotFound)
+	} else if err != nil {
+		return nil, err
 	}
 
-	return feed, err
+	return feed, nil
 }
 
-func (p *Postgresql) SearchFeeds(feedNames []string) ([]feedme.Feed, error) {
+func (p *Postgresql) SearchFeeds(ctx context.Context, feedNames []string, category string, includeDisabled bool) ([]feedme.Feed, error) {
 	feeds := []feedme.Feed{}
 
 	var params []interface{}
-	filter := ""
+	var conditions []string
 
 	if feedNames != nil && len(feedNames) != 0 {
 		a := make([]string, len(feedNames))
@@ -86,10 +761,24 @@ func (p *Postgresql) SearchFeeds(feedNames []string) ([]feedme.Feed, error) {
 			params = append(params, feedName)
 		}
 
-		filter = "WHERE name IN (" + strings.Join(a, ",") + ")"
+		conditions = append(conditions, "name IN ("+strings.Join(a, ",")+")")
+	}
+
+	if category != "" {
+		params = append(params, category)
+		conditions = append(conditions, fmt.Sprintf("category = $%d", len(params)))
+	}
+
+	if !includeDisabled {
+		conditions = append(conditions, "enabled")
+	}
+
+	filter := ""
+	if len(conditions) != 0 {
+		filter = "WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	err := p.Db.Select(&feeds, "SELECT * FROM feeds "+filter+"ORDER BY name", params...)
+	err := p.Db.SelectContext(ctx, &feeds, "SELECT "+postgresqlFeedColumns+" FROM feeds "+filter+" ORDER BY name", params...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -97,25 +786,388 @@ func (p *Postgresql) SearchFeeds(feedNames []string) ([]feedme.Feed, error) {
 	return feeds, err
 }
 
-func (p *Postgresql) FindItemByURI(feed *feedme.Feed, uri string) (*feedme.Item, error) {
+func (p *Postgresql) SearchDueFeeds(ctx context.Context, now time.Time, category string, includeDisabled bool) ([]feedme.Feed, error) {
+	feeds := []feedme.Feed{}
+
+	// schedules cannot be evaluated in SQL so feeds with schedules are checked afterwards
+	err := p.Db.SelectContext(ctx, &feeds, "SELECT "+postgresqlFeedColumns+" FROM feeds WHERE (enabled OR $2) AND ($3 = '' OR category = $3) AND (schedule <> '' OR crawl_interval <= 0 OR last_crawled IS NULL OR last_crawled + crawl_interval * INTERVAL '1 second' <= $1) ORDER BY name", now, includeDisabled, category)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	due := feeds[:0]
+	for _, feed := range feeds {
+		if feed.Due(now) {
+			due = append(due, feed)
+		}
+	}
+
+	return due, nil
+}
+
+func (p *Postgresql) UpdateFeed(ctx context.Context, feed *feedme.Feed) error {
+	res, err := p.Db.ExecContext(ctx, "UPDATE feeds SET url = $2, transform = $3, crawl_interval = $4, category = NULLIF($5, ''), display_title = $6, description = $7, language = $8, site_url = $9, schedule = $10, hide_source = $11 WHERE id = $1", feed.ID, feed.URL, feed.Transform, feed.Interval, feed.Category, feed.DisplayTitle, feed.Description, feed.Language, feed.SiteURL, feed.Schedule, feed.HideSource)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (p *Postgresql) UpdateFeedLastCrawled(ctx context.Context, feed *feedme.Feed, crawled time.Time) error {
+	_, err := p.Db.ExecContext(ctx, "UPDATE feeds SET last_crawled = $2, failure_count = 0, last_error = '' WHERE id = $1", feed.ID, crawled)
+	if err != nil {
+		return err
+	}
+
+	feed.LastCrawled = &crawled
+	feed.FailureCount = 0
+	feed.LastError = ""
+
+	return nil
+}
+
+func (p *Postgresql) UpdateFeedFailure(ctx context.Context, feed *feedme.Feed, lastError string, maxFailures int) error {
+	err := p.Db.QueryRowContext(ctx, "UPDATE feeds SET failure_count = failure_count + 1, last_error = $2, enabled = enabled AND ($3 <= 0 OR failure_count + 1 < $3) WHERE id = $1 RETURNING failure_count, enabled", feed.ID, lastError, maxFailures).Scan(&feed.FailureCount, &feed.Enabled)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	feed.LastError = lastError
+
+	return nil
+}
+
+func (p *Postgresql) UpdateFeedEmptyRuns(ctx context.Context, feed *feedme.Feed, empty bool) error {
+	err := p.Db.QueryRowContext(ctx, "UPDATE feeds SET empty_runs = CASE WHEN $2 THEN empty_runs + 1 ELSE 0 END WHERE id = $1 RETURNING empty_runs", feed.ID, empty).Scan(&feed.EmptyRuns)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+	}
+
+	return err
+}
+
+func (p *Postgresql) DeleteFeed(ctx context.Context, feed *feedme.Feed, keepItems bool) error {
+	var err error
+
+	tx, err := p.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// items and crawl runs are deleted with the feed unless the items are kept as orphans
+	if keepItems {
+		_, err = tx.ExecContext(ctx, "UPDATE items SET feed = NULL WHERE feed = $1", feed.ID)
+		if err != nil {
+			return fmt.Errorf("cannot orphan items: %v", err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM feeds WHERE id = $1", feed.ID)
+	if err != nil {
+		return fmt.Errorf("cannot delete feed: %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		err = fmt.Errorf("feed %q %w", feed.Name, ErrNotFound)
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgresql) FeedStats(ctx context.Context) ([]FeedStat, error) {
+	stats := []FeedStat{}
+
+	// the newest crawl run of every feed is joined laterally to use the index of crawl runs
+	err := p.Db.SelectContext(ctx, &stats, "SELECT f.id AS feed, COALESCE(i.items, 0) AS items, COALESCE(i.recent_items, 0) AS recent_items, i.newest_item, r.started AS last_run, COALESCE(r.error, '') AS last_run_error FROM feeds f LEFT JOIN (SELECT feed, COUNT(*) AS items, COUNT(*) FILTER (WHERE created >= $1) AS recent_items, MAX(created) AS newest_item FROM items WHERE feed IS NOT NULL GROUP BY feed) i ON i.feed = f.id LEFT JOIN LATERAL (SELECT started, error FROM crawl_runs WHERE feed = f.id ORDER BY started DESC, id DESC LIMIT 1) r ON true ORDER BY f.id", time.Now().Add(-RecentItemsAge))
+
+	return stats, err
+}
+
+func (p *Postgresql) RecordCrawl(ctx context.Context, feed *feedme.Feed, run *feedme.CrawlRun) error {
+	var err error
+
+	tx, err := p.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	run.Feed = feed.ID
+
+	err = tx.GetContext(ctx, &run.ID, "INSERT INTO crawl_runs(feed, started, duration, items_found, items_inserted, error) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", run.Feed, run.Started, run.Duration, run.ItemsFound, run.ItemsInserted, run.Error)
+	if err != nil {
+		return fmt.Errorf("cannot insert crawl run: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM crawl_runs WHERE feed = $1 AND id NOT IN (SELECT id FROM crawl_runs WHERE feed = $1 ORDER BY started DESC, id DESC LIMIT $2)", feed.ID, CrawlRunsRetention)
+	if err != nil {
+		return fmt.Errorf("cannot delete old crawl runs: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgresql) SearchCrawlRuns(ctx context.Context, feed *feedme.Feed, limit int) ([]feedme.CrawlRun, error) {
+	runs := []feedme.CrawlRun{}
+
+	err := p.Db.SelectContext(ctx, &runs, "SELECT "+postgresqlCrawlRunColumns+" FROM crawl_runs WHERE feed = $1 ORDER BY started DESC, id DESC LIMIT $2", feed.ID, limit)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return runs, err
+}
+
+func (p *Postgresql) CountItems(ctx context.Context) (map[int]int, error) {
+	var rows []struct {
+		Feed  int `db:"feed"`
+		Count int `db:"count"`
+	}
+
+	err := p.Db.SelectContext(ctx, &rows, "SELECT feed, COUNT(*) AS count FROM items WHERE feed IS NOT NULL GROUP BY feed")
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int, len(rows))
+	for _, r := range rows {
+		counts[r.Feed] = r.Count
+	}
+
+	return counts, nil
+}
+
+func (p *Postgresql) FindItemByID(ctx context.Context, feed *feedme.Feed, id int) (*feedme.Item, error) {
 	item := &feedme.Item{}
 
-	err := p.Db.Get(item, "SELECT * FROM items WHERE feed = $1 AND uri = $2", feed.ID, uri)
+	err := p.Db.GetContext(ctx, item, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND id = $2", feed.ID, id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("item %d of feed %q %w", id, feed.Name, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (p *Postgresql) FindItemByURI(ctx context.Context, feed *feedme.Feed, uri string) (*feedme.Item, error) {
+	item := &feedme.Item{}
+
+	err := p.Db.GetContext(ctx, item, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND uri = $2", feed.ID, uri)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("item %q of feed %q %w", uri, feed.Name, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (p *Postgresql) SearchItems(ctx context.Context, feed *feedme.Feed) ([]feedme.Item, error) {
+	items := []feedme.Item{}
+
+	err := p.Db.SelectContext(ctx, &items, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND NOT hidden ORDER BY created DESC LIMIT 10", feed.ID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
-	return item, err
+	return items, err
 }
 
-func (p *Postgresql) SearchItems(feed *feedme.Feed) ([]feedme.Item, error) {
+func (p *Postgresql) SearchItemsAll(ctx context.Context, limit int) ([]feedme.Item, error) {
 	items := []feedme.Item{}
 
-	err := p.Db.Select(&items, "SELECT * FROM items WHERE feed = $1 ORDER BY created DESC LIMIT 10", feed.ID)
+	err := p.Db.SelectContext(ctx, &items, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed IS NOT NULL AND NOT hidden ORDER BY created DESC, id DESC LIMIT $1", limit)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 
 	return items, err
+}
+
+// SearchItemsPage returns the newest items of the feed which are older than the item with the given creation time and ID
+func (p *Postgresql) SearchItemsPage(ctx context.Context, feed *feedme.Feed, before time.Time, beforeID int, limit int) ([]feedme.Item, error) {
+	var err error
+
+	items := []feedme.Item{}
+
+	// the (created, id) cursor uses the items_feed_created_id_idx index so that later pages are as fast as the first one
+	if before.IsZero() {
+		err = p.Db.SelectContext(ctx, &items, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND NOT hidden ORDER BY created DESC, id DESC LIMIT $2", feed.ID, limit)
+	} else {
+		err = p.Db.SelectContext(ctx, &items, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND NOT hidden AND (created, id) < ($2, $3) ORDER BY created DESC, id DESC LIMIT $4", feed.ID, before, beforeID, limit)
+	}
+
+	return items, err
+}
+
+func (p *Postgresql) SearchItemsQuery(ctx context.Context, query ItemQuery) ([]feedme.Item, error) {
+	// orphaned items of deleted feeds and hidden items are never found
+	where := []string{"feed IS NOT NULL", "NOT hidden"}
+	var params []interface{}
+
+	param := func(value interface{}) string {
+		params = append(params, value)
+
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	order := "created DESC, id DESC"
+
+	if query.Query != "" {
+		// queries without words, e.g. only punctuation, cannot use the full-text search
+		var words int
+		err := p.Db.GetContext(ctx, &words, "SELECT numnode(plainto_tsquery('simple', $1))", query.Query)
+		if err != nil {
+			return nil, err
+		}
+
+		if words != 0 {
+			tsquery := "plainto_tsquery('simple', " + param(query.Query) + ")"
+
+			where = append(where, postgresqlSearchVector+" @@ "+tsquery)
+
+			if query.Order == ItemOrderRank {
+				order = "ts_rank(" + postgresqlSearchVector + ", " + tsquery + ") DESC, " + order
+			}
+		} else {
+			pattern := param("%" + postgresqlLikeEscaper.Replace(query.Query) + "%")
+
+			where = append(where, "(title ILIKE "+pattern+" OR description ILIKE "+pattern+")")
+		}
+	}
+	if len(query.Feeds) != 0 {
+		ids := make([]string, len(query.Feeds))
+		for i, id := range query.Feeds {
+			ids[i] = param(id)
+		}
+
+		where = append(where, "feed IN ("+strings.Join(ids, ", ")+")")
+	}
+	if !query.Since.IsZero() {
+		where = append(where, "created >= "+param(query.Since))
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "created < "+param(query.Until))
+	}
+	if query.Active {
+		where = append(where, "NOT expired")
+	}
+
+	statement := "SELECT " + postgresqlItemColumns + " FROM items"
+	if len(where) != 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	statement += " ORDER BY " + order + " LIMIT " + param(query.limit())
+
+	items := []feedme.Item{}
+
+	err := p.Db.SelectContext(ctx, &items, statement, params...)
+
+	return items, err
+}
+
+func (p *Postgresql) WalkItems(ctx context.Context, feed *feedme.Feed, since time.Time, walk func(item *feedme.Item) error) error {
+	rows, err := p.Db.QueryxContext(ctx, "SELECT "+postgresqlItemColumns+" FROM items WHERE feed = $1 AND created >= $2 AND NOT hidden ORDER BY created, id", feed.ID, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item feedme.Item
+
+		err = rows.StructScan(&item)
+		if err != nil {
+			return err
+		}
 
+		err = walk(&item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (p *Postgresql) FindRobotsFile(ctx context.Context, origin string) (*feedme.RobotsFile, error) {
+	robots := &feedme.RobotsFile{}
+
+	err := p.Db.GetContext(ctx, robots, "SELECT origin, content, fetched FROM robots_files WHERE origin = $1", origin)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("robots.txt of %s %w", origin, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return robots, nil
+}
+
+func (p *Postgresql) UpdateRobotsFile(ctx context.Context, robots *feedme.RobotsFile) error {
+	_, err := p.Db.ExecContext(ctx, "INSERT INTO robots_files(origin, content, fetched) VALUES ($1, $2, $3) ON CONFLICT (origin) DO UPDATE SET content = EXCLUDED.content, fetched = EXCLUDED.fetched", robots.Origin, robots.Content, robots.Fetched)
+
+	return err
+}
+
+func (p *Postgresql) LockCrawler(ctx context.Context, wait time.Duration) (func(), error) {
+	var err error
+
+	// the advisory lock belongs to the session of the connection, which must therefore not be shared with the pool of the other queries
+	db, err := sqlx.ConnectContext(ctx, "postgres", p.spec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	deadline := time.Now().Add(wait)
+
+	for {
+		var locked bool
+
+		err = db.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1)", postgresqlCrawlerLock)
+		if err != nil {
+			db.Close()
+
+			return nil, fmt.Errorf("cannot acquire crawler lock: %v", err)
+		}
+
+		if locked {
+			return func() {
+				_, _ = db.Exec("SELECT pg_advisory_unlock($1)", postgresqlCrawlerLock)
+				db.Close()
+			}, nil
+		}
+
+		if err := sleepUntil(ctx, deadline); err != nil {
+			db.Close()
+
+			return nil, err
+		}
+	}
 }
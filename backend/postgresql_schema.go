@@ -0,0 +1,161 @@
+package backend
+
+// postgresqlMigrationLock is the advisory lock key which serializes concurrent migrations
+const postgresqlMigrationLock = 4711
+
+// postgresqlMigrations holds the ordered schema migrations
+var postgresqlMigrations = []string{
+	// 1: initial schema
+	`
+CREATE TABLE IF NOT EXISTS feeds (
+	id SERIAL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	transform TEXT NOT NULL,
+	PRIMARY KEY(id),
+	UNIQUE(name)
+);
+
+CREATE TABLE IF NOT EXISTS items (
+	feed INTEGER NOT NULL,
+	id SERIAL,
+	title TEXT NOT NULL,
+	uri TEXT NOT NULL,
+	description TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	PRIMARY KEY(id),
+	CONSTRAINT items_feed_fk FOREIGN KEY(feed) REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS items_feed_content_key ON items(feed, md5(title), md5(uri), md5(description));
+CREATE INDEX IF NOT EXISTS items_feed_created_idx ON items(feed, created);
+`,
+	// 2: item GUIDs
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS guid TEXT;
+
+UPDATE items i SET guid = md5(CASE
+		WHEN i.uri ~ '[a-zA-Z0-9+\-.]+://' THEN i.uri
+		WHEN i.uri LIKE '/%' THEN substring(f.url FROM '^[a-zA-Z0-9+\-.]+://[^/?#]*') || i.uri
+		ELSE regexp_replace(split_part(f.url, '?', 1), '([^/])$', '\1/') || i.uri
+	END)
+	FROM feeds f
+	WHERE f.id = i.feed AND i.guid IS NULL;
+UPDATE items SET guid = guid || '-' || id WHERE id NOT IN (SELECT MIN(id) FROM items GROUP BY feed, guid);
+
+ALTER TABLE items ALTER COLUMN guid SET NOT NULL;
+
+DROP INDEX IF EXISTS items_feed_content_key;
+CREATE UNIQUE INDEX IF NOT EXISTS items_feed_guid_key ON items(feed, guid);
+`,
+	// 3: item authors, categories and enclosures
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS author TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS categories TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS enclosure_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS enclosure_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS enclosure_length BIGINT NOT NULL DEFAULT 0;
+`,
+	// 4: crawl scheduling of feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS crawl_interval INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS last_crawled TIMESTAMP WITH TIME ZONE;
+`,
+	// 5: disabling of failing feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS enabled BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS failure_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '';
+`,
+	// 6: crawl run history
+	`
+CREATE TABLE IF NOT EXISTS crawl_runs (
+	feed INTEGER NOT NULL,
+	id SERIAL,
+	started TIMESTAMP WITH TIME ZONE NOT NULL,
+	duration BIGINT NOT NULL,
+	items_found INTEGER NOT NULL,
+	items_inserted INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	PRIMARY KEY(id),
+	CONSTRAINT crawl_runs_feed_fk FOREIGN KEY(feed) REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS crawl_runs_feed_started_idx ON crawl_runs(feed, started);
+`,
+	// 7: tokens of private feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS token TEXT NOT NULL DEFAULT '';
+`,
+	// 8: full-text search of items
+	`
+CREATE INDEX IF NOT EXISTS items_search_idx ON items USING GIN (` + postgresqlSearchVector + `);
+`,
+	// 9: feed categories
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS category TEXT;
+
+CREATE INDEX IF NOT EXISTS feeds_category_idx ON feeds(category);
+`,
+	// 10: cache of robots.txt files
+	`
+CREATE TABLE IF NOT EXISTS robots_files (
+	origin TEXT NOT NULL,
+	content TEXT NOT NULL,
+	fetched TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY(origin)
+);
+`,
+	// 11: orphaned items of deleted feeds
+	`
+ALTER TABLE items ALTER COLUMN feed DROP NOT NULL;
+`,
+	// 12: display metadata of feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS display_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS site_url TEXT NOT NULL DEFAULT '';
+`,
+	// 13: presence of items in their source
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP WITH TIME ZONE;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS expired BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE items SET last_seen = created WHERE last_seen IS NULL;
+`,
+	// 14: consecutive crawls without items
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS empty_runs INTEGER NOT NULL DEFAULT 0;
+`,
+	// 15: cached images of items
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS image TEXT NOT NULL DEFAULT '';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS media TEXT NOT NULL DEFAULT '';
+`,
+	// 16: crawl schedules of feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS schedule TEXT NOT NULL DEFAULT '';
+`,
+	// 17: keyset pagination of items
+	`
+CREATE INDEX IF NOT EXISTS items_feed_created_id_idx ON items(feed, created, id);
+DROP INDEX IF EXISTS items_feed_created_idx;
+`,
+	// 18: extra fields of items
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS fields JSONB NOT NULL DEFAULT '{}';
+`,
+	// 19: edits of items
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS updated TIMESTAMP WITH TIME ZONE;
+`,
+	// 20: hidden items
+	`
+ALTER TABLE items ADD COLUMN IF NOT EXISTS hidden BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+	// 21: hidden sources of feeds
+	`
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS hide_source BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+}
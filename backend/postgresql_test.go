@@ -0,0 +1,329 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/zimmski/feedme"
+)
+
+// testPostgresql returns a PostgreSQL backend with a schema of its own in the database of FEEDME_TEST_SPEC
+func testPostgresql(tb testing.TB, copyThreshold int) *Postgresql {
+	tb.Helper()
+
+	spec := os.Getenv("FEEDME_TEST_SPEC")
+	if spec == "" {
+		tb.Skip("FEEDME_TEST_SPEC is not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", spec)
+	if err != nil {
+		tb.Fatalf("cannot connect to database: %v", err)
+	}
+
+	schema := fmt.Sprintf("feedme_test_%d", time.Now().UnixNano())
+
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		admin.Close()
+
+		tb.Fatalf("cannot create schema: %v", err)
+	}
+
+	p := NewBackendPostgresql().(*Postgresql)
+
+	tb.Cleanup(func() {
+		if p.Db != nil {
+			p.Db.Close()
+		}
+
+		_, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if err != nil {
+			tb.Errorf("cannot drop schema: %v", err)
+		}
+
+		admin.Close()
+	})
+
+	// one connection proves that failed transactions do not leave broken connections behind
+	err = p.Init(Parameters{
+		Spec:          spec + " search_path=" + schema,
+		MaxIdleConns:  1,
+		MaxOpenConns:  1,
+		CopyThreshold: copyThreshold,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	err = p.InitSchema(context.Background())
+	if err != nil {
+		tb.Fatalf("cannot initialize schema: %v", err)
+	}
+
+	return p
+}
+
+// testPostgresqlFeed creates a feed of the given name
+func testPostgresqlFeed(tb testing.TB, p *Postgresql, name string) *feedme.Feed {
+	tb.Helper()
+
+	feed := &feedme.Feed{
+		Name:      name,
+		URL:       "http://example.com/" + name,
+		Transform: "{}",
+		Enabled:   true,
+	}
+
+	err := p.CreateFeed(context.Background(), feed)
+	if err != nil {
+		tb.Fatalf("cannot create feed %s: %v", name, err)
+	}
+
+	return feed
+}
+
+// testItemCount returns items with the GUIDs and titles item0 to item<count-1>
+func testItemCount(count int) []feedme.Item {
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("item%d", i)
+	}
+
+	return testItems(names...)
+}
+
+func TestPostgresqlCreateItemsRollback(t *testing.T) {
+	for name, copyThreshold := range map[string]int{
+		"insert": 0,
+		"copy":   1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := testPostgresql(t, copyThreshold)
+			feed := testPostgresqlFeed(t, p, "news")
+
+			// the item of the second batch cannot be stored as PostgreSQL rejects NUL characters in texts
+			items := testItemCount(postgresqlInsertBatchSize + 10)
+			items[postgresqlInsertBatchSize+5].Title = "broken\x00title"
+
+			_, _, err := p.CreateItems(context.Background(), feed, items)
+			if err == nil {
+				t.Fatal("expected an error for the broken item")
+			}
+			if broken := fmt.Sprintf("item%d", postgresqlInsertBatchSize+5); !strings.Contains(err.Error(), `item "`+broken+`"`) {
+				t.Errorf("expected the error to name the broken item %s, got %v", broken, err)
+			}
+
+			counts, err := p.CountItems(context.Background())
+			if err != nil {
+				t.Fatalf("expected the connection to be usable after the failed transaction, got %v", err)
+			}
+			if counts[feed.ID] != 0 {
+				t.Fatalf("expected no committed items, got %d", counts[feed.ID])
+			}
+
+			// the items of the failed transaction were not committed and are created again
+			items[postgresqlInsertBatchSize+5].Title = "fixed title"
+
+			created, _, err := p.CreateItems(context.Background(), feed, items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(created) != len(items) {
+				t.Errorf("expected %d created items, got %d", len(items), len(created))
+			}
+
+			stored, err := p.FindItemByURI(context.Background(), feed, "/"+items[postgresqlInsertBatchSize+5].GUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stored.Title, "fixed") {
+				t.Errorf("expected the fixed title, got %q", stored.Title)
+			}
+		})
+	}
+}
+
+// benchmarkCreateItems stores count new items per iteration via calls of CreateItems with perCall items each
+func benchmarkCreateItems(b *testing.B, count int, perCall int, copyThreshold int) {
+	p := testPostgresql(b, copyThreshold)
+	feed := testPostgresqlFeed(b, p, "news")
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		items := testItemCount(count)
+		for i := range items {
+			items[i].GUID = fmt.Sprintf("%d/%s", n, items[i].GUID)
+		}
+		b.StartTimer()
+
+		for start := 0; start < len(items); start += perCall {
+			end := start + perCall
+			if end > len(items) {
+				end = len(items)
+			}
+
+			_, _, err := p.CreateItems(context.Background(), feed, items[start:end])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkCreateItemsPerItem stores 500 items with one statement per item in one transaction like before the batches
+func BenchmarkCreateItemsPerItem(b *testing.B) {
+	p := testPostgresql(b, 0)
+	feed := testPostgresqlFeed(b, p, "news")
+
+	query := insertItemsStatement(1)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		items := testItemCount(500)
+		for i := range items {
+			items[i].GUID = fmt.Sprintf("%d/%s", n, items[i].GUID)
+		}
+		b.StartTimer()
+
+		tx, err := p.Db.BeginTx(context.Background(), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for i := range items {
+			rows, err := tx.QueryContext(context.Background(), query, append([]interface{}{feed.ID}, itemInsertValues(&items[i])...)...)
+			if err != nil {
+				tx.Rollback()
+
+				b.Fatal(err)
+			}
+			rows.Close()
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateItemsBatch stores 500 items with one multi-row statement
+func BenchmarkCreateItemsBatch(b *testing.B) {
+	benchmarkCreateItems(b, 500, 500, 0)
+}
+
+// BenchmarkCreateItemsCopy stores 500 items via COPY
+func BenchmarkCreateItemsCopy(b *testing.B) {
+	benchmarkCreateItems(b, 500, 500, 1)
+}
+
+// BenchmarkCreateItemsLargeBatches stores 2000 items of a big crawl with the prepared statement of full batches
+func BenchmarkCreateItemsLargeBatches(b *testing.B) {
+	benchmarkCreateItems(b, 2*postgresqlInsertBatchSize, 2*postgresqlInsertBatchSize, 0)
+}
+
+// BenchmarkCreateItemsLargeCopy stores 2000 items of a big crawl via COPY above a threshold of one batch
+func BenchmarkCreateItemsLargeCopy(b *testing.B) {
+	benchmarkCreateItems(b, 2*postgresqlInsertBatchSize, 2*postgresqlInsertBatchSize, postgresqlInsertBatchSize)
+}
+
+func TestPostgresqlExtraColumns(t *testing.T) {
+	p := testPostgresql(t, 0)
+
+	// columns of newer versions or of other tools must not break the queries of the explicit column lists
+	for _, table := range []string{"feeds", "items"} {
+		_, err := p.Db.Exec("ALTER TABLE " + table + " ADD COLUMN unused_extra TEXT NOT NULL DEFAULT 'extra'")
+		if err != nil {
+			t.Fatalf("cannot add column to %s: %v", table, err)
+		}
+	}
+
+	err := p.CheckSchema(context.Background())
+	if err != nil {
+		t.Fatalf("expected the schema with extra columns to be usable, got %v", err)
+	}
+
+	feed := testPostgresqlFeed(t, p, "news")
+
+	created, _, err := p.CreateItems(context.Background(), feed, testItems("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 created items, got %d", len(created))
+	}
+
+	found, err := p.FindFeed(context.Background(), feed.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != feed.ID || found.URL != feed.URL {
+		t.Errorf("expected the feed %+v, got %+v", feed, found)
+	}
+
+	feeds, err := p.SearchFeeds(context.Background(), nil, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Name != feed.Name {
+		t.Errorf("expected the feed %s, got %+v", feed.Name, feeds)
+	}
+
+	items, err := p.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(items))
+	}
+
+	item, err := p.FindItemByID(context.Background(), feed, created[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Title != created[0].Title {
+		t.Errorf("expected the item %s, got %s", created[0].Title, item.Title)
+	}
+
+	all, err := p.SearchItemsAll(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected 2 items of all feeds, got %d", len(all))
+	}
+}
+
+func TestPostgresqlError(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{errors.New("broken"), "broken"},
+		{&pq.Error{Message: "invalid byte sequence"}, "pq: invalid byte sequence"},
+		{&pq.Error{Message: "invalid byte sequence", Detail: "Key (guid)=(a)", Where: "COPY items_copy, line 3"}, "pq: invalid byte sequence, Key (guid)=(a), COPY items_copy, line 3"},
+	} {
+		if message := postgresqlError(tc.err); message != tc.expected {
+			t.Errorf("expected %q, got %q", tc.expected, message)
+		}
+	}
+}
+
+func TestPostgresqlUpdateFeedNotFound(t *testing.T) {
+	p := testPostgresql(t, 0)
+
+	testUpdateFeedNotFound(t, p, testPostgresqlFeed(t, p, "news"))
+}
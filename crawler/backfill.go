@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/transform"
+)
+
+// Backfill crawls the archive pages of the backfill element of the transform of the feed once to seed the feed with its history
+func (c *Crawler) Backfill(ctx context.Context, feed *feedme.Feed, log *slog.Logger) Result {
+	result := Result{
+		Feed: feed.Name,
+	}
+
+	start := time.Now()
+
+	result.Err = c.backfill(ctx, feed, log, &result.Stats)
+
+	result.Duration = time.Since(start)
+
+	result.Log(log)
+
+	return result
+}
+
+func (c *Crawler) backfill(ctx context.Context, feed *feedme.Feed, log *slog.Logger, stats *Stats) error {
+	spec, err := transform.Parse(feed.Transform)
+	if err != nil {
+		return err
+	} else if spec.Backfill == nil {
+		return fmt.Errorf("transform defines no backfill element")
+	}
+
+	maxPages := c.options.BackfillMaxPages
+	if spec.Backfill.MaxPages > 0 && spec.Backfill.MaxPages < maxPages {
+		maxPages = spec.Backfill.MaxPages
+	}
+
+	client, err := c.fetchClient(spec.Request.Proxy)
+	if err != nil {
+		return err
+	}
+
+	client, err = c.sessionClient(ctx, client, feed.URL, &spec.Request, log)
+	if err != nil {
+		return err
+	}
+
+	// backfills of url templates know their pages while all other backfills start with the page of the feed
+	urls, more, err := spec.Backfill.URLs(maxPages)
+	if err != nil {
+		return err
+	} else if urls == nil {
+		urls = []string{feed.URL}
+	}
+
+	seen := make(map[string]bool)
+
+	for page := 1; page <= len(urls); page++ {
+		pageURL := urls[page-1]
+		if seen[pageURL] {
+			log.Info("stopped backfill at already crawled page", "page", page, "url", pageURL)
+
+			return nil
+		}
+		seen[pageURL] = true
+
+		items, next, err := c.backfillPage(ctx, feed, spec, client, pageURL, log, stats)
+		if errors.Is(err, ErrDisallowed) {
+			log.Warn("stopped backfill", "page", page, "reason", err)
+
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot backfill page %d %s: %s", page, pageURL, err.Error())
+		}
+
+		// items which are already stored are left untouched
+		created, err := c.db.BackfillItems(ctx, feed, items)
+		if err != nil {
+			return fmt.Errorf("cannot insert items of page %d into database: %s", page, err.Error())
+		}
+
+		stats.ItemsInserted += len(created)
+
+		log.Info("backfilled page", "page", page, "url", pageURL, "found", len(items), "new", len(created))
+
+		if len(items) == 0 {
+			log.Info("stopped backfill at page without items", "page", page)
+
+			return nil
+		}
+
+		if next != "" {
+			if len(urls) == maxPages {
+				more = true
+
+				break
+			}
+
+			urls = append(urls, next)
+		}
+	}
+
+	if more {
+		log.Warn("stopped backfill at max pages, more pages are left", "pages", len(urls))
+	}
+
+	return nil
+}
+
+// backfillPage fetches and transforms the page of a backfill and returns its items and the URL of its next page, if the backfill follows next pages
+func (c *Crawler) backfillPage(ctx context.Context, feed *feedme.Feed, spec *transform.Spec, client *http.Client, pageURL string, log *slog.Logger, stats *Stats) ([]feedme.Item, string, error) {
+	// the feed timeout applies to every page
+	if c.options.FeedTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.FeedTimeout)
+		defer cancel()
+	}
+
+	if !c.options.IgnoreRobots && !spec.Request.IgnoreRobots {
+		err := c.checkRobots(ctx, client, pageURL, log)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	log.Debug("fetch backfill page", "url", pageURL)
+
+	data, header, final, status, err := c.fetchPage(ctx, client, pageURL, log)
+	stats.HTTPStatus = status
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot open URL: %s", err.Error())
+	}
+
+	contentType := header.Get("Content-Type")
+
+	err = spec.CheckContentType(contentType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var pageStats Stats
+	items, err := c.items(feed, func(spec *transform.Spec) ([]byte, string, string, error) {
+		return data, contentType, final, nil
+	}, nil, log, &pageStats)
+	if err != nil {
+		return nil, "", err
+	}
+
+	stats.ItemsFound += pageStats.ItemsFound
+	stats.ItemsFiltered += pageStats.ItemsFiltered
+
+	next, err := spec.NextPage(spec.Backfill.Next, data, contentType, final)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot find next page: %s", err.Error())
+	}
+
+	return items, next, nil
+}
@@ -0,0 +1,812 @@
+package crawler
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/transform"
+)
+
+// databaseRetryDelay is the delay before a failed ping of the database is retried
+const databaseRetryDelay = time.Second
+
+// transformPage transforms a page with the transform of a feed, tests replace it to inject broken transforms
+var transformPage = (*transform.Spec).ExtractPage
+
+// Options holds the settings of a crawler
+type Options struct {
+	BackfillMaxPages     int
+	HTTPMaxBody          int64
+	HTTPMaxRedirects     int
+	HTTPRetries          int
+	FeedTimeout          time.Duration
+	HTTPTimeout          time.Duration
+	IgnoreRobots         bool
+	MaxAge               time.Duration
+	MaxDescriptionLength int
+	MaxFailures          int
+	MaxItems             int
+	MaxTitleLength       int
+	MediaDir             string
+	MediaMaxSize         int64
+	NotifyRetries        int
+	NotifyTemplate       *template.Template
+	NotifyTimeout        time.Duration
+	NotifyURL            string
+	PageCacheSize        int64
+	PerHostConcurrency   int
+	PerHostDelay         time.Duration
+	Proxy                *url.URL
+	RecordFixtures       string
+	ReplayFixtures       string
+	RobotsTTL            time.Duration
+	SameHostRedirects    bool
+	Sanitize             string
+	SnapshotAlways       bool
+	SnapshotDir          string
+	SnapshotKeep         int
+	WarnEmptyAfter       int
+	WebSubBaseURL        string
+	WebSubHub            string
+}
+
+// DefaultOptions holds the same defaults as the arguments of the feedme crawler
+var DefaultOptions = Options{
+	BackfillMaxPages:   50,
+	FeedTimeout:        5 * time.Minute,
+	HTTPMaxBody:        10485760,
+	HTTPMaxRedirects:   10,
+	HTTPRetries:        2,
+	HTTPTimeout:        30 * time.Second,
+	MediaMaxSize:       5242880,
+	NotifyRetries:      2,
+	NotifyTimeout:      10 * time.Second,
+	PageCacheSize:      52428800,
+	PerHostConcurrency: 1,
+	RobotsTTL:          24 * time.Hour,
+	Sanitize:           SanitizeRelaxed,
+}
+
+// Stats holds the counters of a crawl of a feed
+type Stats struct {
+	FetchDuration time.Duration
+	HTTPStatus    int
+	ItemsFound    int
+	ItemsInserted int
+	ItemsUpdated  int
+	ItemsFiltered int
+	// TransformDuration is the time of transforming the page and StoreDuration the time of storing the items
+	TransformDuration time.Duration
+	StoreDuration     time.Duration
+	// Snapshot is the file of the stored snapshot of the fetched page
+	Snapshot string
+}
+
+// Result represents the outcome of a crawl of a feed
+type Result struct {
+	Stats
+
+	Feed     string
+	Duration time.Duration
+	Err      error
+	// EmptyRuns is the count of consecutive crawls without items if it reached the threshold of the options, which hints at a broken transform
+	EmptyRuns int
+}
+
+// Log logs the outcome of the crawl
+func (r *Result) Log(log *slog.Logger) {
+	if r.Err != nil && r.Snapshot != "" {
+		log.Error("cannot process feed", "duration", r.Duration, "error", r.Err, "snapshot", r.Snapshot)
+	} else if r.Err != nil {
+		log.Error("cannot process feed", "duration", r.Duration, "error", r.Err)
+	} else {
+		log.Debug("processed feed", "duration", r.Duration)
+	}
+}
+
+// PanicError represents a recovered panic with the stack trace of the panic
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// NewPanicError returns an error for the recovered value of a panic which holds the stack trace of the panic
+func NewPanicError(r interface{}) error {
+	return &PanicError{
+		Value: r,
+		Stack: debug.Stack(),
+	}
+}
+
+// Crawler fetches and transforms the pages of feeds and stores the found items in a backend
+type Crawler struct {
+	db      backend.Backend
+	options Options
+
+	client       *http.Client
+	hosts        *hostLimiter
+	notifyClient *http.Client
+	pages        *pageCache
+	robots       *robotsCache
+
+	proxyClients     map[string]*http.Client
+	proxyClientsLock sync.Mutex
+}
+
+// New returns a crawler for the backend
+func New(db backend.Backend, options Options) *Crawler {
+	// without a proxy of the options the proxy of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables is used
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != nil {
+		proxy = http.ProxyURL(options.Proxy)
+	}
+
+	return &Crawler{
+		db:      db,
+		options: options,
+
+		client: newFetchClient(options, proxy),
+		hosts:  newHostLimiter(options.PerHostConcurrency, options.PerHostDelay),
+		notifyClient: &http.Client{
+			Timeout: options.NotifyTimeout,
+		},
+
+		pages:  newPageCache(options.PageCacheSize),
+		robots: newRobotsCache(),
+
+		proxyClients: make(map[string]*http.Client),
+	}
+}
+
+// Crawl fetches and transforms the page of the feed, stores the found items and records the crawl
+func (c *Crawler) Crawl(ctx context.Context, feed *feedme.Feed, log *slog.Logger) Result {
+	result := Result{
+		Feed: feed.Name,
+	}
+
+	start := time.Now()
+
+	// the outcome of the crawl must be recorded even after the feed timeout
+	recordCtx := context.WithoutCancel(ctx)
+
+	if c.options.FeedTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.FeedTimeout)
+		defer cancel()
+	}
+
+	var inserted []feedme.Item
+	var updated []feedme.Item
+
+	items, err := c.Items(ctx, feed, log, &result.Stats)
+	if errors.Is(err, ErrDisallowed) {
+		// feeds which must not be fetched are skipped without counting as failure
+		log.Warn("skipped feed", "reason", err)
+
+		result.Duration = time.Since(start)
+
+		return result
+	} else if err != nil {
+		result.Err = err
+	} else {
+		stored := time.Now()
+
+		inserted, updated, err = c.storeItems(ctx, feed, items, log)
+		if err != nil {
+			result.Err = fmt.Errorf("cannot insert items into database: %s", err.Error())
+		} else {
+			result.ItemsInserted = len(inserted)
+			result.ItemsUpdated = len(updated)
+
+			for _, item := range inserted {
+				log.Debug("new item", "title", item.Title, "guid", item.GUID)
+			}
+			for _, item := range updated {
+				log.Debug("updated item", "title", item.Title, "guid", item.GUID)
+			}
+			log.Debug("inserted items", "new", result.ItemsInserted, "updated", result.ItemsUpdated, "found", result.ItemsFound)
+
+			err = c.markUnseen(ctx, feed, items, log)
+			if err != nil {
+				result.Err = fmt.Errorf("cannot mark unseen items: %s", err.Error())
+			}
+
+			result.StoreDuration = time.Since(stored)
+
+			c.cacheImages(ctx, feed, inserted, log)
+			c.probeEnclosures(ctx, feed, inserted, log)
+		}
+	}
+
+	if result.Err == nil {
+		err = c.db.UpdateFeedLastCrawled(ctx, feed, start)
+		if err != nil {
+			result.Err = fmt.Errorf("cannot update last crawl time: %s", err.Error())
+		}
+	}
+
+	if result.Err == nil {
+		err = c.countEmptyRuns(ctx, feed, &result, log)
+		if err != nil {
+			result.Err = fmt.Errorf("cannot update count of crawls without items: %s", err.Error())
+		}
+	}
+
+	if result.Err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Err = fmt.Errorf("feed timeout of %s exceeded: %s", c.options.FeedTimeout, result.Err.Error())
+	}
+
+	result.Duration = time.Since(start)
+
+	result.Log(log)
+
+	run := &feedme.CrawlRun{
+		Started:       start,
+		Duration:      result.Duration,
+		ItemsFound:    result.ItemsFound,
+		ItemsInserted: result.ItemsInserted,
+	}
+	if result.Err != nil {
+		run.Error = result.Err.Error()
+	}
+
+	err = c.db.RecordCrawl(recordCtx, feed, run)
+	if err != nil {
+		log.Error("cannot record crawl run", "error", err)
+	}
+
+	if result.Err == nil && len(inserted) != 0 {
+		c.notify(recordCtx, feed, inserted, log)
+		c.publish(recordCtx, feed, log)
+	}
+
+	if result.Err != nil {
+		err = c.db.UpdateFeedFailure(recordCtx, feed, result.Err.Error(), c.options.MaxFailures)
+		if err != nil {
+			log.Error("cannot update failure count", "error", err)
+		} else if !feed.Enabled {
+			log.Warn("disabled feed after consecutive failures", "failures", feed.FailureCount)
+		}
+	}
+
+	return result
+}
+
+// storeItems stores the items after checking the connection to the database
+func (c *Crawler) storeItems(ctx context.Context, feed *feedme.Feed, items []feedme.Item, log *slog.Logger) ([]feedme.Item, []feedme.Item, error) {
+	err := c.db.Ping(ctx)
+	if err != nil {
+		// a restarted database or connections which were killed by a firewall must not fail the feed
+		log.Warn("retry ping of database", "backoff", databaseRetryDelay, "error", err)
+
+		err = sleep(ctx, databaseRetryDelay)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = c.db.Ping(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot ping database: %s", err.Error())
+		}
+	}
+
+	return c.db.CreateItems(ctx, feed, items)
+}
+
+// markUnseen marks the stored items of the feed which were not found by the crawl as expired
+func (c *Crawler) markUnseen(ctx context.Context, feed *feedme.Feed, items []feedme.Item, log *slog.Logger) error {
+	// the page of a crawl without items is more likely broken than empty
+	if len(items) == 0 {
+		return nil
+	}
+
+	spec, err := transform.Parse(feed.Transform)
+	if err != nil || !spec.TrackPresence {
+		return nil
+	}
+
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+
+	marked, err := c.db.MarkUnseen(ctx, feed, guids)
+	if err != nil {
+		return err
+	}
+
+	if marked != 0 {
+		log.Debug("marked unseen items as expired", "count", marked)
+	}
+
+	return nil
+}
+
+// countEmptyRuns counts the consecutive crawls of the feed which found no items
+func (c *Crawler) countEmptyRuns(ctx context.Context, feed *feedme.Feed, result *Result, log *slog.Logger) error {
+	// filtered items count as found and transforms which allow empty pages are never counted
+	empty := result.ItemsFound == 0 && result.ItemsFiltered == 0
+	if empty {
+		if spec, err := transform.Parse(feed.Transform); err == nil && spec.AllowEmpty {
+			empty = false
+		}
+	}
+
+	if !empty && feed.EmptyRuns == 0 {
+		return nil
+	}
+
+	err := c.db.UpdateFeedEmptyRuns(ctx, feed, empty)
+	if err != nil {
+		return err
+	}
+
+	if c.options.WarnEmptyAfter > 0 && feed.EmptyRuns >= c.options.WarnEmptyAfter {
+		result.EmptyRuns = feed.EmptyRuns
+
+		log.Warn("found no items in consecutive crawls, the transform is likely broken", "crawls", feed.EmptyRuns)
+	}
+
+	return nil
+}
+
+// Items fetches and transforms the pages of the feed and returns the found items
+func (c *Crawler) Items(ctx context.Context, feed *feedme.Feed, log *slog.Logger, stats *Stats) ([]feedme.Item, error) {
+	var fetched []*fetchedPage
+	var client *http.Client
+
+	start := time.Now()
+
+	use := func(spec *transform.Spec, page *fetchedPage) ([]byte, string, string, error) {
+		page.source = spec.Source
+		fetched = append(fetched, page)
+
+		contentType := page.header.Get("Content-Type")
+
+		// e.g. PDFs or login pages of redirected feed URLs would otherwise be transformed into confusing results
+		err := spec.CheckContentType(contentType)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		return page.data, contentType, page.url, nil
+	}
+
+	items, err := c.items(feed, func(spec *transform.Spec) ([]byte, string, string, error) {
+		page, pageClient, err := c.fetchFeed(ctx, feed, spec, log, stats)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		client = pageClient
+
+		return use(spec, page)
+	}, func(spec *transform.Spec, pageURL string) ([]byte, string, string, error) {
+		page, err := c.fetchNextPage(ctx, feed, spec, client, pageURL, log, stats)
+		if err != nil {
+			return nil, "", "", err
+		}
+
+		return use(spec, page)
+	}, log, stats)
+
+	stats.TransformDuration = time.Since(start) - stats.FetchDuration
+
+	// the last fetched page is kept if the transform failed or if every page is kept
+	if c.options.SnapshotDir != "" && len(fetched) != 0 && (err != nil || c.options.SnapshotAlways) {
+		snapshot, serr := c.writeSnapshot(feed, fetched[len(fetched)-1], err)
+		if serr != nil {
+			log.Warn("cannot write snapshot", "error", serr)
+		} else {
+			stats.Snapshot = snapshot
+
+			log.Debug("wrote snapshot", "snapshot", snapshot)
+		}
+	}
+
+	// the fetched pages are recorded with the found items
+	if c.options.RecordFixtures != "" && err == nil {
+		err = c.recordFixture(feed, fetched, items, start)
+		if err != nil {
+			return nil, fmt.Errorf("cannot record fixture: %s", err.Error())
+		}
+
+		log.Debug("recorded fixture", "items", len(items))
+	}
+
+	return items, err
+}
+
+// fetchFeed fetches the page of the feed and returns it with the client of the fetch
+func (c *Crawler) fetchFeed(ctx context.Context, feed *feedme.Feed, spec *transform.Spec, log *slog.Logger, stats *Stats) (*fetchedPage, *http.Client, error) {
+	// recorded pages are replayed without using the network
+	if c.options.ReplayFixtures != "" {
+		log.Debug("replay fixture", "url", feed.URL)
+
+		page, err := c.replayFixture(feed, feed.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stats.HTTPStatus = page.status
+
+		return page, nil, nil
+	}
+
+	log.Debug("fetch feed", "url", feed.URL)
+
+	start := time.Now()
+
+	client, err := c.fetchClient(spec.Request.Proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !c.options.IgnoreRobots && !spec.Request.IgnoreRobots {
+		err = c.checkRobots(ctx, client, feed.URL, log)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	client, err = c.sessionClient(ctx, client, feed.URL, &spec.Request, log)
+	if err != nil {
+		stats.FetchDuration = time.Since(start)
+
+		return nil, nil, err
+	}
+
+	// another feed of the run could already have fetched the page
+	cached, store := c.pages.Lookup(ctx, pageCacheKey(client, spec.Request.Proxy, feed.URL))
+	if cached != nil {
+		log.Debug("page cache hit", "url", feed.URL, "final", cached.url)
+
+		cached.requestURL = feed.URL
+
+		stats.FetchDuration = time.Since(start)
+		stats.HTTPStatus = cached.status
+
+		return cached, client, nil
+	}
+
+	data, header, final, status, err := c.fetchPage(ctx, client, feed.URL, log)
+
+	stats.FetchDuration = time.Since(start)
+	stats.HTTPStatus = status
+
+	if err != nil {
+		store(nil, "")
+
+		return nil, nil, fmt.Errorf("cannot open URL: %s", err.Error())
+	}
+
+	page := &fetchedPage{
+		data:       data,
+		header:     header,
+		requestURL: feed.URL,
+		url:        final,
+		status:     status,
+	}
+
+	// the cache holds a copy as the source of the returned page is set for its feed
+	stored := *page
+	store(&stored, pageCacheKey(client, spec.Request.Proxy, final))
+
+	return page, client, nil
+}
+
+// fetchNextPage fetches a further page of the pagination of the feed with the client of the page of the feed
+func (c *Crawler) fetchNextPage(ctx context.Context, feed *feedme.Feed, spec *transform.Spec, client *http.Client, pageURL string, log *slog.Logger, stats *Stats) (*fetchedPage, error) {
+	if c.options.ReplayFixtures != "" {
+		log.Debug("replay fixture", "url", pageURL)
+
+		return c.replayFixture(feed, pageURL)
+	}
+
+	log.Debug("fetch next page", "url", pageURL)
+
+	start := time.Now()
+
+	if !c.options.IgnoreRobots && !spec.Request.IgnoreRobots {
+		err := c.checkRobots(ctx, client, pageURL, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, header, final, status, err := c.fetchPage(ctx, client, pageURL, log)
+
+	stats.FetchDuration += time.Since(start)
+
+	if err != nil {
+		stats.HTTPStatus = status
+
+		return nil, fmt.Errorf("cannot open URL: %s", err.Error())
+	}
+
+	return &fetchedPage{
+		data:       data,
+		header:     header,
+		requestURL: pageURL,
+		url:        final,
+		status:     status,
+	}, nil
+}
+
+// ResetPageCache removes the cached pages of the run so that the next run fetches all pages again
+func (c *Crawler) ResetPageCache() {
+	c.pages.Reset()
+}
+
+// ItemsOfPage transforms the given page instead of the page of the feed and returns the found items
+func (c *Crawler) ItemsOfPage(feed *feedme.Feed, page []byte, log *slog.Logger, stats *Stats) ([]feedme.Item, error) {
+	start := time.Now()
+
+	items, err := c.items(feed, func(spec *transform.Spec) ([]byte, string, string, error) {
+		return page, "", feed.URL, nil
+	}, nil, log, stats)
+
+	stats.TransformDuration = time.Since(start)
+
+	return items, err
+}
+
+// items transforms the page of the feed and, if the next function is given, the further pages of its pagination
+func (c *Crawler) items(feed *feedme.Feed, page func(spec *transform.Spec) ([]byte, string, string, error), next func(spec *transform.Spec, pageURL string) ([]byte, string, string, error), log *slog.Logger, stats *Stats) (items []feedme.Item, err error) {
+	defer func() {
+		// panics, e.g. of transforms on unexpected documents, only fail the feed
+		if r := recover(); r != nil {
+			items, err = nil, NewPanicError(r)
+		}
+	}()
+
+	return c.extractItems(feed, page, next, log, stats)
+}
+
+func (c *Crawler) extractItems(feed *feedme.Feed, page func(spec *transform.Spec) ([]byte, string, string, error), next func(spec *transform.Spec, pageURL string) ([]byte, string, string, error), log *slog.Logger, stats *Stats) ([]feedme.Item, error) {
+	var err error
+
+	spec, err := transform.Parse(feed.Transform)
+	if err != nil {
+		return nil, err
+	}
+
+	// the limits of the transform take precedence
+	if spec.MaxAge == 0 {
+		spec.MaxAge = c.options.MaxAge
+	}
+	if spec.MaxItems == 0 {
+		spec.MaxItems = c.options.MaxItems
+	}
+	if spec.MaxLength["title"] == 0 {
+		spec.MaxLength["title"] = c.options.MaxTitleLength
+	}
+	if spec.MaxLength["description"] == 0 {
+		spec.MaxLength["description"] = c.options.MaxDescriptionLength
+	}
+
+	var items []feedme.Item
+	filtered := 0
+
+	// visited holds the requested and the final URLs of the pages so that next pages which link back to a page end the pagination
+	visited := make(map[string]bool)
+
+	pageURL := feed.URL
+	for n := 1; ; n++ {
+		var data []byte
+		var contentType, finalURL string
+
+		if n == 1 {
+			data, contentType, finalURL, err = page(spec)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			data, contentType, finalURL, err = next(spec, pageURL)
+			if errors.Is(err, ErrDisallowed) {
+				log.Warn("stopped pagination", "page", n, "reason", err)
+
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("cannot fetch page %d of pagination: %s", n, err.Error())
+			}
+		}
+
+		visited[pageURL] = true
+		visited[finalURL] = true
+
+		pageItems, pageFiltered, err := c.extractPage(feed, spec, data, contentType, finalURL, log)
+		if err != nil && n > 1 {
+			return nil, fmt.Errorf("cannot transform page %d of pagination: %s", n, err.Error())
+		} else if err != nil {
+			return nil, err
+		}
+
+		items = append(items, pageItems...)
+		filtered += pageFiltered
+
+		// every crawl transforms the further pages of a pagination as new items can fall off the first page between crawls
+		if next == nil || spec.Pagination == nil || n >= spec.Pagination.MaxPages {
+			break
+		}
+
+		pageURL, err = spec.NextPage(spec.Pagination.Next, data, contentType, finalURL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find next page: %s", err.Error())
+		} else if pageURL == "" {
+			break
+		} else if visited[pageURL] {
+			log.Debug("stopped pagination at already visited page", "url", pageURL)
+
+			break
+		}
+
+		log.Debug("follow next page", "page", n+1, "url", pageURL)
+	}
+
+	// the items of the pages of a pagination are deduplicated and limited together like the items of one page
+	items, duplicates, err := dedupItems(feed, items)
+	if err != nil {
+		return nil, err
+	}
+	if duplicates != 0 {
+		log.Debug("dropped duplicate items of pages", "count", duplicates)
+	}
+
+	items, dropped := spec.LimitItems(items, log)
+	filtered += dropped
+
+	stats.ItemsFound = len(items)
+	stats.ItemsFiltered = filtered
+
+	if stats.ItemsFiltered != 0 {
+		log.Debug("filtered items", "count", stats.ItemsFiltered)
+	}
+
+	return items, nil
+}
+
+// extractPage transforms the page of the given URL, which is the page of the feed or a page of its pagination, and returns its items with resolved links and the count of items dropped by filters and limits
+func (c *Crawler) extractPage(feed *feedme.Feed, spec *transform.Spec, data []byte, contentType string, pageURL string, log *slog.Logger) ([]feedme.Item, int, error) {
+	// relative links are resolved with the URL of the page after redirects
+	base := feed
+	if pageURL != feed.URL {
+		redirected := *feed
+		redirected.URL = pageURL
+		base = &redirected
+	}
+
+	items, filtered, err := transformPage(spec, data, contentType, log)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, duplicates, err := dedupItems(base, items)
+	if err != nil {
+		return nil, 0, err
+	}
+	if duplicates != 0 {
+		log.Debug("dropped duplicate items", "count", duplicates)
+	}
+
+	for i := range items {
+		item := &items[i]
+
+		item.Description = absoluteLinks(sanitizeHTML(item.Description, c.options.Sanitize), base.BaseURL())
+
+		// the links of redirected pages, of further pages of a pagination and of hidden sources are made absolute as the server resolves relative links against the base URL of the feed
+		if base != feed || feed.HideSource {
+			for _, link := range []*string{&item.URI, &item.Enclosure.URL} {
+				if *link == "" {
+					continue
+				}
+
+				resolved, err := base.ResolveURI(*link)
+				if err != nil {
+					return nil, 0, fmt.Errorf("cannot resolve URI %s: %s", *link, err.Error())
+				}
+
+				*link = resolved
+			}
+		}
+
+		if item.GUID == "" {
+			uri, err := base.ResolveURI(item.URI)
+			if err != nil {
+				return nil, 0, fmt.Errorf("cannot resolve URI %s: %s", item.URI, err.Error())
+			}
+
+			item.GUID = fmt.Sprintf("%x", md5.Sum([]byte(uri)))
+		}
+
+		if item.Image != "" {
+			image, err := base.ResolveURI(item.Image)
+			if err != nil {
+				return nil, 0, fmt.Errorf("cannot resolve image URI %s: %s", item.Image, err.Error())
+			}
+
+			item.Image = image
+
+			// the image is the media object of items without an enclosure
+			if item.Enclosure.URL == "" {
+				item.Enclosure.URL = item.Image
+				item.Enclosure.Type = mime.TypeByExtension(path.Ext(item.Image))
+			}
+		}
+
+		log.Debug("found item", "title", item.Title, "uri", item.URI, "guid", item.GUID)
+	}
+
+	return items, filtered, nil
+}
+
+// dedupItems removes items with the same absolute URI as a previous item and returns the count of removed items
+func dedupItems(feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, int, error) {
+	seen := make(map[string]int, len(items))
+	unique := items[:0]
+
+	for _, item := range items {
+		// items without URI cannot be duplicates
+		if item.URI == "" {
+			unique = append(unique, item)
+
+			continue
+		}
+
+		uri, err := feed.ResolveURI(item.URI)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot resolve URI %s: %s", item.URI, err.Error())
+		}
+
+		i, ok := seen[uri]
+		if !ok {
+			seen[uri] = len(unique)
+			unique = append(unique, item)
+
+			continue
+		}
+
+		// duplicates like a pinned item which is also listed chronologically fill the empty fields of the kept item
+		kept := &unique[i]
+		if kept.GUID == "" {
+			kept.GUID = item.GUID
+		}
+		if kept.Title == "" {
+			kept.Title = item.Title
+		}
+		if kept.Description == "" {
+			kept.Description = item.Description
+		}
+		if kept.Author == "" {
+			kept.Author = item.Author
+		}
+		if len(kept.Categories) == 0 {
+			kept.Categories = item.Categories
+		}
+		if kept.Enclosure.URL == "" {
+			kept.Enclosure = item.Enclosure
+		}
+		if kept.Image == "" {
+			kept.Image = item.Image
+		}
+	}
+
+	return unique, len(items) - len(unique), nil
+}
@@ -0,0 +1,376 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/transform"
+)
+
+// testTransform stores the links of div.item elements as items
+const testTransform = `{
+	"items": [{"search": "div.item", "do": [{"find": "a", "do": [
+		{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+		{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+	]}]}],
+	"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+}`
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// testServer serves the given HTML pages by their paths
+func testServer(t *testing.T, pages map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		page, ok := pages[req.URL.Path]
+		if !ok {
+			http.NotFound(res, req)
+
+			return
+		}
+
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(res, page)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// testCrawler returns a crawler for the memory backend which ignores robots.txt files
+func testCrawler() (*Crawler, backend.Backend) {
+	db := backend.NewBackendMemory()
+
+	options := DefaultOptions
+	options.IgnoreRobots = true
+
+	return New(db, options), db
+}
+
+// testFeeds creates enabled feeds with the given names whose URLs are the paths of the same name of the server
+func testFeeds(t *testing.T, db backend.Backend, server *httptest.Server, transform string, names ...string) []*feedme.Feed {
+	var feeds []*feedme.Feed
+
+	for _, name := range names {
+		feed := &feedme.Feed{
+			Name:      name,
+			URL:       server.URL + "/" + name,
+			Transform: transform,
+			Enabled:   true,
+		}
+
+		err := db.CreateFeed(context.Background(), feed)
+		if err != nil {
+			t.Fatalf("cannot create feed %s: %v", name, err)
+		}
+
+		feeds = append(feeds, feed)
+	}
+
+	return feeds
+}
+
+// testPage returns an HTML page with one div.item element per title whose link is the lower case title
+func testPage(titles ...string) string {
+	var page bytes.Buffer
+
+	page.WriteString("<html><body>")
+	for _, title := range titles {
+		fmt.Fprintf(&page, `<div class="item"><a href="/%s">%s</a></div>`, title, title)
+	}
+	page.WriteString("</body></html>")
+
+	return page.String()
+}
+
+func TestCrawlPanickingTransform(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/first":  testPage("a", "b"),
+		"/broken": testPage("panic"),
+		"/last":   testPage("c", "d"),
+	})
+
+	extract := transformPage
+	transformPage = func(spec *transform.Spec, page []byte, contentType string, log *slog.Logger) ([]feedme.Item, int, error) {
+		if bytes.Contains(page, []byte("panic")) {
+			panic("broken transform")
+		}
+
+		return extract(spec, page, contentType, log)
+	}
+	t.Cleanup(func() {
+		transformPage = extract
+	})
+
+	c, db := testCrawler()
+	feeds := testFeeds(t, db, server, testTransform, "first", "broken", "last")
+
+	for _, feed := range feeds {
+		result := c.Crawl(context.Background(), feed, testLogger())
+
+		if feed.Name == "broken" {
+			var panicErr *PanicError
+			if !errors.As(result.Err, &panicErr) {
+				t.Fatalf("expected a panic error for feed %s, got %v", feed.Name, result.Err)
+			}
+			if panicErr.Value != "broken transform" {
+				t.Errorf("expected the value of the panic, got %v", panicErr.Value)
+			}
+			if len(panicErr.Stack) == 0 {
+				t.Errorf("expected the stack trace of the panic")
+			}
+
+			stored, err := db.FindFeed(context.Background(), feed.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.FailureCount != 1 {
+				t.Errorf("expected the panic to count as failure, got %d failures", stored.FailureCount)
+			}
+
+			continue
+		}
+
+		if result.Err != nil {
+			t.Fatalf("expected feed %s to be crawled, got %v", feed.Name, result.Err)
+		}
+		if result.ItemsInserted != 2 {
+			t.Errorf("expected 2 new items of feed %s, got %d", feed.Name, result.ItemsInserted)
+		}
+
+		items, err := db.SearchItems(context.Background(), feed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 2 {
+			t.Errorf("expected 2 stored items of feed %s, got %d", feed.Name, len(items))
+		}
+	}
+}
+
+func TestCrawlStoresItems(t *testing.T) {
+	pages := map[string]string{
+		"/news": testPage("a", "b"),
+	}
+	server := testServer(t, pages)
+
+	c, db := testCrawler()
+	feed := testFeeds(t, db, server, testTransform, "news")[0]
+
+	before := time.Now()
+	result := c.Crawl(context.Background(), feed, testLogger())
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	after := time.Now()
+
+	if result.ItemsFound != 2 || result.ItemsInserted != 2 {
+		t.Fatalf("expected 2 found and inserted items, got %d and %d", result.ItemsFound, result.ItemsInserted)
+	}
+
+	items, err := db.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.Created.Before(before) || item.Created.After(after) {
+			t.Errorf("expected item %s to be created during the crawl, got %s", item.Title, item.Created)
+		}
+	}
+
+	// known items are neither inserted nor updated again
+	pages["/news"] = testPage("a", "b", "c")
+
+	// the pages of one run are cached, the next run fetches them again
+	c = New(db, c.options)
+
+	result = c.Crawl(context.Background(), feed, testLogger())
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.ItemsFound != 3 || result.ItemsInserted != 1 || result.ItemsUpdated != 0 {
+		t.Errorf("expected 3 found, 1 inserted and 0 updated items, got %d, %d and %d", result.ItemsFound, result.ItemsInserted, result.ItemsUpdated)
+	}
+
+	stored, err := db.FindFeed(context.Background(), feed.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastCrawled == nil || stored.LastCrawled.Before(after) {
+		t.Errorf("expected the feed to be marked as crawled, got %v", stored.LastCrawled)
+	}
+}
+
+func TestDedupItems(t *testing.T) {
+	feed := &feedme.Feed{
+		URL: "http://example.com/news/",
+	}
+
+	items, duplicates, err := dedupItems(feed, []feedme.Item{
+		{Title: "First", URI: "/article/1"},
+		{URI: "/article/2"},
+		{GUID: "other", Title: "Duplicate", URI: "http://example.com/article/1", Description: "Text", Author: "Alice", Categories: []string{"go"}, Image: "/first.png"},
+		{Title: "Second", URI: "http://example.com/article/2", Enclosure: feedme.Enclosure{URL: "/second.mp3"}},
+		{Title: "Relative", URI: "article/2"},
+		// items without URI are never duplicates
+		{Title: "Without URI"},
+		{Title: "Without URI"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duplicates != 2 {
+		t.Errorf("expected 2 duplicates, got %d", duplicates)
+	}
+
+	expected := []feedme.Item{
+		// empty fields are filled by the duplicates while the fields of the first occurrence are kept
+		{GUID: "other", Title: "First", URI: "/article/1", Description: "Text", Author: "Alice", Categories: []string{"go"}, Image: "/first.png"},
+		{Title: "Second", URI: "/article/2", Enclosure: feedme.Enclosure{URL: "/second.mp3"}},
+		// relative URIs are resolved below the URL of the feed
+		{Title: "Relative", URI: "article/2"},
+		{Title: "Without URI"},
+		{Title: "Without URI"},
+	}
+	if fmt.Sprintf("%+v", items) != fmt.Sprintf("%+v", expected) {
+		t.Errorf("expected the items %+v, got %+v", expected, items)
+	}
+}
+
+func TestCrawlDuplicates(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "duplicates.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := testServer(t, map[string]string{
+		"/news": string(page),
+	})
+
+	c, db := testCrawler()
+	feed := testFeeds(t, db, server, `{
+		"items": [{"search": "div.item", "do": [
+			{"find": "a", "do": [
+				{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+				{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+			]},
+			{"find": "p", "optional": true, "do": [{"text": true, "do": [{"copy": true, "name": "description", "type": "string"}]}]}
+		]}],
+		"transform": {"title": "{{.title}}", "uri": "{{.uri}}", "description": "{{if .description}}{{.description}}{{end}}"}
+	}`, "news")[0]
+
+	result := c.Crawl(context.Background(), feed, testLogger())
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.ItemsFound != 3 || result.ItemsInserted != 3 {
+		t.Fatalf("expected 3 found and inserted items, got %d and %d", result.ItemsFound, result.ItemsInserted)
+	}
+
+	items, err := db.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first occurrences are kept in their order, the descriptions of later occurrences fill empty descriptions
+	var stored []string
+	for i := len(items) - 1; i >= 0; i-- {
+		stored = append(stored, items[i].Title+": "+items[i].Description)
+	}
+
+	expected := []string{
+		"Pinned: Second article: Text of the second article",
+		"First article: Text of the first article",
+		"Third article: Text of the third article",
+	}
+	if strings.Join(stored, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected the items %q, got %q", expected, stored)
+	}
+}
+
+func TestCrawlHiddenSource(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/private/news": `<html><body><div class="item"><a href="article">Article</a></div></body></html>`,
+	})
+
+	c, db := testCrawler()
+	feed := &feedme.Feed{
+		Name: "hidden",
+		URL:  server.URL + "/private/news?token=secret",
+		Transform: `{
+			"items": [{"search": "div.item", "do": [
+				{"find": "a", "do": [
+					{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+					{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+				]}
+			]}],
+			"transform": {"title": "{{.title}}", "uri": "{{.uri}}", "description": "<img src=\"image.png\"><a href=\"\">self</a>"}
+		}`,
+		Enabled:    true,
+		HideSource: true,
+	}
+	err := db.CreateFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := c.Crawl(context.Background(), feed, testLogger())
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	items, err := db.SearchItems(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+
+	// links are resolved against the host of the source without its path and query
+	if items[0].URI != server.URL+"/article" {
+		t.Errorf("expected the absolute link %s/article, got %s", server.URL, items[0].URI)
+	}
+	for _, hidden := range []string{"/private", "secret"} {
+		if strings.Contains(items[0].URI+items[0].Description+items[0].Enclosure.URL, hidden) {
+			t.Errorf("expected the hidden source %q not to be stored, got %+v", hidden, items[0])
+		}
+	}
+	if !strings.Contains(items[0].Description, server.URL+"/image.png") {
+		t.Errorf("expected the absolute image of the description, got %s", items[0].Description)
+	}
+}
+
+func TestCrawlMaxLengthNull(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/news": testPage("a", "b"),
+	})
+
+	c, db := testCrawler()
+	c.options.MaxTitleLength = 10
+
+	feed := testFeeds(t, db, server, strings.Replace(testTransform, "{", `{"max-length": null,`, 1), "news")[0]
+
+	result := c.Crawl(context.Background(), feed, testLogger())
+	if result.Err != nil {
+		t.Fatalf("expected a transform with a null max-length to be crawled, got %v", result.Err)
+	}
+	if result.ItemsInserted != 2 {
+		t.Errorf("expected 2 inserted items, got %d", result.ItemsInserted)
+	}
+}
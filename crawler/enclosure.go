@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/transform"
+)
+
+// probeEnclosures records the sizes and types of the enclosures of the new items, which podcast clients need
+func (c *Crawler) probeEnclosures(ctx context.Context, feed *feedme.Feed, items []feedme.Item, log *slog.Logger) {
+	var client *http.Client
+
+	for i := range items {
+		item := &items[i]
+		if item.Enclosure.URL == "" || item.Enclosure.Length != 0 {
+			continue
+		}
+
+		if client == nil {
+			spec, err := transform.Parse(feed.Transform)
+			if err != nil {
+				return
+			}
+
+			client, err = c.fetchClient(spec.Request.Proxy)
+			if err != nil {
+				log.Warn("cannot probe enclosures", "error", err)
+
+				return
+			}
+		}
+
+		length, typ, err := c.probeEnclosure(ctx, client, feed, item.Enclosure.URL, log)
+		if err != nil {
+			// the enclosure keeps the type of its extension without a size
+			log.Warn("cannot probe enclosure", "enclosure", item.Enclosure.URL, "error", err)
+
+			continue
+		}
+
+		item.Enclosure.Length = length
+		if typ != "" {
+			item.Enclosure.Type = typ
+		}
+
+		err = c.db.UpdateItemMedia(ctx, feed, item)
+		if err != nil {
+			log.Warn("cannot update enclosure", "enclosure", item.Enclosure.URL, "error", err)
+
+			continue
+		}
+
+		log.Debug("probed enclosure", "enclosure", item.Enclosure.URL, "length", item.Enclosure.Length, "type", item.Enclosure.Type)
+	}
+}
+
+// probeEnclosure returns the size and the type of the enclosure with the given URL via a HEAD request
+func (c *Crawler) probeEnclosure(ctx context.Context, client *http.Client, feed *feedme.Feed, enclosure string, log *slog.Logger) (int64, string, error) {
+	u, err := feed.ResolveURI(enclosure)
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	release, err := c.hosts.Acquire(ctx, req.URL.Host, log)
+	if err != nil {
+		return 0, "", err
+	}
+	defer release()
+
+	res, err := doRequest(client, req)
+	if err != nil {
+		return 0, "", err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	var length int64
+	if res.ContentLength > 0 {
+		length = res.ContentLength
+	}
+
+	var typ string
+	// generic types are no better than the type of the extension
+	if t, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && t != "application/octet-stream" {
+		typ = t
+	}
+
+	return length, typ, nil
+}
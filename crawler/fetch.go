@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zimmski/feedme/transform"
+)
+
+// redirectError is the error of a redirect which is not allowed by the options
+type redirectError struct {
+	message string
+}
+
+func (e *redirectError) Error() string {
+	return e.message
+}
+
+// newFetchClient returns a client for fetching pages which connects via the proxy function and follows redirects as allowed by the options
+func newFetchClient(options Options, proxy func(*http.Request) (*url.URL, error)) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > options.HTTPMaxRedirects {
+				return &redirectError{fmt.Sprintf("stopped after %d redirects", options.HTTPMaxRedirects)}
+			}
+			if options.SameHostRedirects && req.URL.Host != via[0].URL.Host {
+				return &redirectError{fmt.Sprintf("redirect to the other host %s is not allowed", req.URL.Host)}
+			}
+
+			return nil
+		},
+		Timeout:   options.HTTPTimeout,
+		Transport: transport,
+	}
+}
+
+// fetchClient returns the client for fetching pages via the given proxy of a transform
+func (c *Crawler) fetchClient(proxy string) (*http.Client, error) {
+	if proxy == "" {
+		return c.client, nil
+	}
+
+	c.proxyClientsLock.Lock()
+	defer c.proxyClientsLock.Unlock()
+
+	// all feeds with the same proxy share its client
+	if client, ok := c.proxyClients[proxy]; ok {
+		return client, nil
+	}
+
+	u, err := transform.ParseProxy(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse proxy: %s", err.Error())
+	}
+
+	client := newFetchClient(c.options, http.ProxyURL(u))
+	c.proxyClients[proxy] = client
+
+	return client, nil
+}
+
+// fetchPage fetches the page of the given URL with the client and returns it with its response headers, its final URL and its status code
+func (c *Crawler) fetchPage(ctx context.Context, client *http.Client, url string, log *slog.Logger) ([]byte, http.Header, string, int, error) {
+	// network errors and server errors are retried with an exponential backoff
+	backoff := time.Second
+
+	for try := 0; ; try++ {
+		data, header, final, status, retry, err := c.fetchPageOnce(ctx, client, url, log)
+		if err == nil || !retry || try >= c.options.HTTPRetries {
+			return data, header, final, status, err
+		}
+
+		log.Debug("retry fetch", "url", url, "try", try+1, "backoff", backoff, "error", err)
+
+		err = sleep(ctx, backoff)
+		if err != nil {
+			return nil, nil, "", status, err
+		}
+
+		backoff *= 2
+	}
+}
+
+// fetchPageOnce fetches the page of the given URL and returns if a failed fetch should be retried
+func (c *Crawler) fetchPageOnce(ctx context.Context, client *http.Client, url string, log *slog.Logger) ([]byte, http.Header, string, int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, "", 0, false, err
+	}
+
+	release, err := c.hosts.Acquire(ctx, req.URL.Host, log)
+	if err != nil {
+		return nil, nil, "", 0, false, err
+	}
+	defer release()
+
+	res, err := doRequest(client, req)
+	if err != nil {
+		var redirect *redirectError
+
+		// forbidden redirects would only be forbidden again
+		return nil, nil, "", 0, !errors.As(err, &redirect), err
+	}
+	defer res.Body.Close()
+
+	final := res.Request.URL.String()
+	if final != url {
+		log.Info("followed redirects", "url", url, "final", final)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, "", res.StatusCode, res.StatusCode >= 500, fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	var body io.Reader = res.Body
+	if c.options.HTTPMaxBody > 0 {
+		body = io.LimitReader(res.Body, c.options.HTTPMaxBody+1)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, nil, "", res.StatusCode, true, fmt.Errorf("cannot read response: %s", err.Error())
+	}
+
+	if c.options.HTTPMaxBody > 0 && int64(len(data)) > c.options.HTTPMaxBody {
+		return nil, nil, "", res.StatusCode, false, fmt.Errorf("response is bigger than the limit of %d bytes", c.options.HTTPMaxBody)
+	}
+
+	return data, res.Header, final, res.StatusCode, false, nil
+}
+
+// doRequest sends the request with the client
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		// the failure could be caused by the proxy of the request
+		if proxy, _ := client.Transport.(*http.Transport).Proxy(req); proxy != nil {
+			err = fmt.Errorf("%w (via proxy %s)", err, proxy.Redacted())
+		}
+
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// sleep waits for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
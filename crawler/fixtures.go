@@ -0,0 +1,269 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// fixturePagesFile is the file of a fixture directory of a feed which lists its recorded pages
+const fixturePagesFile = "pages.json"
+
+// fixtureItemsFile is the file of a fixture directory of a feed which holds its expected items
+const fixtureItemsFile = "items.json"
+
+// fixturePages represents the recorded pages of a feed
+type fixturePages struct {
+	Pages []fixturePage `json:"pages"`
+}
+
+// fixturePage represents a recorded page which is replayed for fetches of its URL
+type fixturePage struct {
+	URL         string `json:"url"`
+	FinalURL    string `json:"final_url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	File        string `json:"file"`
+}
+
+// fixtureItems represents the expected items of a feed
+type fixtureItems struct {
+	Recorded time.Time     `json:"recorded"`
+	Items    []feedme.Item `json:"items"`
+}
+
+// recordFixture writes the pages fetched for the feed with the items found on them to the fixture directory of the feed in the record directory of the options, replacing its previous fixture
+func (c *Crawler) recordFixture(feed *feedme.Feed, pages []*fetchedPage, items []feedme.Item, recorded time.Time) error {
+	dir := filepath.Join(c.options.RecordFixtures, feedDirName(feed.Name))
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var fixture fixturePages
+	for _, page := range pages {
+		ext, ok := snapshotExtensions[page.source]
+		if !ok {
+			ext = ".html"
+		}
+		file := fmt.Sprintf("%x%s", md5.Sum([]byte(page.requestURL)), ext)
+
+		err = ioutil.WriteFile(filepath.Join(dir, file), page.data, 0644)
+		if err != nil {
+			return err
+		}
+
+		fixture.Pages = append(fixture.Pages, fixturePage{
+			URL:         page.requestURL,
+			FinalURL:    page.url,
+			Status:      page.status,
+			ContentType: page.header.Get("Content-Type"),
+			File:        file,
+		})
+	}
+
+	if items == nil {
+		items = []feedme.Item{}
+	}
+
+	err = writeFixtureFile(filepath.Join(dir, fixturePagesFile), fixture)
+	if err != nil {
+		return err
+	}
+
+	return writeFixtureFile(filepath.Join(dir, fixtureItemsFile), fixtureItems{
+		Recorded: recorded,
+		Items:    items,
+	})
+}
+
+// writeFixtureFile writes the value as indented JSON to the file
+func writeFixtureFile(file string, v interface{}) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	// the descriptions of items stay readable
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	err := enc.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// replayFixture returns the recorded page of the URL from the fixture of the feed in the replay directory of the options
+func (c *Crawler) replayFixture(feed *feedme.Feed, url string) (*fetchedPage, error) {
+	dir := filepath.Join(c.options.ReplayFixtures, feedDirName(feed.Name))
+
+	var fixture fixturePages
+	err := readFixtureFile(filepath.Join(dir, fixturePagesFile), &fixture)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no fixture for URL %s in %s", url, dir)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read fixture: %s", err.Error())
+	}
+
+	for _, page := range fixture.Pages {
+		if page.URL != url {
+			continue
+		}
+
+		// the body of the page is stored next to the list of pages
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.Base(page.File)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read fixture: %s", err.Error())
+		}
+
+		header := http.Header{}
+		if page.ContentType != "" {
+			header.Set("Content-Type", page.ContentType)
+		}
+
+		return &fetchedPage{
+			data:       data,
+			header:     header,
+			requestURL: page.URL,
+			url:        page.FinalURL,
+			status:     page.Status,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no fixture for URL %s in %s", url, dir)
+}
+
+// readFixtureFile decodes the JSON file into the value
+func readFixtureFile(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// VerifyFixture compares the items with the expected items of the fixture of the feed and returns the differences
+func (c *Crawler) VerifyFixture(feed *feedme.Feed, items []feedme.Item) ([]string, error) {
+	var expected fixtureItems
+
+	err := readFixtureFile(filepath.Join(c.options.ReplayFixtures, feedDirName(feed.Name), fixtureItemsFile), &expected)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read expected items: %s", err.Error())
+	}
+
+	// the items are compared as their JSON values, which are also the values of the fixture
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var got []feedme.Item
+	err = json.Unmarshal(data, &got)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []string
+
+	// items are matched by their GUIDs
+	found := make(map[string]int, len(got))
+	for i, item := range got {
+		found[item.GUID] = i
+	}
+	known := make(map[string]bool, len(expected.Items))
+
+	for _, want := range expected.Items {
+		known[want.GUID] = true
+
+		i, ok := found[want.GUID]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("missing item %q (%s)", want.Title, want.GUID))
+
+			continue
+		}
+
+		// items without a date get the time of their crawl, so only creation times before the recording are compared
+		differences = append(differences, diffItem(want, got[i], want.Created.Before(expected.Recorded))...)
+	}
+
+	for _, item := range got {
+		if !known[item.GUID] {
+			differences = append(differences, fmt.Sprintf("unexpected item %q (%s)", item.Title, item.GUID))
+		}
+	}
+
+	if len(differences) == 0 && len(got) == len(expected.Items) {
+		for i := range got {
+			if got[i].GUID != expected.Items[i].GUID {
+				differences = append(differences, "items are in a different order")
+
+				break
+			}
+		}
+	}
+
+	return differences, nil
+}
+
+// diffItem returns the fields of the item which differ from the expected item as "item "title": field is value instead of expected"
+func diffItem(want feedme.Item, got feedme.Item, compareCreated bool) []string {
+	fields := func(item feedme.Item) map[string]interface{} {
+		var m map[string]interface{}
+
+		data, _ := json.Marshal(item)
+		_ = json.Unmarshal(data, &m)
+
+		return m
+	}
+
+	wantFields, gotFields := fields(want), fields(got)
+
+	names := make([]string, 0, len(wantFields)+len(gotFields))
+	for name := range wantFields {
+		names = append(names, name)
+	}
+	for name := range gotFields {
+		if _, ok := wantFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var differences []string
+	for _, name := range names {
+		if (name == "created" && !compareCreated) || reflect.DeepEqual(wantFields[name], gotFields[name]) {
+			continue
+		}
+
+		differences = append(differences, fmt.Sprintf("item %q: %s is %s instead of %s", want.Title, name, fixtureValue(gotFields[name]), fixtureValue(wantFields[name])))
+	}
+
+	return differences
+}
+
+// fixtureValue returns the JSON of a field value of an item
+func fixtureValue(v interface{}) string {
+	if v == nil {
+		return "empty"
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// hostLimiter limits the concurrent requests and the delay between requests per host across all workers
+type hostLimiter struct {
+	concurrency int
+	delay       time.Duration
+
+	lock  sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+type hostLimit struct {
+	slots chan struct{}
+
+	lock sync.Mutex
+	next time.Time
+}
+
+func newHostLimiter(concurrency int, delay time.Duration) *hostLimiter {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &hostLimiter{
+		concurrency: concurrency,
+		delay:       delay,
+		hosts:       make(map[string]*hostLimit),
+	}
+}
+
+// Acquire blocks until a request to the given host is allowed or the context is done and returns a function to release the request
+func (l *hostLimiter) Acquire(ctx context.Context, host string, log *slog.Logger) (func(), error) {
+	l.lock.Lock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{
+			slots: make(chan struct{}, l.concurrency),
+		}
+
+		l.hosts[host] = h
+	}
+	l.lock.Unlock()
+
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		log.Debug("wait for concurrent requests of host", "host", host)
+
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		<-h.slots
+	}
+
+	if l.delay > 0 {
+		now := time.Now()
+
+		h.lock.Lock()
+		start := h.next
+		if start.Before(now) {
+			start = now
+		}
+		h.next = start.Add(l.delay)
+		h.lock.Unlock()
+
+		if wait := start.Sub(now); wait > 0 {
+			log.Debug("wait for delay of host", "host", host, "wait", wait)
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return release, nil
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// absoluteLinks rewrites the relative URLs of the href, src and srcset attributes of the HTML to absolute URLs using the base URL
+func absoluteLinks(value string, base string) string {
+	// values without markup have no links
+	if !strings.Contains(value, "<") {
+		return value
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		return value
+	}
+
+	var out strings.Builder
+
+	z := html.NewTokenizer(strings.NewReader(value))
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			return out.String()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := string(z.Raw())
+			token := z.Token()
+
+			changed := false
+			for i, a := range token.Attr {
+				var v string
+
+				switch a.Key {
+				case "href", "src":
+					v = resolveLink(baseURL, a.Val)
+				case "srcset":
+					v = resolveSrcset(baseURL, a.Val)
+				default:
+					continue
+				}
+
+				if v != a.Val {
+					token.Attr[i].Val = v
+					changed = true
+				}
+			}
+
+			if changed {
+				out.WriteString(token.String())
+			} else {
+				out.WriteString(raw)
+			}
+		default:
+			out.Write(z.Raw())
+		}
+	}
+}
+
+// resolveLink returns the URL resolved against the base URL or the URL unchanged if it cannot be parsed
+func resolveLink(base *url.URL, link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link
+	}
+
+	return base.ResolveReference(u).String()
+}
+
+// resolveSrcset resolves the URLs of all image candidates of a srcset attribute
+func resolveSrcset(base *url.URL, srcset string) string {
+	// e.g. "a.png 1x, /b.png 2x"
+	candidates := strings.Split(srcset, ",")
+
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = resolveLink(base, fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestAbsoluteLinks(t *testing.T) {
+	const base = "https://example.com/blog/2024/post.html"
+
+	for _, tc := range []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"text", "images/x.png", "images/x.png"},
+		{"root relative", `<img src="/images/x.png">`, `<img src="https://example.com/images/x.png">`},
+		{"relative", `<img src="x.png">`, `<img src="https://example.com/blog/2024/x.png">`},
+		{"nested relative", `<a href="../2023/old/post.html">old</a>`, `<a href="https://example.com/blog/2023/old/post.html">old</a>`},
+		{"nested relative beyond root", `<a href="../../../../a">a</a>`, `<a href="https://example.com/a">a</a>`},
+		{"dot relative", `<a href="./images/../x.png">x</a>`, `<a href="https://example.com/blog/2024/x.png">x</a>`},
+		{"protocol relative", `<img src="//cdn.example.com/x.png">`, `<img src="https://cdn.example.com/x.png">`},
+		{"absolute", `<a href="http://other.com/a">a</a>`, `<a href="http://other.com/a">a</a>`},
+		{"fragment", `<a href="#comments">comments</a>`, `<a href="https://example.com/blog/2024/post.html#comments">comments</a>`},
+		{"query", `<a href="?page=2">next</a>`, `<a href="https://example.com/blog/2024/post.html?page=2">next</a>`},
+		{"srcset", `<img srcset="small.png 1x, /large.png 2x, //cdn.example.com/huge.png 3x">`, `<img srcset="https://example.com/blog/2024/small.png 1x, https://example.com/large.png 2x, https://cdn.example.com/huge.png 3x">`},
+		{"other attributes", `<p class="x"><b>bold</b></p>`, `<p class="x"><b>bold</b></p>`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := absoluteLinks(tc.value, base)
+			if actual != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAbsoluteLinksRelativeBase(t *testing.T) {
+	// links are kept without an absolute base URL
+	value := `<img src="x.png">`
+	if actual := absoluteLinks(value, "/blog/"); actual != value {
+		t.Errorf("expected %s, got %s", value, actual)
+	}
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zimmski/feedme/transform"
+)
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the references like ${FEEDME_SITE_PASSWORD} of the value with the values of their environment variables
+func expandEnv(value string) (string, error) {
+	var err error
+
+	expanded := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+
+		v, ok := os.LookupEnv(name)
+		// a missing password must not end in a confusing login failure
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return v
+	})
+
+	return expanded, err
+}
+
+// sessionClient returns a copy of the client with the cookies of the request element and the session cookies of its login
+func (c *Crawler) sessionClient(ctx context.Context, client *http.Client, feedURL string, request *transform.Request, log *slog.Logger) (*http.Client, error) {
+	if request.Login == nil && len(request.Cookies) == 0 {
+		return client, nil
+	}
+
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(request.Cookies) != 0 {
+		cookies := make([]*http.Cookie, len(request.Cookies))
+		for i, cookie := range request.Cookies {
+			value, err := expandEnv(cookie.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot set cookie %s: %s", cookie.Name, err.Error())
+			}
+
+			cookies[i] = &http.Cookie{
+				Name:  cookie.Name,
+				Value: value,
+				Path:  "/",
+			}
+		}
+
+		jar.SetCookies(base, cookies)
+	}
+
+	session := *client
+	session.Jar = jar
+
+	if request.Login != nil {
+		// the login happens before the page of the feed is fetched so that the fetch carries the session cookies of the login
+		err = c.login(ctx, &session, base, request.Login, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// login posts the form fields of the login element to its URL, which is relative to the URL of the feed, and checks that the login succeeded
+func (c *Crawler) login(ctx context.Context, client *http.Client, base *url.URL, login *transform.Login, log *slog.Logger) error {
+	ref, err := url.Parse(login.URL)
+	if err != nil {
+		return fmt.Errorf("cannot parse login URL: %s", err.Error())
+	}
+	loginURL := base.ResolveReference(ref)
+
+	form := url.Values{}
+	for name, value := range login.Fields {
+		v, err := expandEnv(value)
+		if err != nil {
+			return fmt.Errorf("cannot log in at %s: field %s: %s", loginURL, name, err.Error())
+		}
+
+		form.Set(name, v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("cannot log in at %s: %s", loginURL, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	release, err := c.hosts.Acquire(ctx, req.URL.Host, log)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	log.Debug("log in", "url", loginURL)
+
+	res, err := doRequest(client, req)
+	if err != nil {
+		return fmt.Errorf("cannot log in at %s: %s", loginURL, err.Error())
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("cannot log in at %s: unexpected status code %d %s", loginURL, res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	// the optional cookie element names the cookie which a successful login must set
+	if login.Cookie != "" {
+		found := false
+		for _, u := range []*url.URL{loginURL, base} {
+			for _, cookie := range client.Jar.Cookies(u) {
+				if cookie.Name == login.Cookie {
+					found = true
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("cannot log in at %s: the response did not set the cookie %s", loginURL, login.Cookie)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/transform"
+)
+
+// mediaTypes maps the MIME types of images which can be cached to the extensions of their files
+var mediaTypes = map[string]string{
+	// other types like SVG images, which can hold scripts, are not cached
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// media files are named by the hex SHA-256 hash of their content with the extension of their type
+var mediaFilePattern = regexp.MustCompile(`^[0-9a-f]{64}\.(gif|jpg|png|webp)$`)
+
+// IsMediaFile returns true if the name is the file name of a cached image
+func IsMediaFile(name string) bool {
+	return mediaFilePattern.MatchString(name)
+}
+
+// cacheImages downloads the images of the new items into the media directory of the options
+func (c *Crawler) cacheImages(ctx context.Context, feed *feedme.Feed, items []feedme.Item, log *slog.Logger) {
+	if c.options.MediaDir == "" {
+		return
+	}
+
+	spec, err := transform.Parse(feed.Transform)
+	if err != nil || !spec.CacheImages {
+		return
+	}
+
+	client, err := c.fetchClient(spec.Request.Proxy)
+	if err != nil {
+		log.Warn("cannot cache images", "error", err)
+
+		return
+	}
+
+	for i := range items {
+		item := &items[i]
+		if item.Image == "" {
+			continue
+		}
+
+		err = c.cacheImage(ctx, client, item, log)
+		if err == nil {
+			err = c.db.UpdateItemMedia(ctx, feed, item)
+		}
+		if err != nil {
+			// the item keeps the URL of its image
+			log.Warn("cannot cache image", "image", item.Image, "error", err)
+
+			continue
+		}
+
+		log.Debug("cached image", "image", item.Image, "media", item.Media)
+	}
+}
+
+// cacheImage downloads the image of the item into the media directory
+func (c *Crawler) cacheImage(ctx context.Context, client *http.Client, item *feedme.Item, log *slog.Logger) error {
+	data, err := c.fetchMedia(ctx, client, item.Image, log)
+	if err != nil {
+		return err
+	}
+
+	// the type of the content is trusted instead of the Content-Type header
+	typ := http.DetectContentType(data)
+	ext, ok := mediaTypes[typ]
+	if !ok {
+		return fmt.Errorf("type %s is not an allowed image type", typ)
+	}
+
+	name := fmt.Sprintf("%x", sha256.Sum256(data)) + ext
+
+	err = writeMedia(filepath.Join(c.options.MediaDir, name), data)
+	if err != nil {
+		return err
+	}
+
+	item.Media = name
+	// the image can be the enclosure of the item
+	if item.Enclosure.URL == item.Image {
+		item.Enclosure.Type = typ
+		item.Enclosure.Length = int64(len(data))
+	}
+
+	return nil
+}
+
+// fetchMedia fetches the media object of the given URL which must not be bigger than the max media size of the options
+func (c *Crawler) fetchMedia(ctx context.Context, client *http.Client, url string, log *slog.Logger) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := c.hosts.Acquire(ctx, req.URL.Host, log)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	res, err := doRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	if res.ContentLength > c.options.MediaMaxSize {
+		return nil, fmt.Errorf("media is bigger than the limit of %d bytes", c.options.MediaMaxSize)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, c.options.MediaMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response: %s", err.Error())
+	}
+
+	if int64(len(data)) > c.options.MediaMaxSize {
+		return nil, fmt.Errorf("media is bigger than the limit of %d bytes", c.options.MediaMaxSize)
+	}
+
+	return data, nil
+}
+
+// writeMedia writes the media file unless it exists already
+func writeMedia(file string, data []byte) error {
+	// an existing file has the same content and is touched so that it is not pruned before the item references it
+	if _, err := os.Stat(file); err == nil {
+		now := time.Now()
+
+		return os.Chtimes(file, now, now)
+	}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	// the server must never serve a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return nil
+}
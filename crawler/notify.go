@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/transform"
+)
+
+// Notification represents the payload of a notification about new items of a feed
+type Notification struct {
+	Feed  string             `json:"feed"`
+	Count int                `json:"count"`
+	Items []NotificationItem `json:"items"`
+}
+
+// NotificationItem represents a new item of a notification
+type NotificationItem struct {
+	Title string `json:"title"`
+	URI   string `json:"uri"`
+}
+
+// notify sends a notification about the new items to the URL of the notify element of the transform or of the options
+func (c *Crawler) notify(ctx context.Context, feed *feedme.Feed, items []feedme.Item, log *slog.Logger) {
+	url := c.options.NotifyURL
+	tem := c.options.NotifyTemplate
+
+	if spec, err := transform.Parse(feed.Transform); err == nil && spec.Notify != nil {
+		if spec.Notify.URL != "" {
+			url = spec.Notify.URL
+		}
+		if spec.Notify.Template != "" {
+			tem, err = transform.ParseNotifyTemplate("notify", spec.Notify.Template)
+			if err != nil {
+				log.Warn("cannot parse notify template", "error", err)
+
+				return
+			}
+		}
+	}
+
+	if url == "" {
+		return
+	}
+
+	notification := Notification{
+		Feed:  feed.Name,
+		Count: len(items),
+		Items: make([]NotificationItem, len(items)),
+	}
+	for i, item := range items {
+		uri, err := feed.ResolveURI(item.URI)
+		if err != nil {
+			uri = item.URI
+		}
+
+		notification.Items[i] = NotificationItem{
+			Title: item.Title,
+			URI:   uri,
+		}
+	}
+
+	var body bytes.Buffer
+	if tem != nil {
+		err := tem.Execute(&body, notification)
+		if err != nil {
+			log.Warn("cannot execute notify template", "error", err)
+
+			return
+		}
+	} else {
+		err := json.NewEncoder(&body).Encode(notification)
+		if err != nil {
+			log.Warn("cannot encode notification", "error", err)
+
+			return
+		}
+	}
+
+	backoff := time.Second
+
+	for try := 0; ; try++ {
+		retry, err := c.notifyOnce(ctx, url, body.Bytes())
+		if err == nil {
+			log.Debug("sent notification", "url", url, "items", len(items))
+
+			return
+		} else if !retry || try >= c.options.NotifyRetries {
+			log.Warn("cannot send notification", "url", url, "error", err)
+
+			return
+		}
+
+		log.Debug("retry notification", "url", url, "try", try+1, "backoff", backoff, "error", err)
+
+		if err := sleep(ctx, backoff); err != nil {
+			log.Warn("cannot send notification", "url", url, "error", err)
+
+			return
+		}
+
+		backoff *= 2
+	}
+}
+
+// notifyOnce posts the body to the URL and returns if a failed notification should be retried
+func (c *Crawler) notifyOnce(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.notifyClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode >= 500, fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	return false, nil
+}
@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// pageEntry is an entry of the page cache which is ready once its page is fetched
+type pageEntry struct {
+	ready chan struct{}
+	page  *fetchedPage
+	keys  []string
+}
+
+// pageCache caches the fetched pages of a run so that feeds with the same page fetch it only once
+type pageCache struct {
+	limit int64
+
+	lock    sync.Mutex
+	entries map[string]*pageEntry
+	// cached holds the entries with pages oldest first
+	cached []*pageEntry
+	size   int64
+}
+
+func newPageCache(limit int64) *pageCache {
+	return &pageCache{
+		limit:   limit,
+		entries: make(map[string]*pageEntry),
+	}
+}
+
+// pageCacheKey returns the cache key of a fetch of the URL with the client via the proxy of a transform
+func pageCacheKey(client *http.Client, proxy string, rawURL string) string {
+	// cookies like the session of a login can change the page
+	var cookies []string
+	if client.Jar != nil {
+		if u, err := url.Parse(rawURL); err == nil {
+			for _, cookie := range client.Jar.Cookies(u) {
+				cookies = append(cookies, cookie.Name+"="+cookie.Value)
+			}
+		}
+	}
+
+	return proxy + "\n" + strings.Join(cookies, "; ") + "\n" + rawURL
+}
+
+// Lookup returns a copy of the cached page of the key or nil with the store function of the page which the caller fetches
+func (p *pageCache) Lookup(ctx context.Context, key string) (*fetchedPage, func(page *fetchedPage, finalKey string)) {
+	skip := func(page *fetchedPage, finalKey string) {}
+
+	if p.limit <= 0 {
+		return nil, skip
+	}
+
+	p.lock.Lock()
+	entry, ok := p.entries[key]
+	if !ok {
+		entry = &pageEntry{
+			ready: make(chan struct{}),
+			keys:  []string{key},
+		}
+		p.entries[key] = entry
+	}
+	p.lock.Unlock()
+
+	if !ok {
+		return nil, func(page *fetchedPage, finalKey string) {
+			p.store(entry, page, finalKey)
+		}
+	}
+
+	// concurrent lookups wait for the fetch and fetch the page themselves if it is not stored
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		return nil, skip
+	}
+
+	if entry.page == nil {
+		return nil, skip
+	}
+
+	page := *entry.page
+
+	return &page, skip
+}
+
+// store stores the page of the entry under the key of its URL and the key of its final URL
+func (p *pageCache) store(entry *pageEntry, page *fetchedPage, finalKey string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	defer close(entry.ready)
+
+	// the next lookup fetches failed pages, pages which must not be stored and pages bigger than the limit again
+	if page == nil || noStore(page.header) || int64(len(page.data)) > p.limit {
+		for _, key := range entry.keys {
+			delete(p.entries, key)
+		}
+
+		return
+	}
+
+	entry.page = page
+
+	if _, ok := p.entries[finalKey]; !ok {
+		p.entries[finalKey] = entry
+		entry.keys = append(entry.keys, finalKey)
+	}
+
+	p.cached = append(p.cached, entry)
+	p.size += int64(len(page.data))
+
+	// the oldest pages are removed first
+	for p.size > p.limit {
+		oldest := p.cached[0]
+		p.cached = p.cached[1:]
+		p.size -= int64(len(oldest.page.data))
+
+		for _, key := range oldest.keys {
+			if p.entries[key] == oldest {
+				delete(p.entries, key)
+			}
+		}
+	}
+}
+
+// Reset removes all cached pages
+func (p *pageCache) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, entry := range p.cached {
+		for _, key := range entry.keys {
+			if p.entries[key] == entry {
+				delete(p.entries, key)
+			}
+		}
+	}
+
+	p.cached = nil
+	p.size = 0
+}
+
+// noStore returns true if the Cache-Control header of the response forbids storing the page
+func noStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,300 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// RobotsAgent is the user agent token of the crawler in robots.txt files
+const RobotsAgent = "feedme"
+
+// robotsTimeout is the timeout of fetching a robots.txt file
+const robotsTimeout = 5 * time.Second
+
+// robotsMaxBody is the max size of a robots.txt file, bigger files are truncated
+const robotsMaxBody = 512 * 1024
+
+// ErrDisallowed is returned if the robots.txt of a site disallows fetching the page of a feed
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRule represents an Allow or Disallow rule of a robots.txt file
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+func (r robotsRule) String() string {
+	if r.allow {
+		return "Allow: " + r.path
+	}
+
+	return "Disallow: " + r.path
+}
+
+// robotsRules holds the rules of a robots.txt file which apply to the crawler
+type robotsRules []robotsRule
+
+// robotsEntry is an entry of the robots.txt cache which is ready once the robots.txt is loaded
+type robotsEntry struct {
+	ready   chan struct{}
+	expires time.Time
+	rules   robotsRules
+}
+
+// robotsCache caches the rules of the robots.txt files by their origin for the robots TTL
+type robotsCache struct {
+	lock    sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]*robotsEntry),
+	}
+}
+
+// parseRobots parses the groups of a robots.txt file and returns the rules of the group of the agent or, if there is none, of the group for all agents
+func parseRobots(content string, agent string) robotsRules {
+	var specific, all robotsRules
+	matched := false
+
+	// consecutive user-agent lines start one group
+	inAgents := false
+	inSpecific, inAll := false, false
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i == -1 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				inSpecific, inAll = false, false
+			}
+			inAgents = true
+
+			if v := strings.ToLower(value); v == agent {
+				inSpecific = true
+				matched = true
+			} else if v == "*" {
+				inAll = true
+			}
+		case "allow", "disallow":
+			inAgents = false
+
+			// an empty disallow rule allows everything
+			if value == "" {
+				continue
+			}
+
+			rule := robotsRule{
+				allow: key == "allow",
+				path:  value,
+			}
+			if inSpecific {
+				specific = append(specific, rule)
+			}
+			if inAll {
+				all = append(all, rule)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	if matched {
+		return specific
+	}
+
+	return all
+}
+
+// allowed returns if the path, which includes the query, may be fetched
+func (r robotsRules) allowed(path string) (bool, robotsRule) {
+	var match *robotsRule
+
+	for i := range r {
+		rule := &r[i]
+
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+
+		// the longest matching rule decides, Allow rules win over Disallow rules of the same length
+		if match == nil || len(rule.path) > len(match.path) || (len(rule.path) == len(match.path) && rule.allow) {
+			match = rule
+		}
+	}
+
+	if match == nil || match.allow {
+		return true, robotsRule{}
+	}
+
+	return false, *match
+}
+
+// robotsMatch returns if the path matches the pattern of a rule
+func robotsMatch(pattern string, path string) bool {
+	// patterns match path prefixes, * matches any characters and a trailing $ anchors the pattern at the end of the path
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if len(parts) == 1 {
+		return !anchored || path == parts[0]
+	}
+
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+
+		j := strings.Index(rest, part)
+		if j == -1 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+
+	return true
+}
+
+// checkRobots returns an error wrapping ErrDisallowed if the robots.txt of the site of the URL disallows fetching it
+func (c *Crawler) checkRobots(ctx context.Context, client *http.Client, rawURL string, log *slog.Logger) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	rules := c.robotsRules(ctx, client, u.Scheme+"://"+u.Host, log)
+
+	if ok, rule := rules.allowed(u.RequestURI()); !ok {
+		return fmt.Errorf("%s is %w with the rule %q", rawURL, ErrDisallowed, rule.String())
+	}
+
+	return nil
+}
+
+// robotsRules returns the rules of the robots.txt of the origin
+func (c *Crawler) robotsRules(ctx context.Context, client *http.Client, origin string, log *slog.Logger) robotsRules {
+	c.robots.lock.Lock()
+	entry, ok := c.robots.entries[origin]
+	if !ok || time.Now().After(entry.expires) {
+		ok = false
+		entry = &robotsEntry{
+			ready:   make(chan struct{}),
+			expires: time.Now().Add(c.options.RobotsTTL),
+		}
+		c.robots.entries[origin] = entry
+	}
+	c.robots.lock.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+			return entry.rules
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	defer close(entry.ready)
+
+	// test runs have no backend
+	if c.db != nil {
+		// stored robots.txt files are only fetched again after the TTL
+		stored, err := c.db.FindRobotsFile(ctx, origin)
+		if err == nil && time.Since(stored.Fetched) < c.options.RobotsTTL {
+			entry.rules = parseRobots(stored.Content, RobotsAgent)
+
+			return entry.rules
+		} else if err != nil && !errors.Is(err, backend.ErrNotFound) {
+			log.Warn("cannot load robots.txt from database", "origin", origin, "error", err)
+		}
+	}
+
+	content, err := fetchRobots(ctx, client, origin)
+	if err != nil {
+		// robots.txt files which cannot be fetched allow everything
+		log.Warn("cannot fetch robots.txt", "origin", origin, "error", err)
+
+		return nil
+	}
+
+	log.Debug("fetched robots.txt", "origin", origin)
+
+	entry.rules = parseRobots(content, RobotsAgent)
+
+	if c.db != nil {
+		err = c.db.UpdateRobotsFile(ctx, &feedme.RobotsFile{
+			Origin:  origin,
+			Content: content,
+			Fetched: time.Now(),
+		})
+		if err != nil {
+			log.Warn("cannot store robots.txt in database", "origin", origin, "error", err)
+		}
+	}
+
+	return entry.rules
+}
+
+// fetchRobots fetches the robots.txt of the origin
+func fetchRobots(ctx context.Context, client *http.Client, origin string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, robotsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := doRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	// missing robots.txt files allow everything
+	if res.StatusCode >= 400 && res.StatusCode < 500 {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+
+		return "", nil
+	} else if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, robotsMaxBody))
+	if err != nil {
+		return "", fmt.Errorf("cannot read response: %s", err.Error())
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// SanitizeOff stores descriptions unchanged
+	SanitizeOff = "off"
+	// SanitizeRelaxed keeps basic formatting, links and images of descriptions
+	SanitizeRelaxed = "relaxed"
+	// SanitizeStrict reduces descriptions to their text
+	SanitizeStrict = "strict"
+)
+
+// relaxedElements holds the elements and their attributes which are kept by the relaxed sanitizer
+var relaxedElements = map[string][]string{
+	"a":          {"href", "title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"code":       nil,
+	"em":         nil,
+	"i":          nil,
+	"img":        {"src", "srcset", "alt", "title", "width", "height"},
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"pre":        nil,
+	"strong":     nil,
+	"ul":         nil,
+}
+
+// droppedElements holds the elements which are removed together with their contents
+var droppedElements = map[string]bool{
+	"embed":    true,
+	"head":     true,
+	"iframe":   true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"select":   true,
+	"style":    true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+}
+
+// blockElements holds the elements which are separated by line breaks by the strict sanitizer
+var blockElements = map[string]bool{
+	"blockquote": true,
+	"br":         true,
+	"div":        true,
+	"h1":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+	"li":         true,
+	"p":          true,
+	"pre":        true,
+	"tr":         true,
+}
+
+// voidElements holds the elements which have no end tag
+var voidElements = map[string]bool{
+	"br":    true,
+	"embed": true,
+	"img":   true,
+}
+
+// sanitizeHTML removes everything from the HTML which could run in the browser of a reader, e.g. scripts and event handlers
+func sanitizeHTML(value string, mode string) string {
+	// values without markup cannot run anything
+	if mode == SanitizeOff || !strings.Contains(value, "<") {
+		return value
+	}
+
+	var out strings.Builder
+
+	// depth of the currently open dropped elements
+	dropped := 0
+
+	z := html.NewTokenizer(strings.NewReader(value))
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			return strings.TrimSpace(out.String())
+		case html.TextToken:
+			if dropped == 0 {
+				out.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+
+			if droppedElements[token.Data] {
+				if tt == html.StartTagToken && !voidElements[token.Data] {
+					dropped++
+				}
+
+				continue
+			} else if dropped != 0 {
+				continue
+			} else if mode == SanitizeStrict {
+				if blockElements[token.Data] {
+					lineBreak(&out)
+				}
+
+				continue
+			}
+
+			attributes, ok := relaxedElements[token.Data]
+			if !ok {
+				continue
+			}
+
+			out.WriteString("<" + token.Data)
+			for _, a := range token.Attr {
+				if a.Namespace == "" && allowedAttribute(a, attributes) {
+					out.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+				}
+			}
+			out.WriteString(">")
+		case html.EndTagToken:
+			token := z.Token()
+
+			if droppedElements[token.Data] {
+				if dropped != 0 {
+					dropped--
+				}
+
+				continue
+			} else if dropped != 0 {
+				continue
+			} else if mode == SanitizeStrict {
+				if blockElements[token.Data] {
+					lineBreak(&out)
+				}
+
+				continue
+			}
+
+			if _, ok := relaxedElements[token.Data]; ok && !voidElements[token.Data] {
+				out.WriteString("</" + token.Data + ">")
+			}
+		}
+	}
+}
+
+// lineBreak ends the current line of the output if it is not empty
+func lineBreak(out *strings.Builder) {
+	if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// allowedAttribute returns if the attribute is one of the allowed attributes and, for links and images, if its URLs are safe
+func allowedAttribute(a html.Attribute, allowed []string) bool {
+	known := false
+	for _, name := range allowed {
+		if a.Key == name {
+			known = true
+
+			break
+		}
+	}
+	if !known {
+		return false
+	}
+
+	switch a.Key {
+	case "href", "src":
+		return safeURL(a.Val, a.Key == "href")
+	case "srcset":
+		for _, candidate := range strings.Split(a.Val, ",") {
+			if fields := strings.Fields(candidate); len(fields) != 0 && !safeURL(fields[0], false) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// safeURL returns if the URL is relative or uses the http or https scheme
+func safeURL(value string, link bool) bool {
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return true
+	// links may also use the mailto scheme
+	case "mailto":
+		return link
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// snapshotTimeFormat is the format of the file names of snapshots which sort by their times
+const snapshotTimeFormat = "20060102T150405.000Z"
+
+// snapshotMetaExtension is the extension of the sidecar of a snapshot
+const snapshotMetaExtension = ".meta.json"
+
+// snapshotExtensions maps the sources of transforms to the extensions of their snapshots
+var snapshotExtensions = map[string]string{
+	"feed": ".xml",
+	"html": ".html",
+	"json": ".json",
+}
+
+// fetchedPage holds the fetched page of a feed for its snapshot and its fixture
+type fetchedPage struct {
+	data       []byte
+	header     http.Header
+	requestURL string
+	url        string
+	status     int
+	source     string
+}
+
+// snapshotMeta represents the sidecar of a snapshot
+type snapshotMeta struct {
+	Feed     string      `json:"feed"`
+	URL      string      `json:"url"`
+	FinalURL string      `json:"final_url"`
+	Status   int         `json:"status"`
+	Headers  http.Header `json:"headers"`
+	Error    string      `json:"error,omitempty"`
+	Fetched  time.Time   `json:"fetched"`
+}
+
+// writeSnapshot writes the fetched page of the feed with a sidecar into the snapshot directory and returns the file of the page
+func (c *Crawler) writeSnapshot(feed *feedme.Feed, page *fetchedPage, crawlErr error) (string, error) {
+	dir := filepath.Join(c.options.SnapshotDir, feedDirName(feed.Name))
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	name := now.Format(snapshotTimeFormat)
+
+	ext, ok := snapshotExtensions[page.source]
+	if !ok {
+		ext = ".html"
+	}
+	file := filepath.Join(dir, name+ext)
+
+	err = ioutil.WriteFile(file, page.data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	meta := snapshotMeta{
+		Feed:     feed.Name,
+		URL:      feed.URL,
+		FinalURL: page.url,
+		Status:   page.status,
+		Headers:  redactHeader(page.header),
+		Fetched:  now,
+	}
+	if crawlErr != nil {
+		meta.Error = crawlErr.Error()
+	}
+
+	data, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("cannot encode snapshot sidecar: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, name+snapshotMetaExtension), append(data, '\n'), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	// the oldest snapshots beyond the snapshot count of the options are removed
+	if c.options.SnapshotKeep > 0 {
+		err = pruneSnapshots(dir, c.options.SnapshotKeep)
+		if err != nil {
+			return "", fmt.Errorf("cannot prune snapshots: %s", err.Error())
+		}
+	}
+
+	return file, nil
+}
+
+// feedDirName returns the escaped name of the feed as directory name
+func feedDirName(feed string) string {
+	name := url.PathEscape(feed)
+
+	// names like .. must not leave the parent directory
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+
+	return name
+}
+
+// redactHeader returns a copy of the response header without the values of cookies which can hold the sessions of logins
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+
+	for i := range redacted["Set-Cookie"] {
+		redacted["Set-Cookie"][i] = "redacted"
+	}
+
+	return redacted
+}
+
+// pruneSnapshots removes the oldest snapshots of the directory of a feed so that the given count of snapshots is kept
+func pruneSnapshots(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// the files of a snapshot share its time as name
+	files := make(map[string][]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		snapshot := strings.TrimSuffix(name, snapshotMetaExtension)
+		if snapshot == name {
+			snapshot = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		if _, err := time.Parse(snapshotTimeFormat, snapshot); err != nil {
+			continue
+		}
+
+		files[snapshot] = append(files[snapshot], name)
+	}
+
+	if len(files) <= keep {
+		return nil
+	}
+
+	snapshots := make([]string, 0, len(files))
+	for snapshot := range files {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Strings(snapshots)
+
+	for _, snapshot := range snapshots[:len(snapshots)-keep] {
+		for _, name := range files[snapshot] {
+			err = os.Remove(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
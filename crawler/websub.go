@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// websubRetryDelay is the delay before a failed ping of the WebSub hub is retried once
+const websubRetryDelay = time.Second
+
+// websubTopics returns the URLs of the Atom and RSS feeds of the feed on the feedme server with the base URL which are the WebSub topics of the feed
+func websubTopics(baseURL string, feed *feedme.Feed) []string {
+	base := strings.TrimRight(baseURL, "/") + "/" + url.PathEscape(feed.Name) + "/"
+
+	return []string{
+		base + "atom",
+		base + "rss",
+	}
+}
+
+// publish pings the WebSub hub of the options about the changed topics of the feed
+func (c *Crawler) publish(ctx context.Context, feed *feedme.Feed, log *slog.Logger) {
+	// the hub cannot read private feeds
+	if c.options.WebSubHub == "" || c.options.WebSubBaseURL == "" || feed.Private() {
+		return
+	}
+
+	for _, topic := range websubTopics(c.options.WebSubBaseURL, feed) {
+		err := c.publishOnce(ctx, topic)
+		if err != nil {
+			log.Debug("retry WebSub ping", "hub", c.options.WebSubHub, "topic", topic, "backoff", websubRetryDelay, "error", err)
+
+			if err = sleep(ctx, websubRetryDelay); err == nil {
+				err = c.publishOnce(ctx, topic)
+			}
+		}
+		if err != nil {
+			log.Warn("cannot ping WebSub hub", "hub", c.options.WebSubHub, "topic", topic, "error", err)
+
+			continue
+		}
+
+		log.Debug("pinged WebSub hub", "hub", c.options.WebSubHub, "topic", topic)
+	}
+}
+
+// publishOnce posts the publish ping of the topic to the WebSub hub
+func (c *Crawler) publishOnce(ctx context.Context, topic string) error {
+	form := url.Values{
+		"hub.mode": {"publish"},
+		"hub.url":  {topic},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.options.WebSubHub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := c.notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package feedme
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zimmski/feeds"
+)
+
+var reProtocol = regexp.MustCompile(`[a-zA-Z0-9+\-.]+://`)
+
+// BaseURL returns the URL which relative item URIs of the feed are resolved against
+func (f *Feed) BaseURL() string {
+	if !f.HideSource {
+		return f.URL
+	}
+
+	// the path and the query of a hidden source may hold a private token, its origin and the site URL do not
+	if f.SiteURL != "" {
+		return f.SiteURL
+	}
+
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// ResolveURI returns the absolute URI of an item URI relative to the base URL of the feed
+func (f *Feed) ResolveURI(uri string) (string, error) {
+	if reProtocol.MatchString(uri) {
+		return uri, nil
+	}
+
+	u, err := url.Parse(f.BaseURL())
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = ""
+	feedURL := u.String()
+	if !strings.HasSuffix(feedURL, "/") {
+		feedURL += "/"
+	}
+	u.Path = ""
+	feedURLWithoutPath := u.String()
+
+	// protocol-relative URIs keep their host and use the scheme of the feed
+	if strings.HasPrefix(uri, "//") {
+		return fmt.Sprintf("%s:%s", u.Scheme, uri), nil
+	}
+
+	if uri != "" && uri[0] == '/' {
+		return fmt.Sprintf("%s%s", feedURLWithoutPath, uri), nil
+	}
+
+	return fmt.Sprintf("%s%s", feedURL, uri), nil
+}
+
+// Feeder creates a feed generator for the given items of the feed
+func (f *Feed) Feeder(items []Item) (*feeds.Feed, error) {
+	feeder := &feeds.Feed{
+		Title:       f.Title(),
+		Link:        &feeds.Link{Href: f.Link()},
+		Description: f.Description,
+	}
+
+	for _, i := range items {
+		if feeder.Updated.IsZero() || feeder.Updated.Before(i.Modified()) {
+			feeder.Updated = i.Modified()
+		}
+
+		link, err := f.ResolveURI(i.URI)
+		if err != nil {
+			return nil, err
+		}
+
+		id := i.GUID
+		if id == "" {
+			id = strconv.Itoa(i.ID)
+		}
+
+		// GUIDs are hashes or values of the transform but no links
+		item := &feeds.Item{
+			Id:          id,
+			IsPermaLink: "false",
+			Title:       i.Title,
+			Link:        &feeds.Link{Href: link},
+			Description: i.Description,
+			Created:     i.Created,
+		}
+		if i.Updated != nil {
+			item.Updated = *i.Updated
+		}
+
+		if i.Author != "" {
+			item.Author = &feeds.Author{Name: i.Author}
+		}
+
+		if i.Enclosure.URL != "" {
+			enclosure, err := f.ResolveURI(i.Enclosure.URL)
+			if err != nil {
+				return nil, err
+			}
+
+			typ := i.Enclosure.Type
+			if typ == "" {
+				typ = "application/octet-stream"
+			}
+
+			item.Enclosure = &feeds.Enclosure{
+				Url:    enclosure,
+				Type:   typ,
+				Length: strconv.FormatInt(i.Enclosure.Length, 10),
+			}
+		}
+
+		feeder.Add(item)
+	}
+
+	return feeder, nil
+}
+
+// FeedLink is a link of a generated feed, e.g. to its WebSub hub
+type FeedLink struct {
+	Rel  string
+	Href string
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type rssItem struct {
+	*feeds.RssItem
+	Categories []string `xml:"category"`
+}
+
+type rssChannel struct {
+	*feeds.RssFeed
+	AtomLinks []rssAtomLink `xml:"atom:link"`
+	Items     []*rssItem    `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName          xml.Name    `xml:"rss"`
+	Version          string      `xml:"version,attr"`
+	ContentNamespace string      `xml:"xmlns:content,attr"`
+	AtomNamespace    string      `xml:"xmlns:atom,attr,omitempty"`
+	Channel          *rssChannel `xml:"channel"`
+}
+
+func (r *rssFeed) FeedXml() interface{} {
+	return r
+}
+
+// Rss returns the RSS representation of the given items of the feed
+func (f *Feed) Rss(items []Item, links ...FeedLink) (string, error) {
+	feeder, err := f.Feeder(items)
+	if err != nil {
+		return "", err
+	}
+
+	rss := (&feeds.Rss{Feed: feeder}).RssFeed()
+	rss.Language = f.Language
+
+	channel := &rssChannel{
+		RssFeed: rss,
+	}
+
+	for i, item := range rss.Items {
+		channel.Items = append(channel.Items, &rssItem{
+			RssItem:    item,
+			Categories: items[i].Categories,
+		})
+	}
+
+	r := &rssFeed{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		Channel:          channel,
+	}
+
+	// RSS has no links of its own
+	if len(links) != 0 {
+		r.AtomNamespace = "http://www.w3.org/2005/Atom"
+
+		for _, link := range links {
+			l := rssAtomLink{
+				Href: link.Href,
+				Rel:  link.Rel,
+			}
+			if link.Rel == "self" {
+				l.Type = "application/rss+xml"
+			}
+
+			channel.AtomLinks = append(channel.AtomLinks, l)
+		}
+	}
+
+	return feeds.ToXML(r)
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	*feeds.AtomEntry
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomFeed struct {
+	*feeds.AtomFeed
+	Lang string `xml:"xml:lang,attr,omitempty"`
+	// Links replaces the single link of the embedded feed if there are additional links
+	Links   []feeds.AtomLink
+	Entries []*atomEntry `xml:"entry"`
+}
+
+func (a *atomFeed) FeedXml() interface{} {
+	return a
+}
+
+// Atom returns the Atom representation of the given items of the feed with the additional links
+func (f *Feed) Atom(items []Item, links ...FeedLink) (string, error) {
+	feeder, err := f.Feeder(items)
+	if err != nil {
+		return "", err
+	}
+
+	atom := (&feeds.Atom{Feed: feeder}).AtomFeed()
+	// the ID must not change with the site URL
+	atom.Id = f.URL
+	if f.HideSource {
+		atom.Id = "urn:feedme:" + url.PathEscape(f.Name)
+	}
+
+	feed := &atomFeed{
+		AtomFeed: atom,
+		Lang:     f.Language,
+	}
+	if len(links) != 0 {
+		if atom.Link != nil {
+			feed.Links = append(feed.Links, *atom.Link)
+			atom.Link = nil
+		}
+
+		for _, link := range links {
+			l := feeds.AtomLink{
+				Href: link.Href,
+				Rel:  link.Rel,
+			}
+			if link.Rel == "self" {
+				l.Type = "application/atom+xml"
+			}
+
+			feed.Links = append(feed.Links, l)
+		}
+	}
+
+	for i, entry := range atom.Entries {
+		e := &atomEntry{
+			AtomEntry: entry,
+		}
+		// IDs of Atom entries must be IRIs
+		e.Id = "urn:feedme:" + url.PathEscape(f.Name) + ":" + url.PathEscape(entry.Id)
+
+		for _, category := range items[i].Categories {
+			e.Categories = append(e.Categories, atomCategory{Term: category})
+		}
+
+		// the length of enclosures is optional in Atom, so unknown lengths are left out
+		for j := range e.Links {
+			if e.Links[j].Rel == "enclosure" && e.Links[j].Length == "0" {
+				e.Links[j].Length = ""
+			}
+		}
+
+		feed.Entries = append(feed.Entries, e)
+	}
+
+	return feeds.ToXML(feed)
+}
@@ -0,0 +1,129 @@
+package feedme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveURI(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		feedURL  string
+		uri      string
+		expected string
+	}{
+		{"absolute", "http://example.com/news", "https://other.com/a", "https://other.com/a"},
+		{"absolute of other protocol", "http://example.com/news", "ftp://other.com/a", "ftp://other.com/a"},
+		{"root relative", "http://example.com/news/latest", "/article/1", "http://example.com/article/1"},
+		{"relative", "http://example.com/news", "article/1", "http://example.com/news/article/1"},
+		{"nested relative", "http://example.com/news/", "2024/01/article/1", "http://example.com/news/2024/01/article/1"},
+		{"nested relative of nested feed", "http://example.com/blog/news", "2024/article", "http://example.com/blog/news/2024/article"},
+		{"relative with query", "http://example.com/news?page=2", "article?id=1", "http://example.com/news/article?id=1"},
+		{"root relative with query", "http://example.com/news?page=2", "/article?id=1", "http://example.com/article?id=1"},
+		{"protocol relative", "https://example.com/news", "//cdn.example.com/images/1.png", "https://cdn.example.com/images/1.png"},
+		{"protocol relative of http feed", "http://example.com/news", "//cdn.example.com/a", "http://cdn.example.com/a"},
+		{"empty", "http://example.com/news", "", "http://example.com/news/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			feed := &Feed{
+				URL: tc.feedURL,
+			}
+
+			uri, err := feed.ResolveURI(tc.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if uri != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, uri)
+			}
+		})
+	}
+}
+
+func TestResolveURIHiddenSource(t *testing.T) {
+	const source = "https://example.com/private/feed?token=secret"
+
+	for _, tc := range []struct {
+		name     string
+		siteURL  string
+		uri      string
+		expected string
+	}{
+		{"root relative", "", "/article/1", "https://example.com/article/1"},
+		{"relative", "", "article/1", "https://example.com/article/1"},
+		{"empty", "", "", "https://example.com/"},
+		{"protocol relative", "", "//cdn.example.com/a", "https://cdn.example.com/a"},
+		{"absolute", "", "https://example.com/private/article", "https://example.com/private/article"},
+		{"relative of site URL", "https://blog.example.com/news/", "article/1", "https://blog.example.com/news/article/1"},
+		{"root relative of site URL", "https://blog.example.com/news/", "/article/1", "https://blog.example.com/article/1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			feed := &Feed{
+				URL:        source,
+				SiteURL:    tc.siteURL,
+				HideSource: true,
+			}
+
+			uri, err := feed.ResolveURI(tc.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if uri != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, uri)
+			}
+		})
+	}
+}
+
+func TestResolveURIInvalidFeedURL(t *testing.T) {
+	feed := &Feed{
+		URL: "http://example.com/%zz",
+	}
+
+	_, err := feed.ResolveURI("article")
+	if err == nil {
+		t.Fatal("expected an error for the invalid URL of the feed")
+	}
+}
+
+func TestFeedItemIDs(t *testing.T) {
+	feed := &Feed{
+		Name: "news feed",
+		URL:  "http://example.com/news",
+	}
+	items := []Item{
+		{ID: 1, GUID: "0123456789abcdef0123456789abcdef", Title: "Hashed", URI: "/a"},
+		{ID: 2, GUID: "post/2?x=1", Title: "Template", URI: "/b"},
+		{ID: 3, Title: "Without GUID", URI: "/c"},
+	}
+
+	rss, err := feed.Rss(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<guid isPermaLink="false">0123456789abcdef0123456789abcdef</guid>`,
+		`<guid isPermaLink="false">post/2?x=1</guid>`,
+		`<guid isPermaLink="false">3</guid>`,
+	} {
+		if !strings.Contains(rss, expected) {
+			t.Errorf("expected the RSS guid %s, got %s", expected, rss)
+		}
+	}
+
+	atom, err := feed.Atom(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<id>urn:feedme:news%20feed:0123456789abcdef0123456789abcdef</id>",
+		"<id>urn:feedme:news%20feed:post%2F2%3Fx=1</id>",
+		"<id>urn:feedme:news%20feed:3</id>",
+	} {
+		if !strings.Contains(atom, expected) {
+			t.Errorf("expected the Atom ID %s, got %s", expected, atom)
+		}
+	}
+}
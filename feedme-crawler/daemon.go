@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/crawler"
+	"github.com/zimmski/feedme/transform"
+)
+
+// daemonMaxSleep is the max time the daemon sleeps between cycles
+const daemonMaxSleep = time.Minute
+
+// restartOptions holds the long names of the arguments which cannot be changed by reloading the config
+var restartOptions = []string{"backend", "conn-max-idle-time", "conn-max-lifetime", "daemon", "db-connect-backoff", "db-connect-retries", "db-copy-threshold", "log-file", "log-format", "log-level", "max-idle-conns", "max-open-conns", "spec", "threads", "verbose"}
+
+// runDaemon crawls the feeds of the database whenever they are due until SIGINT or SIGTERM is received
+func runDaemon(ctx context.Context) int {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	// failures holds the times of the last failed crawls of feeds which are retried at their next run after the failure
+	failures := make(map[string]time.Time)
+
+	logger.Info("started daemon", "workers", opts.Workers)
+
+	for {
+		// the feeds are searched again by every cycle so that added and changed feeds are picked up without a restart
+		next, err := runCycle(ctx, failures)
+		if err != nil {
+			logger.Error("cannot run cycle", "error", err)
+
+			next = time.Now().Add(daemonMaxSleep)
+		}
+
+		wait := time.Until(next)
+		// jumps of the wall clock delay due feeds by at most the max sleep
+		if wait > daemonMaxSleep {
+			wait = daemonMaxSleep
+		}
+
+		if wait > 0 {
+			logger.Debug("waiting for the next due feed", "next", next.Format(time.RFC3339))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("stopped daemon")
+
+			return ReturnOk
+		case <-reload:
+			reloadConfig()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runCycle crawls the due feeds with the workers and returns the time of the next due feed
+func runCycle(ctx context.Context, failures map[string]time.Time) (time.Time, error) {
+	feeds, err := db.SearchFeeds(ctx, opts.Feeds, opts.Category, opts.IncludeDisabled)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	next := now.Add(daemonMaxSleep)
+
+	var due []feedme.Feed
+	for _, feed := range feeds {
+		run := nextRun(&feed, failures[feed.Name], now)
+		if !run.After(now) {
+			due = append(due, feed)
+		} else if run.Before(next) {
+			next = run
+		}
+	}
+
+	if len(due) == 0 {
+		return next, nil
+	}
+
+	// cycles must not overlap with other runs as they would fetch and store the same feeds
+	unlock, err := db.LockCrawler(ctx, opts.WaitForLock)
+	if errors.Is(err, backend.ErrLocked) {
+		logger.Warn("another crawler is running, skipping the cycle", "waited", opts.WaitForLock)
+
+		return now.Add(daemonMaxSleep), nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	logger.Debug("found feeds to crawl", "count", len(due))
+
+	started := time.Now()
+
+	results, dispatched := dispatchFeeds(due, opts.Workers, opts.FailFast, opts.Progress, crawlFeed)
+
+	if opts.MediaDir != "" {
+		removeMedia(ctx)
+	}
+
+	unlock()
+
+	// pages are only cached for one cycle
+	feedCrawler.ResetPageCache()
+
+	for _, result := range results {
+		if result.Err != nil {
+			failures[result.Feed] = started
+		} else {
+			delete(failures, result.Feed)
+		}
+	}
+
+	finishRun(results, len(due)-dispatched, started)
+
+	// the next due feed is found by the search of the next cycle
+	return time.Now(), nil
+}
+
+// nextRun returns the time of the next crawl of the feed by the daemon
+func nextRun(feed *feedme.Feed, failed time.Time, now time.Time) time.Time {
+	f := *feed
+
+	// the interval is only used without a valid schedule
+	if f.Interval <= 0 {
+		f.Interval = int(opts.DaemonInterval / time.Second)
+	}
+	// the last failure of a feed counts as its crawl
+	if !failed.IsZero() && (f.LastCrawled == nil || failed.After(*f.LastCrawled)) {
+		f.LastCrawled = &failed
+	}
+
+	return f.NextRun(now)
+}
+
+// reloadConfig parses the INI config file of --config again and applies its arguments to the following cycles
+func reloadConfig() {
+	if opts.configFile == "" {
+		logger.Warn("cannot reload the config without --config")
+
+		return
+	}
+
+	logger.Info("reloading config", "file", opts.configFile)
+
+	old := opts
+
+	// keys removed from the config fall back to their defaults and the arguments of the command line still take precedence over the config
+	reflect.ValueOf(&opts).Elem().Set(reflect.Zero(reflect.TypeOf(opts)))
+	p := newParser()
+	opts.configFile = old.configFile
+
+	err := flags.NewIniParser(p).ParseFile(old.configFile)
+	if err == nil {
+		// the config was already parsed
+		opts.Config = func(s string) error { return nil }
+
+		_, err = p.ParseArgs(os.Args)
+	}
+	opts.Config = old.Config
+	opts.testFile = old.testFile
+
+	// main derives these arguments after parsing
+	if env := os.Getenv("FEEDMESPEC"); env != "" {
+		opts.Spec = env
+	}
+	if opts.Verbose {
+		opts.LogLevel = "debug"
+	}
+	if opts.Threads == 0 {
+		opts.Threads = runtime.NumCPU()
+	}
+
+	var kept []string
+	// arguments of restartOptions keep their values
+	for _, name := range restartOptions {
+		if restoreOption(&old, name) {
+			kept = append(kept, "--"+name)
+		}
+	}
+
+	if err == nil {
+		err = checkOptions()
+	}
+
+	var options crawler.Options
+	if err == nil {
+		options, err = newCrawlerOptions()
+	}
+
+	if err == nil && opts.SnippetsDir != "" {
+		err = transform.LoadSnippets(opts.SnippetsDir)
+	}
+
+	if err != nil {
+		// invalid configs keep all current arguments
+		opts = old
+
+		logger.Error("cannot reload config, keeping the current arguments", "file", opts.configFile, "error", err)
+
+		return
+	}
+
+	if len(kept) != 0 {
+		logger.Warn("arguments can only be changed by a restart", "arguments", strings.Join(kept, ", "))
+	}
+
+	feedCrawler = crawler.New(db, options)
+
+	changed := changedOptions(&old)
+	if len(changed) == 0 {
+		logger.Info("reloaded config without changes", "file", opts.configFile)
+	} else {
+		logger.Info("reloaded config", "file", opts.configFile, "changed", strings.Join(changed, ", "))
+	}
+}
+
+// restoreOption sets the argument with the long name back to its value of the old arguments and returns true if the value was changed
+func restoreOption(old interface{}, name string) bool {
+	current := reflect.ValueOf(&opts).Elem()
+	previous := reflect.ValueOf(old).Elem()
+
+	for i := 0; i < current.NumField(); i++ {
+		if current.Type().Field(i).Tag.Get("long") != name {
+			continue
+		}
+
+		if reflect.DeepEqual(current.Field(i).Interface(), previous.Field(i).Interface()) {
+			return false
+		}
+
+		current.Field(i).Set(previous.Field(i))
+
+		return true
+	}
+
+	return false
+}
+
+// changedOptions returns the long names of the arguments whose values differ from the old arguments
+func changedOptions(old interface{}) []string {
+	current := reflect.ValueOf(&opts).Elem()
+	previous := reflect.ValueOf(old).Elem()
+
+	var changed []string
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Tag.Get("long")
+		if name == "" || current.Field(i).Kind() == reflect.Func {
+			continue
+		}
+
+		if !reflect.DeepEqual(current.Field(i).Interface(), previous.Field(i).Interface()) {
+			// values are not returned as they can hold secrets like the credentials of --proxy
+			changed = append(changed, "--"+name)
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zimmski/feedme"
+)
+
+// exportItem represents an item of --export-items
+type exportItem struct {
+	Feed        string `json:"feed"`
+	Title       string `json:"title"`
+	URI         string `json:"uri"`
+	Description string `json:"description"`
+	Created     string `json:"created"`
+}
+
+// parseSince parses the --since argument which is either a date or a RFC 3339 time
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// exportItems writes the stored items of the feeds of --feed and --category, or of all feeds, into the file of --out
+func exportItems(ctx context.Context) error {
+	var err error
+	var since time.Time
+
+	if opts.Since != "" {
+		since, err = parseSince(opts.Since)
+		if err != nil {
+			return fmt.Errorf("--since must be a date like 2006-01-02 or a RFC 3339 time")
+		}
+	}
+
+	feeds, err := db.SearchFeeds(ctx, opts.Feeds, opts.Category, true)
+	if err != nil {
+		return fmt.Errorf("cannot search feeds: %s", err.Error())
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Out != "-" {
+		f, err := os.Create(opts.Out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	buffered := bufio.NewWriter(out)
+
+	var write func(item exportItem) error
+	var finish func() error
+
+	switch opts.Format {
+	case "csv":
+		w := csv.NewWriter(buffered)
+
+		err = w.Write([]string{"feed", "title", "uri", "description", "created"})
+		if err != nil {
+			return err
+		}
+
+		write = func(item exportItem) error {
+			return w.Write([]string{item.Feed, item.Title, item.URI, item.Description, item.Created})
+		}
+		finish = func() error {
+			w.Flush()
+
+			return w.Error()
+		}
+	default:
+		count := 0
+
+		write = func(item exportItem) error {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+
+			if count == 0 {
+				buffered.WriteString("[\n\t")
+			} else {
+				buffered.WriteString(",\n\t")
+			}
+			count++
+
+			_, err = buffered.Write(data)
+
+			return err
+		}
+		finish = func() error {
+			if count == 0 {
+				_, err := buffered.WriteString("[]\n")
+
+				return err
+			}
+
+			_, err := buffered.WriteString("\n]\n")
+
+			return err
+		}
+	}
+
+	// the items are streamed feed by feed
+	for i := range feeds {
+		feed := &feeds[i]
+
+		err = db.WalkItems(ctx, feed, since, func(item *feedme.Item) error {
+			uri, err := feed.ResolveURI(item.URI)
+			if err != nil {
+				uri = item.URI
+			}
+
+			return write(exportItem{
+				Feed:        feed.Name,
+				Title:       item.Title,
+				URI:         uri,
+				Description: item.Description,
+				Created:     item.Created.Format(time.RFC3339),
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("cannot export items of feed %s: %s", feed.Name, err.Error())
+		}
+	}
+
+	err = finish()
+	if err != nil {
+		return err
+	}
+
+	return buffered.Flush()
+}
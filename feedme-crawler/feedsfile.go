@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/transform"
+)
+
+// fileFeed represents a feed definition of a feeds file
+type fileFeed struct {
+	Name      string          `json:"name"`
+	URL       string          `json:"url"`
+	Transform json.RawMessage `json:"transform"`
+	Interval  int             `json:"interval,omitempty"`
+	Schedule  string          `json:"schedule,omitempty"`
+	Category  string          `json:"category,omitempty"`
+	Enabled   *bool           `json:"enabled,omitempty"`
+	Token     string          `json:"token,omitempty"`
+
+	DisplayTitle string `json:"display_title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Language     string `json:"language,omitempty"`
+	SiteURL      string `json:"site_url,omitempty"`
+	HideSource   bool   `json:"hide_source,omitempty"`
+}
+
+// readFeedsFile reads the feed definitions of a feeds file and checks that their transforms can be parsed
+func readFeedsFile(file string) ([]feedme.Feed, error) {
+	feeds, err := decodeFeedsFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, feed := range feeds {
+		_, err = transform.Parse(feed.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("feeds[%d] %s: %s", i, feed.Name, err.Error())
+		}
+	}
+
+	return feeds, nil
+}
+
+// decodeFeedsFile reads the feed definitions of a JSON file or, with a .yaml or .yml extension, of a YAML file without checking their transforms
+func decodeFeedsFile(file string) ([]feedme.Feed, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		data, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse YAML: %s", err.Error())
+		}
+	}
+
+	var entries []json.RawMessage
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse feeds: %s", transform.JSONErrorContext(data, err))
+	}
+
+	feeds := make([]feedme.Feed, len(entries))
+	names := make(map[string]bool, len(entries))
+
+	for i, entry := range entries {
+		var f fileFeed
+
+		err = json.Unmarshal(entry, &f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse feeds[%d]: %s", i, err.Error())
+		}
+
+		if f.Name == "" {
+			return nil, fmt.Errorf("feeds[%d] needs a name", i)
+		} else if names[f.Name] {
+			return nil, fmt.Errorf("feeds[%d] %s: name is used more than once", i, f.Name)
+		}
+		names[f.Name] = true
+
+		if f.URL == "" {
+			return nil, fmt.Errorf("feeds[%d] %s: needs an url", i, f.Name)
+		}
+
+		if f.Schedule != "" {
+			_, err = feedme.ParseSchedule(f.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("feeds[%d] %s: %s", i, f.Name, err.Error())
+			}
+		}
+
+		// the transform can be given as nested JSON or as a string
+		definition := bytes.TrimSpace(f.Transform)
+		if len(definition) == 0 {
+			return nil, fmt.Errorf("feeds[%d] %s: needs a transform", i, f.Name)
+		} else if definition[0] == '"' {
+			var s string
+
+			err = json.Unmarshal(definition, &s)
+			if err != nil {
+				return nil, fmt.Errorf("feeds[%d] %s: cannot parse transform: %s", i, f.Name, err.Error())
+			}
+
+			definition = []byte(s)
+		}
+
+		feeds[i] = feedme.Feed{
+			Name:      f.Name,
+			URL:       f.URL,
+			Transform: string(definition),
+			Interval:  f.Interval,
+			Schedule:  f.Schedule,
+			Category:  f.Category,
+			Enabled:   f.Enabled == nil || *f.Enabled,
+			Token:     f.Token,
+
+			DisplayTitle: f.DisplayTitle,
+			Description:  f.Description,
+			Language:     f.Language,
+			SiteURL:      f.SiteURL,
+			HideSource:   f.HideSource,
+		}
+	}
+
+	return feeds, nil
+}
+
+// storeFileFeeds looks up the feeds of a feeds file in the backend, creates missing feeds and returns the feeds which should be crawled
+func storeFileFeeds(ctx context.Context, fileFeeds []feedme.Feed) ([]feedme.Feed, error) {
+	var names map[string]bool
+	if len(opts.Feeds) != 0 {
+		names = make(map[string]bool, len(opts.Feeds))
+
+		for _, name := range opts.Feeds {
+			names[name] = true
+		}
+	}
+
+	now := time.Now()
+	var feeds []feedme.Feed
+
+	for _, feed := range fileFeeds {
+		if names != nil && !names[feed.Name] {
+			continue
+		}
+		if opts.Category != "" && feed.Category != opts.Category {
+			continue
+		}
+
+		stored, err := db.FindFeed(ctx, feed.Name)
+		if err != nil && !errors.Is(err, backend.ErrNotFound) {
+			return nil, fmt.Errorf("cannot search feed %s: %s", feed.Name, err.Error())
+		}
+
+		if err == nil {
+			feed.ID = stored.ID
+			feed.LastCrawled = stored.LastCrawled
+			feed.Enabled = stored.Enabled
+			feed.FailureCount = stored.FailureCount
+			feed.LastError = stored.LastError
+			feed.EmptyRuns = stored.EmptyRuns
+		} else if !opts.DryRun {
+			err = db.CreateFeed(ctx, &feed)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create feed %s: %s", feed.Name, err.Error())
+			}
+		}
+
+		if !opts.Force && names == nil && !feed.Due(now) {
+			continue
+		} else if !feed.Enabled && !opts.IncludeDisabled {
+			continue
+		}
+
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
+
+// exportFeeds writes the definitions of the feeds of --feed and --category, or of all feeds, ordered by name into a feeds file or, with "-" as file, to STDOUT
+func exportFeeds(ctx context.Context, file string) error {
+	feeds, err := db.SearchFeeds(ctx, opts.Feeds, opts.Category, true)
+	if err != nil {
+		return fmt.Errorf("cannot search feeds: %s", err.Error())
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].Name < feeds[j].Name
+	})
+
+	entries := make([]fileFeed, len(feeds))
+	for i, feed := range feeds {
+		// transforms are embedded as JSON objects so that exports diff cleanly
+		definition := json.RawMessage(feed.Transform)
+		if !json.Valid(definition) {
+			definition, err = json.Marshal(feed.Transform)
+			if err != nil {
+				return fmt.Errorf("cannot encode transform of feed %s: %s", feed.Name, err.Error())
+			}
+		}
+
+		entries[i] = fileFeed{
+			Name:      feed.Name,
+			URL:       feed.URL,
+			Transform: definition,
+			Interval:  feed.Interval,
+			Schedule:  feed.Schedule,
+			Category:  feed.Category,
+
+			DisplayTitle: feed.DisplayTitle,
+			Description:  feed.Description,
+			Language:     feed.Language,
+			SiteURL:      feed.SiteURL,
+			HideSource:   feed.HideSource,
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("cannot encode feeds: %s", err.Error())
+	}
+	data = append(data, '\n')
+
+	if file == "-" {
+		_, err = os.Stdout.Write(data)
+
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// importFeeds creates the feeds of a feeds file which are not yet stored and updates stored feeds with the same name
+func importFeeds(ctx context.Context, file string) int {
+	fileFeeds, err := decodeFeedsFile(file)
+	if err != nil {
+		logger.Error("cannot read feeds file", "file", file, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	var created, updated, unchanged, invalid int
+
+	for _, feed := range fileFeeds {
+		// feeds with invalid transforms are reported with all their problems and skipped
+		if problems := transform.Validate(feed.Transform); len(problems) != 0 {
+			invalid++
+
+			for _, problem := range problems {
+				fmt.Printf("invalid %s: %s\n", feed.Name, problem.Error())
+			}
+
+			continue
+		}
+
+		stored, err := db.FindFeed(ctx, feed.Name)
+		if errors.Is(err, backend.ErrNotFound) {
+			if !opts.ImportDryRun {
+				err = db.CreateFeed(ctx, &feed)
+				if err != nil {
+					logger.Error("cannot create feed", "feed", feed.Name, "error", err)
+
+					return ReturnFeedsFileError
+				}
+			}
+
+			created++
+			fmt.Printf("created %s\n", feed.Name)
+
+			continue
+		} else if err != nil {
+			logger.Error("cannot search feed", "feed", feed.Name, "error", err)
+
+			return ReturnFeedsFileError
+		}
+
+		if stored.URL == feed.URL && sameTransform(stored.Transform, feed.Transform) && stored.Interval == feed.Interval && stored.Schedule == feed.Schedule && stored.Category == feed.Category && sameMetadata(stored, &feed) {
+			unchanged++
+			fmt.Printf("unchanged %s\n", feed.Name)
+
+			continue
+		}
+
+		if !opts.ImportDryRun {
+			stored.URL = feed.URL
+			stored.Transform = feed.Transform
+			stored.Interval = feed.Interval
+			stored.Schedule = feed.Schedule
+			stored.Category = feed.Category
+			stored.DisplayTitle = feed.DisplayTitle
+			stored.Description = feed.Description
+			stored.Language = feed.Language
+			stored.SiteURL = feed.SiteURL
+			stored.HideSource = feed.HideSource
+
+			err = db.UpdateFeed(ctx, stored)
+			if err != nil {
+				logger.Error("cannot update feed", "feed", feed.Name, "error", err)
+
+				return ReturnFeedsFileError
+			}
+		}
+
+		updated++
+		fmt.Printf("updated %s\n", feed.Name)
+	}
+
+	fmt.Printf("%d feeds read, %d created, %d updated, %d unchanged, %d invalid\n", len(fileFeeds), created, updated, unchanged, invalid)
+
+	if invalid != 0 {
+		return ReturnInvalidFeeds
+	}
+
+	return ReturnOk
+}
+
+// sameTransform returns if both transforms are equal apart from their formatting
+func sameTransform(a string, b string) bool {
+	var ca, cb bytes.Buffer
+
+	if json.Compact(&ca, []byte(a)) != nil || json.Compact(&cb, []byte(b)) != nil {
+		return a == b
+	}
+
+	return ca.String() == cb.String()
+}
+
+// sameMetadata returns if both feeds have the same display metadata
+func sameMetadata(a *feedme.Feed, b *feedme.Feed) bool {
+	return a.DisplayTitle == b.DisplayTitle && a.Description == b.Description && a.Language == b.Language && a.SiteURL == b.SiteURL && a.HideSource == b.HideSource
+}
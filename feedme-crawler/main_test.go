@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/crawler"
+)
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	os.Exit(m.Run())
+}
+
+// testFeedList returns feeds with the given names
+func testFeedList(names ...string) []feedme.Feed {
+	feeds := make([]feedme.Feed, len(names))
+	for i, name := range names {
+		feeds[i] = feedme.Feed{
+			ID:   i + 1,
+			Name: name,
+		}
+	}
+
+	return feeds
+}
+
+// resultsByFeed returns the results by the names of their feeds
+func resultsByFeed(t *testing.T, results []crawler.Result) map[string]crawler.Result {
+	byFeed := make(map[string]crawler.Result, len(results))
+	for _, result := range results {
+		if _, ok := byFeed[result.Feed]; ok {
+			t.Fatalf("feed %s was processed more than once", result.Feed)
+		}
+
+		byFeed[result.Feed] = result
+	}
+
+	return byFeed
+}
+
+func TestDispatchFeedsPanickingTransform(t *testing.T) {
+	feeds := testFeedList("first", "broken", "last")
+
+	results, dispatched := dispatchFeeds(feeds, 2, false, false, func(feed *feedme.Feed, workerID int) crawler.Result {
+		if feed.Name == "broken" {
+			panic("broken transform")
+		}
+
+		return crawler.Result{
+			Feed: feed.Name,
+		}
+	})
+
+	if dispatched != len(feeds) {
+		t.Fatalf("expected %d dispatched feeds, got %d", len(feeds), dispatched)
+	}
+
+	byFeed := resultsByFeed(t, results)
+	if len(byFeed) != len(feeds) {
+		t.Fatalf("expected results of all %d feeds, got %d", len(feeds), len(byFeed))
+	}
+
+	var panicErr *crawler.PanicError
+	if !errors.As(byFeed["broken"].Err, &panicErr) {
+		t.Fatalf("expected a panic error for the broken feed, got %v", byFeed["broken"].Err)
+	}
+	if panicErr.Value != "broken transform" {
+		t.Errorf("expected the value of the panic, got %v", panicErr.Value)
+	}
+
+	for _, name := range []string{"first", "last"} {
+		if byFeed[name].Err != nil {
+			t.Errorf("expected feed %s to be processed, got %v", name, byFeed[name].Err)
+		}
+	}
+}
+
+func TestDispatchFeedsWorkers(t *testing.T) {
+	for _, tc := range []struct {
+		workers  int
+		expected int
+	}{
+		{workers: 0, expected: 1},
+		{workers: 1, expected: 1},
+		{workers: 4, expected: 4},
+	} {
+		t.Run(fmt.Sprintf("%d workers", tc.workers), func(t *testing.T) {
+			feeds := testFeedList("a", "b", "c", "d", "e", "f", "g", "h", "i", "j")
+
+			var active, maxActive int32
+			var lock sync.Mutex
+			workerIDs := make(map[int]bool)
+
+			// the first feeds wait until the expected count of workers processes feeds at once
+			started := make(chan struct{}, len(feeds))
+			release := make(chan struct{})
+			go func() {
+				defer close(release)
+
+				for i := 0; i < tc.expected; i++ {
+					select {
+					case <-started:
+					case <-time.After(5 * time.Second):
+						return
+					}
+				}
+			}()
+
+			results, dispatched := dispatchFeeds(feeds, tc.workers, false, false, func(feed *feedme.Feed, workerID int) crawler.Result {
+				n := atomic.AddInt32(&active, 1)
+				defer atomic.AddInt32(&active, -1)
+
+				lock.Lock()
+				if n > maxActive {
+					maxActive = n
+				}
+				workerIDs[workerID] = true
+				lock.Unlock()
+
+				started <- struct{}{}
+				<-release
+
+				return crawler.Result{
+					Feed: feed.Name,
+				}
+			})
+
+			if dispatched != len(feeds) {
+				t.Errorf("expected %d dispatched feeds, got %d", len(feeds), dispatched)
+			}
+			if byFeed := resultsByFeed(t, results); len(byFeed) != len(feeds) {
+				t.Errorf("expected results of all %d feeds, got %d", len(feeds), len(byFeed))
+			}
+
+			if maxActive != int32(tc.expected) {
+				t.Errorf("expected %d feeds to be processed at once, got %d", tc.expected, maxActive)
+			}
+			for id := range workerIDs {
+				if id < 0 || id >= tc.expected {
+					t.Errorf("expected worker IDs below %d, got %d", tc.expected, id)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchFeedsFailFast(t *testing.T) {
+	failing := errors.New("failed feed")
+
+	process := func(feed *feedme.Feed, workerID int) crawler.Result {
+		result := crawler.Result{
+			Feed: feed.Name,
+		}
+		if feed.Name == "b" {
+			result.Err = failing
+		}
+
+		return result
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		feeds := testFeedList("a", "b", "c", "d", "e")
+
+		results, dispatched := dispatchFeeds(feeds, 1, true, false, process)
+
+		// the single worker might take the feed after the failed feed before the failure is seen
+		if dispatched < 2 || dispatched > 3 {
+			t.Fatalf("expected 2 or 3 dispatched feeds, got %d", dispatched)
+		}
+		if len(results) != dispatched {
+			t.Fatalf("expected the results of all %d dispatched feeds, got %d", dispatched, len(results))
+		}
+
+		byFeed := resultsByFeed(t, results)
+		if !errors.Is(byFeed["b"].Err, failing) {
+			t.Errorf("expected the failed result of feed b, got %v", byFeed["b"].Err)
+		}
+		for _, name := range []string{"d", "e"} {
+			if _, ok := byFeed[name]; ok {
+				t.Errorf("expected feed %s not to be dispatched after the failure", name)
+			}
+		}
+	})
+
+	t.Run("without fail fast", func(t *testing.T) {
+		feeds := testFeedList("a", "b", "c", "d", "e")
+
+		results, dispatched := dispatchFeeds(feeds, 2, false, false, process)
+
+		if dispatched != len(feeds) || len(results) != len(feeds) {
+			t.Fatalf("expected all %d feeds to be dispatched and processed, got %d and %d", len(feeds), dispatched, len(results))
+		}
+		if !errors.Is(resultsByFeed(t, results)["b"].Err, failing) {
+			t.Errorf("expected the failed result of feed b")
+		}
+	})
+
+	t.Run("no feeds", func(t *testing.T) {
+		results, dispatched := dispatchFeeds(nil, 2, true, false, process)
+
+		if dispatched != 0 || len(results) != 0 {
+			t.Errorf("expected nothing to be dispatched, got %d dispatched feeds and %d results", dispatched, len(results))
+		}
+	})
+}
+
+func TestCheckOptionsThreads(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() {
+		opts = saved
+	})
+
+	// the defaults of the numeric options which checkOptions requires
+	opts.Workers = 1
+	opts.BackfillMaxPages = 1
+	opts.DaemonInterval = time.Hour
+	opts.DBConnectBackoff = time.Second
+
+	for _, tc := range []struct {
+		threads  int
+		expected string
+	}{
+		{threads: -1, expected: "--threads must not be negative"},
+		// 0 uses the CPU count of the system
+		{threads: 0},
+		{threads: 1},
+	} {
+		opts.Threads = tc.threads
+
+		err := checkOptions()
+		if tc.expected == "" && err != nil && strings.Contains(err.Error(), "--threads") {
+			t.Errorf("expected %d threads to be valid, got %v", tc.threads, err)
+		} else if tc.expected != "" && (err == nil || err.Error() != tc.expected) {
+			t.Errorf("expected the error %q for %d threads, got %v", tc.expected, tc.threads, err)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	saved := opts
+	savedArgs := os.Args
+	savedCrawler := feedCrawler
+	t.Cleanup(func() {
+		opts = saved
+		os.Args = savedArgs
+		feedCrawler = savedCrawler
+	})
+
+	config := filepath.Join(t.TempDir(), "feedme.ini")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(config, []byte("[Crawler]\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("workers = 4\ndaemon-interval = 3h\nhttp-retries = 2\n")
+	os.Args = []string{"feedme-crawler", "--backend", "memory", "--config", config, "--daemon-interval", "2h"}
+
+	if _, err := newParser().ParseArgs(os.Args); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Workers != 4 || opts.DaemonInterval != 2*time.Hour || opts.HTTPRetries != 2 {
+		t.Fatalf("expected 4 workers, a daemon interval of 2h and 2 HTTP retries, got %d, %s and %d", opts.Workers, opts.DaemonInterval, opts.HTTPRetries)
+	}
+
+	// the workers are removed and the HTTP retries and the daemon interval are changed
+	writeConfig("daemon-interval = 4h\nhttp-retries = 3\n")
+
+	reloadConfig()
+
+	if opts.Workers != 1 {
+		t.Errorf("expected the removed workers to revert to their default 1, got %d", opts.Workers)
+	}
+	if opts.DaemonInterval != 2*time.Hour {
+		t.Errorf("expected the daemon interval of the command line 2h, got %s", opts.DaemonInterval)
+	}
+	if opts.HTTPRetries != 3 {
+		t.Errorf("expected the reloaded 3 HTTP retries, got %d", opts.HTTPRetries)
+	}
+	if opts.configFile != config {
+		t.Errorf("expected the config file %q, got %q", config, opts.configFile)
+	}
+}
+
+func TestCheckOptionsDBConnectBackoff(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() {
+		opts = saved
+	})
+
+	// the defaults of the numeric options which checkOptions requires
+	opts.Workers = 1
+	opts.BackfillMaxPages = 1
+	opts.DaemonInterval = time.Hour
+
+	for _, tc := range []struct {
+		backoff  time.Duration
+		expected string
+	}{
+		{backoff: -time.Second, expected: "--db-connect-backoff must be positive"},
+		{backoff: 0, expected: "--db-connect-backoff must be positive"},
+		{backoff: time.Millisecond},
+		{backoff: time.Second},
+	} {
+		opts.DBConnectBackoff = tc.backoff
+
+		err := checkOptions()
+		if tc.expected == "" && err != nil && strings.Contains(err.Error(), "--db-connect-backoff") {
+			t.Errorf("expected the backoff %s to be valid, got %v", tc.backoff, err)
+		} else if tc.expected != "" && (err == nil || err.Error() != tc.expected) {
+			t.Errorf("expected the error %q for the backoff %s, got %v", tc.expected, tc.backoff, err)
+		}
+	}
+}
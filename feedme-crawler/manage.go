@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/transform"
+)
+
+// readTransformFile reads the transform file of the feed and returns the exit code if the transform cannot be used
+func readTransformFile(name string, file string) (string, int) {
+	c, err := ioutil.ReadFile(file)
+	if err != nil {
+		logger.Error("cannot read transform file", "file", file, "error", err)
+
+		return "", ReturnFeedsFileError
+	}
+
+	if problems := transform.Validate(string(c)); len(problems) != 0 {
+		// all problems of an invalid transform are listed
+		for _, problem := range problems {
+			fmt.Printf("invalid %s: %s\n", name, problem.Error())
+		}
+
+		return "", ReturnInvalidFeeds
+	}
+
+	return string(c), ReturnOk
+}
+
+// addFeed creates the feed of --add-feed and returns the exit code
+func addFeed(ctx context.Context) int {
+	if opts.URL == "" || opts.TransformFile == "" {
+		logger.Error("--add-feed requires --url and --transform-file")
+
+		return ReturnHelp
+	}
+
+	content, code := readTransformFile(opts.AddFeed, opts.TransformFile)
+	if code != ReturnOk {
+		return code
+	}
+
+	feed := feedme.Feed{
+		Name:      opts.AddFeed,
+		URL:       opts.URL,
+		Transform: content,
+		Category:  opts.Category,
+		Enabled:   true,
+
+		DisplayTitle: opts.DisplayTitle,
+		Description:  opts.Description,
+		Language:     opts.Language,
+		SiteURL:      opts.SiteURL,
+		HideSource:   opts.HideSource,
+	}
+
+	err := db.CreateFeed(ctx, &feed)
+	if err != nil {
+		logger.Error("cannot create feed", "feed", feed.Name, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	fmt.Printf("created %s\n", feed.Name)
+
+	return ReturnOk
+}
+
+// setTransform replaces the transform of the feed of --set-transform and returns the exit code
+func setTransform(ctx context.Context) int {
+	name, file, ok := strings.Cut(opts.SetTransform, "=")
+	if !ok || name == "" || file == "" {
+		logger.Error("--set-transform must be given as name=file")
+
+		return ReturnHelp
+	}
+
+	feed, err := db.FindFeed(ctx, name)
+	if err != nil {
+		logger.Error("cannot find feed", "feed", name, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	content, code := readTransformFile(name, file)
+	if code != ReturnOk {
+		return code
+	}
+
+	feed.Transform = content
+
+	err = db.UpdateFeed(ctx, feed)
+	if err != nil {
+		logger.Error("cannot update feed", "feed", name, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	fmt.Printf("updated %s\n", name)
+
+	return ReturnOk
+}
+
+// setMetadata sets the display metadata of the feed of --set-metadata and returns the exit code
+func setMetadata(ctx context.Context) int {
+	if opts.DisplayTitle == "" && opts.Description == "" && opts.Language == "" && opts.SiteURL == "" {
+		logger.Error("--set-metadata requires --display-title, --description, --language or --site-url")
+
+		return ReturnHelp
+	}
+
+	feed, err := db.FindFeed(ctx, opts.SetMetadata)
+	if err != nil {
+		logger.Error("cannot find feed", "feed", opts.SetMetadata, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	// only the non-empty values are set
+	for _, field := range []struct {
+		value  string
+		stored *string
+	}{
+		{opts.DisplayTitle, &feed.DisplayTitle},
+		{opts.Description, &feed.Description},
+		{opts.Language, &feed.Language},
+		{opts.SiteURL, &feed.SiteURL},
+	} {
+		if field.value != "" {
+			*field.stored = field.value
+		}
+	}
+
+	err = db.UpdateFeed(ctx, feed)
+	if err != nil {
+		logger.Error("cannot update feed", "feed", feed.Name, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	fmt.Printf("updated %s\n", feed.Name)
+
+	return ReturnOk
+}
+
+// deleteFeed deletes the feed of --delete-feed and returns the exit code
+func deleteFeed(ctx context.Context) int {
+	feed, err := db.FindFeed(ctx, opts.DeleteFeed)
+	if err != nil {
+		logger.Error("cannot find feed", "feed", opts.DeleteFeed, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	err = db.DeleteFeed(ctx, feed, opts.KeepItems)
+	if err != nil {
+		logger.Error("cannot delete feed", "feed", feed.Name, "error", err)
+
+		return ReturnFeedsFileError
+	}
+
+	if opts.KeepItems {
+		fmt.Printf("deleted %s keeping its items\n", feed.Name)
+	} else {
+		fmt.Printf("deleted %s\n", feed.Name)
+	}
+
+	if opts.MediaDir != "" {
+		removeMedia(ctx)
+	}
+
+	return ReturnOk
+}
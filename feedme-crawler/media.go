@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zimmski/feedme/crawler"
+)
+
+// mediaPruneAge is the min age of media files which are pruned
+const mediaPruneAge = time.Hour
+
+// removeMedia prunes --media-dir and logs the outcome
+func removeMedia(ctx context.Context) {
+	removed, err := pruneMedia(ctx)
+	if err != nil {
+		// failures do not affect the feeds
+		logger.Error("cannot prune media", "dir", opts.MediaDir, "error", err)
+	} else if removed != 0 {
+		logger.Info("pruned unreferenced media", "dir", opts.MediaDir, "count", removed)
+	}
+}
+
+// pruneMedia removes the files of --media-dir which are not referenced by any item anymore and returns the count of removed files
+func pruneMedia(ctx context.Context) (int, error) {
+	media, err := db.SearchMedia(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	referenced := make(map[string]bool, len(media))
+	for _, m := range media {
+		referenced[m] = true
+	}
+
+	entries, err := os.ReadDir(opts.MediaDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !crawler.IsMediaFile(entry.Name()) || referenced[entry.Name()] {
+			continue
+		}
+
+		info, err := entry.Info()
+		// images which are cached right now, e.g. by a refresh of the server, are not referenced by their items yet
+		if err != nil || time.Since(info.ModTime()) < mediaPruneAge {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(opts.MediaDir, entry.Name()))
+		if err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zimmski/feedme/crawler"
+)
+
+// progressInterval is the interval of the progress lines if STDERR is not a terminal
+const progressInterval = 10 * time.Second
+
+// slowestFeeds is the count of the slowest feeds of the summary
+const slowestFeeds = 10
+
+// progress prints the progress of a run with --progress to STDERR
+type progress struct {
+	out      io.Writer
+	terminal bool
+	width    int
+
+	total   int
+	done    int
+	failed  int
+	started time.Time
+	printed time.Time
+	// running holds the names of the feeds which are processed by the workers
+	running []string
+}
+
+func newProgress(total int, workers int) *progress {
+	p := &progress{
+		out:     os.Stderr,
+		width:   80,
+		total:   total,
+		started: time.Now(),
+		running: make([]string, workers),
+	}
+
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		p.terminal = true
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		p.width = columns
+	}
+
+	return p
+}
+
+// Start records that the worker started processing the feed
+func (p *progress) Start(workerID int, feed string) {
+	p.running[workerID] = feed
+
+	p.Print(false)
+}
+
+// Done records the result of the feed of the worker
+func (p *progress) Done(workerID int, result crawler.Result) {
+	p.running[workerID] = ""
+	p.done++
+	if result.Err != nil {
+		p.failed++
+	}
+
+	p.Print(false)
+}
+
+// Print prints the progress
+func (p *progress) Print(force bool) {
+	// terminals get one line which is updated in place, other lines are only printed after the progressInterval or if forced
+	if !p.terminal && !force && time.Since(p.printed) < progressInterval {
+		return
+	}
+	p.printed = time.Now()
+
+	line := fmt.Sprintf("%d/%d feeds, %d failed, %s elapsed", p.done, p.total, p.failed, time.Since(p.started).Round(time.Second))
+
+	var running []string
+	for id, feed := range p.running {
+		if feed != "" {
+			running = append(running, fmt.Sprintf("%d:%s", id, feed))
+		}
+	}
+	if len(running) != 0 {
+		line += ", running " + strings.Join(running, " ")
+	}
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	if p.terminal {
+		// the line must not wrap as it could not be overwritten anymore
+		if r := []rune(line); len(r) >= p.width {
+			line = string(r[:p.width-1])
+		}
+
+		fmt.Fprintf(p.out, "\r\033[K%s", line)
+	} else {
+		fmt.Fprintln(p.out, line)
+	}
+}
+
+// Finish removes the progress line of terminals or prints the last progress line otherwise
+func (p *progress) Finish() {
+	if !p.terminal {
+		p.Print(true)
+
+		return
+	}
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	fmt.Fprint(p.out, "\r\033[K")
+}
+
+// printSlowest prints the slowest feeds of the results with the times of fetching, transforming and storing
+func printSlowest(results []crawler.Result) {
+	slowest := make([]crawler.Result, len(results))
+	copy(slowest, results)
+
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].Duration > slowest[j].Duration
+	})
+	if len(slowest) > slowestFeeds {
+		slowest = slowest[:slowestFeeds]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "SLOWEST FEED\tDURATION\tFETCH\tTRANSFORM\tSTORE")
+
+	for _, result := range slowest {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.Feed, result.Duration.Round(time.Millisecond), result.FetchDuration.Round(time.Millisecond), result.TransformDuration.Round(time.Millisecond), result.StoreDuration.Round(time.Millisecond))
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zimmski/feedme/crawler"
+)
+
+// report represents the report of a run which is written to --report-file
+type report struct {
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	FeedsProcessed  int       `json:"feeds_processed"`
+	FeedsFailed     int       `json:"feeds_failed"`
+	FeedsSkipped    int       `json:"feeds_skipped"`
+	FeedsEmpty      int       `json:"feeds_empty"`
+	ItemsFound      int       `json:"items_found"`
+	ItemsInserted   int       `json:"items_inserted"`
+
+	Feeds []reportFeed `json:"feeds"`
+}
+
+// reportFeed represents the outcome of one feed of a report
+type reportFeed struct {
+	Feed                 string  `json:"feed"`
+	DurationSeconds      float64 `json:"duration_seconds"`
+	FetchDurationSeconds float64 `json:"fetch_duration_seconds"`
+	HTTPStatus           int     `json:"http_status,omitempty"`
+	ItemsFound           int     `json:"items_found"`
+	ItemsFiltered        int     `json:"items_filtered"`
+	ItemsInserted        int     `json:"items_inserted"`
+	EmptyRuns            int     `json:"empty_runs,omitempty"`
+	Error                string  `json:"error,omitempty"`
+}
+
+// newReport returns the report of the results of a run which started at the given time and skipped the given count of feeds
+func newReport(results []crawler.Result, skipped int, started time.Time) *report {
+	r := &report{
+		Started:        started,
+		Finished:       time.Now(),
+		FeedsProcessed: len(results),
+		FeedsSkipped:   skipped,
+		Feeds:          make([]reportFeed, len(results)),
+	}
+	r.DurationSeconds = r.Finished.Sub(r.Started).Seconds()
+
+	sort.Sort(feedResultsByName(results))
+
+	for i, result := range results {
+		feed := reportFeed{
+			Feed:                 result.Feed,
+			DurationSeconds:      result.Duration.Seconds(),
+			FetchDurationSeconds: result.FetchDuration.Seconds(),
+			HTTPStatus:           result.HTTPStatus,
+			ItemsFound:           result.ItemsFound,
+			ItemsFiltered:        result.ItemsFiltered,
+			ItemsInserted:        result.ItemsInserted,
+			EmptyRuns:            result.EmptyRuns,
+		}
+		if result.Err != nil {
+			feed.Error = result.Err.Error()
+
+			r.FeedsFailed++
+		}
+		if result.EmptyRuns != 0 {
+			r.FeedsEmpty++
+		}
+
+		r.ItemsFound += result.ItemsFound
+		r.ItemsInserted += result.ItemsInserted
+
+		r.Feeds[i] = feed
+	}
+
+	return r
+}
+
+// writeText writes the report as table with one row per feed followed by the totals of the run
+func (r *report) writeText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FEED\tDURATION\tFETCH\tSTATUS\tFOUND\tFILTERED\tNEW\tERROR")
+
+	for _, feed := range r.Feeds {
+		status := "-"
+		if feed.HTTPStatus != 0 {
+			status = fmt.Sprint(feed.HTTPStatus)
+		}
+
+		// only the first line, e.g. without the stack trace of a panic
+		e, _, _ := strings.Cut(feed.Error, "\n")
+		if e == "" && feed.EmptyRuns != 0 {
+			e = fmt.Sprintf("no items in %d consecutive crawls, transform likely broken", feed.EmptyRuns)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", feed.Feed, seconds(feed.DurationSeconds), seconds(feed.FetchDurationSeconds), status, feed.ItemsFound, feed.ItemsFiltered, feed.ItemsInserted, e)
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "\nstarted %s, finished %s after %s\n%d feeds processed, %d failed, %d skipped, %d likely broken, %d items found, %d new\n", r.Started.Format(time.RFC3339), r.Finished.Format(time.RFC3339), seconds(r.DurationSeconds), r.FeedsProcessed, r.FeedsFailed, r.FeedsSkipped, r.FeedsEmpty, r.ItemsFound, r.ItemsInserted)
+
+	return err
+}
+
+// seconds formats seconds as duration rounded to milliseconds
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+}
+
+// writeReport writes the report of the run into the file of --report-file in the format of --report-format
+func writeReport(results []crawler.Result, skipped int, started time.Time) error {
+	r := newReport(results, skipped, started)
+
+	// readers must never see a partial report
+	tmp, err := os.CreateTemp(filepath.Dir(opts.ReportFile), "."+filepath.Base(opts.ReportFile)+".")
+	if err != nil {
+		return err
+	}
+
+	switch opts.ReportFormat {
+	case "text":
+		err = r.writeText(tmp)
+	default:
+		var data []byte
+		data, err = json.MarshalIndent(r, "", "\t")
+		if err == nil {
+			_, err = tmp.Write(append(data, '\n'))
+		}
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), opts.ReportFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zimmski/feedme/backend"
+)
+
+// feedStats represents the stats of a feed of --stats
+type feedStats struct {
+	Feed        string     `json:"feed"`
+	Enabled     bool       `json:"enabled"`
+	Items       int        `json:"items"`
+	RecentItems int        `json:"recent_items"`
+	NewestItem  *time.Time `json:"newest_item,omitempty"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastStatus  string     `json:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// printStats prints the item counts, the newest item and the last crawl run of the feeds of --feed and --category, or of all feeds, ordered by name in the format of --format to STDOUT
+func printStats(ctx context.Context) error {
+	feeds, err := db.SearchFeeds(ctx, opts.Feeds, opts.Category, true)
+	if err != nil {
+		return fmt.Errorf("cannot search feeds: %s", err.Error())
+	}
+
+	stats, err := db.FeedStats(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot query stats: %s", err.Error())
+	}
+
+	statsByFeed := make(map[int]*backend.FeedStat, len(stats))
+	for i := range stats {
+		statsByFeed[stats[i].Feed] = &stats[i]
+	}
+
+	all := make([]feedStats, len(feeds))
+	for i, feed := range feeds {
+		s := feedStats{
+			Feed:      feed.Name,
+			Enabled:   feed.Enabled,
+			LastError: feed.LastError,
+		}
+
+		if stat, ok := statsByFeed[feed.ID]; ok {
+			s.Items = stat.Items
+			s.RecentItems = stat.RecentItems
+			s.NewestItem = stat.NewestItem
+			s.LastRun = stat.LastRun
+
+			if stat.LastRun != nil {
+				if stat.LastRunError == "" {
+					s.LastStatus = "ok"
+				} else {
+					s.LastStatus = "failed"
+				}
+			}
+		}
+
+		all[i] = s
+	}
+
+	switch opts.Format {
+	case "json":
+		data, err := json.MarshalIndent(all, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(append(data, '\n'))
+
+		return err
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+
+		err = w.Write([]string{"feed", "enabled", "items", "recent_items", "newest_item", "last_run", "last_status", "last_error"})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range all {
+			err = w.Write([]string{s.Feed, strconv.FormatBool(s.Enabled), strconv.Itoa(s.Items), strconv.Itoa(s.RecentItems), formatStatsTime(s.NewestItem), formatStatsTime(s.LastRun), s.LastStatus, s.LastError})
+			if err != nil {
+				return err
+			}
+		}
+
+		w.Flush()
+
+		return w.Error()
+	}
+
+	now := time.Now()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FEED\tITEMS\tLAST 7 DAYS\tNEWEST ITEM\tLAST CRAWL\tSTATUS\tLAST ERROR")
+
+	for _, s := range all {
+		newest := "-"
+		if s.NewestItem != nil {
+			newest = formatAge(now.Sub(*s.NewestItem)) + " ago"
+		}
+
+		lastRun := "-"
+		if s.LastRun != nil {
+			lastRun = s.LastRun.Local().Format("2006-01-02 15:04")
+		}
+
+		status := s.LastStatus
+		if status == "" {
+			status = "-"
+		}
+		if !s.Enabled {
+			status += " (disabled)"
+		}
+
+		// errors can span lines which would break the table
+		lastError := strings.Join(strings.Fields(s.LastError), " ")
+
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", s.Feed, s.Items, s.RecentItems, newest, lastRun, status, lastError)
+	}
+
+	return w.Flush()
+}
+
+// formatStatsTime returns the time as RFC 3339 time or an empty string for no time
+func formatStatsTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// formatAge returns the age rounded to minutes below an hour, to hours below two days and to days otherwise
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age/time.Hour))
+	}
+
+	return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipSuffix marks the ETags of gzip compressed responses
+const gzipSuffix = "-gzip"
+
+// compressWriter compresses the body of a response with gzip
+type compressWriter struct {
+	http.ResponseWriter
+
+	gz      *gzip.Writer
+	decided bool
+}
+
+// acceptsGzip returns if the request accepts gzip compressed responses via its Accept-Encoding header
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(encoding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				continue
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// compressResponse compresses responses with gzip if the client accepts it and --disable-compression is not given
+func compressResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("Vary", "Accept-Encoding")
+
+		if opts.DisableCompression || req.Method == "HEAD" || !acceptsGzip(req) {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: res,
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, req)
+	})
+}
+
+// compressed returns if the response of the writer is compressed
+func compressed(res http.ResponseWriter) bool {
+	for {
+		switch w := res.(type) {
+		case *compressWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			res = w.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+func (cw *compressWriter) decide(status int) {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+
+	h := cw.Header()
+	// responses without a body, images, which are compressed already, and responses with an encoding are written unchanged
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || h.Get("Content-Encoding") != "" || strings.HasPrefix(h.Get("Content-Type"), "image/") {
+		return
+	}
+
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+
+	cw.gz = gzip.NewWriter(cw.ResponseWriter)
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	cw.decide(status)
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.gz == nil {
+		return cw.ResponseWriter.Write(data)
+	}
+
+	return cw.gz.Write(data)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes the remaining compressed data of the response
+func (cw *compressWriter) Close() {
+	if cw.gz != nil {
+		cw.gz.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// corsMethods holds the methods which cross-origin requests may use
+	corsMethods = "GET, HEAD, POST, DELETE"
+	// corsHeaders holds the request headers which cross-origin requests may send, e.g. the admin token via Authorization
+	corsHeaders = "Authorization, Content-Type, If-Modified-Since, If-None-Match"
+	// corsExposedHeaders holds the response headers which scripts of other origins may read
+	corsExposedHeaders = "ETag, Last-Modified"
+	// corsMaxAge is the time in seconds browsers may cache the result of a preflight request
+	corsMaxAge = 3600
+)
+
+// corsOrigins returns the origins of --cors-origins
+func corsOrigins() []string {
+	var origins []string
+
+	for _, origin := range strings.Split(opts.CORSOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+
+	return origins
+}
+
+// checkCORSOrigins returns an error if an origin of --cors-origins is neither * nor an origin like https://example.com or if --cors-credentials is used with *
+func checkCORSOrigins() error {
+	for _, origin := range corsOrigins() {
+		if origin == "*" {
+			if opts.CORSCredentials {
+				return fmt.Errorf("--cors-credentials cannot be used with the origin * of --cors-origins")
+			}
+
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("--cors-origins holds the invalid origin %q, origins must be like https://example.com", origin)
+		}
+	}
+
+	return nil
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for the origin of a request or an empty string if the origin is not allowed
+func allowOrigin(origins []string, origin string) string {
+	wildcard := false
+
+	for _, o := range origins {
+		if o == "*" {
+			wildcard = true
+		} else if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+
+	if wildcard {
+		return "*"
+	}
+
+	return ""
+}
+
+// handleCORS adds the CORS headers of --cors-origins to the responses for allowed origins and answers their preflight requests
+func handleCORS(origins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h := res.Header()
+		h.Add("Vary", "Origin")
+
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		allowed := allowOrigin(origins, origin)
+		if allowed == "" {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", allowed)
+		if opts.CORSCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", corsHeaders)
+			h.Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+
+			res.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		next.ServeHTTP(res, req)
+	})
+}
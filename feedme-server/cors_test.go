@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleCORSPreflight(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	handler := handleCORS([]string{"https://dashboard.example.com"}, newRouter())
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"refresh", "POST", "/news/refresh"},
+		{"hide item", "DELETE", "/news/item/1"},
+		{"unhide item", "POST", "/news/item/1/unhide"},
+		{"feed", "GET", "/news/atom"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(handler, "OPTIONS", tc.path, http.Header{
+				"Origin":                         {"https://dashboard.example.com"},
+				"Access-Control-Request-Method":  {tc.method},
+				"Access-Control-Request-Headers": {"Authorization"},
+			})
+
+			if res.Code != http.StatusNoContent {
+				t.Fatalf("expected status 204, got %d", res.Code)
+			}
+			if origin := res.Header().Get("Access-Control-Allow-Origin"); origin != "https://dashboard.example.com" {
+				t.Errorf("expected the allowed origin, got %q", origin)
+			}
+
+			methods := strings.Split(res.Header().Get("Access-Control-Allow-Methods"), ", ")
+			allowed := false
+			for _, method := range methods {
+				allowed = allowed || method == tc.method
+			}
+			if !allowed {
+				t.Errorf("expected the method %s to be allowed, got %v", tc.method, methods)
+			}
+			if !strings.Contains(res.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+				t.Errorf("expected the Authorization header to be allowed, got %q", res.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+
+	// the hide request itself carries the CORS headers
+	res := serve(handler, "DELETE", "/news/item/1?token="+testAdminToken, http.Header{"Origin": {"https://dashboard.example.com"}})
+	if res.Code != http.StatusNoContent || res.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" {
+		t.Errorf("expected 204 with the allowed origin, got %d with %q", res.Code, res.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// other origins get no preflight
+	res = serve(handler, "OPTIONS", "/news/item/1", http.Header{
+		"Origin":                        {"https://other.example.com"},
+		"Access-Control-Request-Method": {"DELETE"},
+	})
+	if res.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("expected no CORS headers for other origins, got %q", res.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
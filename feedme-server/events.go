@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// eventsBuffer is the count of events which are buffered for a client of an event stream
+const eventsBuffer = 64
+
+// eventsKeepAlive is the interval of the comments which keep idle event streams open through proxies
+const eventsKeepAlive = 30 * time.Second
+
+// eventsWriteTimeout is the max time of writing an event to a client of an event stream
+const eventsWriteTimeout = 10 * time.Second
+
+// errEventsClosed is returned for new event streams after the listener of the backend stopped
+var errEventsClosed = errors.New("listener for new items stopped")
+
+var events *eventBroker
+
+// eventBroker fans the new items of the listener of the backend out to the clients of the event streams
+type eventBroker struct {
+	lock    sync.Mutex
+	clients map[*eventClient]bool
+	// err is the reason why there are no events
+	err error
+}
+
+// eventClient represents a connected client of an event stream
+type eventClient struct {
+	// feed is the ID of the feed of the stream or 0 for the stream of all feeds
+	feed   int
+	events chan backend.ItemEvent
+}
+
+// itemEvent represents the data of an event of an event stream
+type itemEvent struct {
+	Feed  string `json:"feed"`
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URI   string `json:"uri"`
+	URL   string `json:"url"`
+}
+
+// listenEvents starts listening for new items of the backend until the context is done
+func listenEvents(ctx context.Context) *eventBroker {
+	b := &eventBroker{
+		clients: make(map[*eventClient]bool),
+	}
+
+	items, err := db.ListenItems(ctx)
+	if err != nil {
+		if !errors.Is(err, backend.ErrNotSupported) {
+			logger.Warn("cannot listen for new items", "error", err)
+		}
+
+		b.err = err
+
+		return b
+	}
+
+	go func() {
+		for event := range items {
+			b.publish(event)
+		}
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		b.err = errEventsClosed
+		for c := range b.clients {
+			b.remove(c)
+		}
+	}()
+
+	return b
+}
+
+// publish hands the event to all clients of its feed
+func (b *eventBroker) publish(event backend.ItemEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for c := range b.clients {
+		if c.feed == 0 && event.Private || c.feed != 0 && c.feed != event.Feed {
+			continue
+		}
+
+		select {
+		case c.events <- event:
+		default:
+			// clients which fall further behind than eventsBuffer are disconnected
+			logger.Info("disconnect slow event stream", "feed", event.FeedName)
+
+			b.remove(c)
+		}
+	}
+}
+
+// subscribe adds a client for the events of the feed or of all feeds for nil
+func (b *eventBroker) subscribe(feed *feedme.Feed) (*eventClient, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	c := &eventClient{
+		events: make(chan backend.ItemEvent, eventsBuffer),
+	}
+	if feed != nil {
+		c.feed = feed.ID
+	}
+
+	b.clients[c] = true
+
+	return c, nil
+}
+
+// unsubscribe removes the client if it is not already disconnected
+func (b *eventBroker) unsubscribe(c *eventClient) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.remove(c)
+}
+
+// remove removes the client and closes its events while the lock is held
+func (b *eventBroker) remove(c *eventClient) {
+	if b.clients[c] {
+		delete(b.clients, c)
+
+		close(c.events)
+	}
+}
+
+// streamEvents streams the new items of the feed or of all feeds for nil as Server-Sent Events until the client disconnects or falls behind
+func streamEvents(res http.ResponseWriter, req *http.Request, feed *feedme.Feed) {
+	c, err := events.subscribe(feed)
+	if errors.Is(err, backend.ErrNotSupported) {
+		writeError(res, http.StatusNotImplemented, fmt.Sprintf("backend %q does not support event streams", opts.Backend))
+
+		return
+	} else if err != nil {
+		writeError(res, http.StatusServiceUnavailable, err.Error())
+
+		return
+	}
+	defer events.unsubscribe(c)
+
+	// a client which does not read its stream must not block its handler forever
+	rc := http.NewResponseController(res)
+	write := func(format string, args ...interface{}) error {
+		err := rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+
+		_, err = fmt.Fprintf(res, format, args...)
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if write(": connected\n\n") != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-keepAlive.C:
+			err = write(": keep-alive\n\n")
+		case event, ok := <-c.events:
+			if !ok {
+				return
+			}
+
+			f := feed
+			if f == nil {
+				f = &feedme.Feed{
+					Name: event.FeedName,
+				}
+			}
+
+			var data []byte
+
+			data, err = json.Marshal(itemEvent{
+				Feed:  event.FeedName,
+				ID:    event.ID,
+				Title: event.Title,
+				URI:   event.URI,
+				URL:   itemURL(req, f, &feedme.Item{ID: event.ID}),
+			})
+			if err != nil {
+				return
+			}
+
+			err = write("id: %d\nevent: item\ndata: %s\n\n", event.ID, data)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func handleAllEvents(res http.ResponseWriter, req *http.Request) {
+	streamEvents(res, req, nil)
+}
+
+func handleEvents(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	streamEvents(res, req, feed)
+}
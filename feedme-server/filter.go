@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// feedItemsLimit is the count of the newest items of a feed
+const feedItemsLimit = 10
+
+// itemFilter restricts the items of a feed via the since, until, title and include query parameters of a request
+type itemFilter struct {
+	// since is the inclusive start and until the exclusive end of the creation time
+	since time.Time
+	until time.Time
+	// title must match the titles of the items
+	title *regexp.Regexp
+	// active excludes expired items
+	active bool
+}
+
+// parseItemFilter parses the item filter of the query parameters of the request
+func parseItemFilter(req *http.Request) (*itemFilter, error) {
+	var err error
+
+	params := req.URL.Query()
+	filter := &itemFilter{}
+
+	for _, p := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"since", &filter.since},
+		{"until", &filter.until},
+	} {
+		if v := params.Get(p.name); v != "" {
+			*p.value, err = parseSearchDate(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s parameter must be a date like 2006-01-02 or a RFC 3339 time", p.name)
+			}
+		}
+	}
+
+	if v := params.Get("title"); v != "" {
+		filter.title, err = regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("title parameter must be a valid regular expression: %s", err.Error())
+		}
+	}
+
+	switch params.Get("include") {
+	case "", "all":
+	case "active":
+		filter.active = true
+	default:
+		return nil, fmt.Errorf("include parameter must be active or all")
+	}
+
+	// nil means that the request does not filter
+	if filter.since.IsZero() && filter.until.IsZero() && filter.title == nil && !filter.active {
+		return nil, nil
+	}
+
+	return filter, nil
+}
+
+// key returns the parameters of the filter for the cache key of the filtered items
+func (f *itemFilter) key() string {
+	if f == nil {
+		return ""
+	}
+
+	var title string
+	if f.title != nil {
+		title = f.title.String()
+	}
+
+	return fmt.Sprintf("since=%s until=%s title=%s active=%t", f.since.Format(time.RFC3339Nano), f.until.Format(time.RFC3339Nano), title, f.active)
+}
+
+// query returns the backend query of the items of the feed within the filter
+func (f *itemFilter) query(feed *feedme.Feed) backend.ItemQuery {
+	// the limit is the same count as SearchItems of the backends returns
+	query := backend.ItemQuery{
+		Feeds:  []int{feed.ID},
+		Since:  f.since,
+		Until:  f.until,
+		Limit:  feedItemsLimit,
+		Order:  backend.ItemOrderDate,
+		Active: f.active,
+	}
+	// titles cannot be matched by the backends, so as many items as possible are matched in Go
+	if f.title != nil {
+		query.Limit = backend.ItemQueryMaxLimit
+	}
+
+	return query
+}
+
+// apply returns the newest items whose titles match the filter
+func (f *itemFilter) apply(items []feedme.Item) []feedme.Item {
+	if f.title == nil {
+		return items
+	}
+
+	matched := []feedme.Item{}
+	for _, item := range items {
+		if f.title.MatchString(item.Title) {
+			matched = append(matched, item)
+
+			if len(matched) == feedItemsLimit {
+				break
+			}
+		}
+	}
+
+	return matched
+}
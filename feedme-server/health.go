@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// readyTimeout is the max time of pinging the database for a readiness probe
+const readyTimeout = 2 * time.Second
+
+// version, commit and buildDate describe the build of the server which sets them via -ldflags
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// probeStatus represents the response of a health or readiness probe
+type probeStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// versionInfo represents the response of /version
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// writeProbe writes the JSON response of a probe which must never be cached
+func writeProbe(res http.ResponseWriter, status int, v interface{}) {
+	data, _ := json.Marshal(v)
+
+	res.Header().Set("Cache-Control", "no-store")
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(data)
+}
+
+// handleProbes answers the probes of orchestrators and /version before the authentication and the rate limit of the server
+func handleProbes(next http.Handler) http.Handler {
+	r := &router{
+		categories: http.NewServeMux(),
+		routes:     http.NewServeMux(),
+		prefix:     basePath(),
+	}
+
+	r.routes.HandleFunc("GET /healthz", handleHealth)
+	r.routes.HandleFunc("GET /readyz", handleReady)
+	r.routes.HandleFunc("GET /version", handleVersion)
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		probe := r.strip(req)
+		if h, pattern := r.routes.Handler(probe); pattern != "" {
+			h.ServeHTTP(res, probe)
+
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// handleHealth answers with 200 as long as the process serves requests
+func handleHealth(res http.ResponseWriter, req *http.Request) {
+	writeProbe(res, http.StatusOK, probeStatus{
+		Status: "ok",
+	})
+}
+
+// handleReady answers with 200 if the database can be pinged and with 503 otherwise
+func handleReady(res http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), readyTimeout)
+	defer cancel()
+
+	err := db.Ping(ctx)
+	if err != nil {
+		logger.Warn("database is not ready", "error", err)
+
+		// the error of the driver can hold the address and the user of the database
+		writeProbe(res, http.StatusServiceUnavailable, probeStatus{
+			Status: "unavailable",
+			Error:  "database is not reachable",
+		})
+
+		return
+	}
+
+	writeProbe(res, http.StatusOK, probeStatus{
+		Status: "ok",
+	})
+}
+
+func handleVersion(res http.ResponseWriter, req *http.Request) {
+	writeProbe(res, http.StatusOK, versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	})
+}
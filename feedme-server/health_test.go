@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zimmski/feedme/backend"
+)
+
+// unreachableBackend is a backend whose database cannot be pinged
+type unreachableBackend struct {
+	backend.Backend
+}
+
+func (b unreachableBackend) Ping(ctx context.Context) error {
+	return errors.New("dial tcp 10.0.0.5:5432: password authentication failed for user \"feedme\"")
+}
+
+func TestHandleReady(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	res := serve(handleProbes(newRouter()), "GET", "/readyz", nil)
+	if res.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", res.Code)
+	}
+
+	db = unreachableBackend{db}
+
+	res = serve(handleProbes(newRouter()), "GET", "/readyz", nil)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", res.Code)
+	}
+
+	body := res.Body.String()
+	if !strings.Contains(body, `"error":"database is not reachable"`) {
+		t.Errorf("expected the fixed error, got %s", body)
+	}
+	if strings.Contains(body, "10.0.0.5") || strings.Contains(body, "feedme") {
+		t.Errorf("expected no details of the database, got %s", body)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// handleHideItem hides the item from the feeds of the server
+func handleHideItem(res http.ResponseWriter, req *http.Request) {
+	updateItemHidden(res, req, true)
+}
+
+// handleUnhideItem displays the hidden item again
+func handleUnhideItem(res http.ResponseWriter, req *http.Request) {
+	updateItemHidden(res, req, false)
+}
+
+func updateItemHidden(res http.ResponseWriter, req *http.Request, hidden bool) {
+	if !checkAdminToken(res, req) {
+		return
+	}
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeError(res, http.StatusNotFound, fmt.Sprintf("item %q of feed %q not found", req.PathValue("id"), req.PathValue("feed")))
+
+		return
+	}
+
+	// hidden items are kept in the database so that the crawler does not insert them again
+	err = db.UpdateItemHidden(req.Context(), feed, id, hidden)
+	if checkError(res, req, err) {
+		return
+	}
+
+	logger.Info("changed visibility of item", "feed", feed.Name, "item", id, "hidden", hidden)
+
+	res.WriteHeader(http.StatusNoContent)
+}
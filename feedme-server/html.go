@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/zimmski/feedme"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var htmlTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"pathescape": url.PathEscape,
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// htmlIndex holds the data of the index page
+type htmlIndex struct {
+	Base  string
+	Feeds []feedme.Feed
+}
+
+// htmlItem holds the data of the page of an item
+type htmlItem struct {
+	Base string
+	Feed *feedme.Feed
+	Item *feedme.Item
+}
+
+// htmlFeed holds the data of the page of a feed
+type htmlFeed struct {
+	Base  string
+	Feed  *feedme.Feed
+	Items []feedme.Item
+}
+
+func writeHTML(res http.ResponseWriter, req *http.Request, name string, data interface{}) {
+	var out bytes.Buffer
+
+	err := htmlTemplates.ExecuteTemplate(&out, name, data)
+	if checkError(res, req, err) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+	res.Write(out.Bytes())
+}
+
+// accepts returns if the Accept header of the request holds the media type
+func accepts(req *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(accept, ";", 2)[0]) == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func handleFeedsHTML(res http.ResponseWriter, req *http.Request, feeds []feedme.Feed, etag string) {
+	if checkNotModified(res, req, weakETag("html", etag), time.Time{}) {
+		return
+	}
+
+	index := htmlIndex{
+		Base: baseURL(req),
+	}
+
+	for _, feed := range feeds {
+		if feed.Private() {
+			continue
+		}
+
+		index.Feeds = append(index.Feeds, feed)
+	}
+
+	writeHTML(res, req, "index.html", index)
+}
+
+func handleItemsHTML(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	filter, err := parseItemFilter(req)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	feed, items, err := getFeedItems(req.Context(), req.PathValue("feed"), filter)
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	etag, modified := itemsCacheKey(feed, filter, items)
+	if checkNotModified(res, req, weakETag("html", etag), modified) {
+		return
+	}
+
+	page := htmlFeed{
+		Base: baseURL(req),
+		Feed: feed,
+	}
+
+	for _, item := range items {
+		item.URI, err = feed.ResolveURI(item.URI)
+		if checkError(res, req, err) {
+			return
+		}
+
+		// descriptions are scraped HTML which is displayed as text
+		if item.Description != "" {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(item.Description))
+			if err == nil {
+				doc.Find("script, style").Remove()
+
+				item.Description = strings.TrimSpace(doc.Text())
+			}
+		}
+
+		page.Items = append(page.Items, item)
+	}
+
+	writeHTML(res, req, "feed.html", page)
+}
+
+func handleStyle(res http.ResponseWriter, req *http.Request) {
+	data, err := templateFiles.ReadFile("templates/style.css")
+	if checkError(res, req, err) {
+		return
+	}
+
+	if checkNotModified(res, req, weakETag(string(data)), time.Time{}) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/css; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
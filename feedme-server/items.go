@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// itemsPage represents a page of the items of a feed
+type itemsPage struct {
+	Items          []feedme.Item `json:"items"`
+	NextPageCursor string        `json:"next_page_cursor,omitempty"`
+}
+
+// encodePageCursor returns the opaque cursor of the page after the given item
+func encodePageCursor(item *feedme.Item) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(item.Created.UTC().Format(time.RFC3339Nano) + " " + strconv.Itoa(item.ID)))
+}
+
+// decodePageCursor returns the creation time and the ID of the last item of the previous page of the cursor
+func decodePageCursor(cursor string) (time.Time, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	created, id, ok := strings.Cut(string(data), " ")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("missing ID")
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return t, i, nil
+}
+
+// handleItemsPage returns a page of the items of a feed newest first
+func handleItemsPage(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	params := req.URL.Query()
+
+	limit := searchDefaultLimit
+	if v := params.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			writeError(res, http.StatusBadRequest, "limit parameter must be a positive integer")
+
+			return
+		}
+		if limit > backend.ItemQueryMaxLimit {
+			limit = backend.ItemQueryMaxLimit
+		}
+	}
+
+	var before time.Time
+	var beforeID int
+	// the page-cursor parameter is the next_page_cursor of the previous page
+	if cursor := params.Get("page-cursor"); cursor != "" {
+		before, beforeID, err = decodePageCursor(cursor)
+		if err != nil {
+			writeError(res, http.StatusBadRequest, "page-cursor parameter must be the next_page_cursor of a page")
+
+			return
+		}
+	}
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	// one more item tells if there is a next page
+	items, err := db.SearchItemsPage(req.Context(), feed, before, beforeID, limit+1)
+	if checkError(res, req, err) {
+		return
+	}
+
+	page := itemsPage{
+		Items: items,
+	}
+
+	// the last page has no cursor
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextPageCursor = encodePageCursor(&page.Items[limit-1])
+	}
+
+	for i := range page.Items {
+		item := &page.Items[i]
+
+		item.URI, err = feed.ResolveURI(item.URI)
+		if checkError(res, req, err) {
+			return
+		}
+
+		if item.Enclosure.URL != "" {
+			item.Enclosure.URL, err = feed.ResolveURI(item.Enclosure.URL)
+			if checkError(res, req, err) {
+				return
+			}
+		}
+
+		if opts.ItemLinks == "self" {
+			item.URI = itemURL(req, feed, item)
+		}
+	}
+	cachedImages(req, page.Items)
+
+	data, err := json.Marshal(page)
+	if checkError(res, req, err) {
+		return
+	}
+
+	if checkNotModified(res, req, weakETag(string(data)), time.Time{}) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
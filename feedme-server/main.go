@@ -1,25 +1,38 @@
 package main
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
-	"reflect"
-	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/codegangsta/martini"
 	"github.com/jessevdk/go-flags"
-	"github.com/zimmski/feeds"
+	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/zimmski/feedme"
 	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/crawler"
+	"github.com/zimmski/feedme/logging"
+	"github.com/zimmski/feedme/metrics"
+	"github.com/zimmski/feedme/transform"
 )
 
 const (
 	ReturnOk = iota
 	ReturnHelp
+	ReturnSchemaError
+	ReturnServerError
 )
 
 type FeedEnum int
@@ -30,30 +43,144 @@ const (
 )
 
 var opts struct {
-	Config       func(s string) error `long:"config" description:"INI config file" no-ini:"true"`
-	ConfigWrite  string               `long:"config-write" description:"Write all arguments to an INI config file or to STDOUT with \"-\" as argument" no-ini:"true"`
-	Logging      bool                 `long:"enable-logging" description:"Enable request logging"`
-	MaxIdleConns int                  `long:"max-idle-conns" default:"10" description:"Max idle connections of the database"`
-	MaxOpenConns int                  `long:"max-open-conns" default:"10" description:"Max open connections of the database"`
-	Port         uint                 `short:"p" long:"port" default:"9090" description:"HTTP port of the server"`
-	Spec         string               `short:"s" long:"spec" default:"dbname=feedme sslmode=disable" description:"The database connection spec"`
+	AdminToken         string               `long:"admin-token" description:"Token of POST requests to /<feed>/refresh which crawl the feed immediately and of the requests which hide and unhide items. Requests of / with the token include the transforms of the feeds"`
+	AllItems           int                  `long:"all-items" default:"50" description:"Count of the newest items of the combined feed of all feeds and of the feeds of categories"`
+	AuthPassword       string               `long:"auth-password" description:"Password of --auth-user"`
+	AuthUser           string               `long:"auth-user" description:"Protect all routes with HTTP basic authentication for this user"`
+	Backend            string               `long:"backend" default:"postgresql" choice:"memory" choice:"postgresql" description:"Backend for storing feeds and items. The memory backend loses everything on exit"`
+	BaseURL            string               `long:"base-url" description:"External URL of the server for absolute links, e.g. https://example.com/feeds. Its path is stripped from the paths of requests (Default is derived from the request)"`
+	CacheMaxAge        int                  `long:"cache-max-age" description:"Seconds clients may cache responses via the Cache-Control header (0 disables the header)"`
+	Config             func(s string) error `long:"config" description:"INI config file" no-ini:"true"`
+	ConfigWrite        string               `long:"config-write" description:"Write all arguments to an INI config file or to STDOUT with \"-\" as argument" no-ini:"true"`
+	ConnMaxIdleTime    time.Duration        `long:"conn-max-idle-time" default:"0s" description:"Close connections of the database which were idle for this time (0 keeps idle connections)"`
+	ConnMaxLifetime    time.Duration        `long:"conn-max-lifetime" default:"0s" description:"Replace connections of the database after this time, e.g. before a firewall kills them (0 reuses connections forever)"`
+	CORSCredentials    bool                 `long:"cors-credentials" description:"Allow cross-origin requests of --cors-origins with credentials, e.g. cookies or basic authentication. Cannot be used with the origin *"`
+	CORSOrigins        string               `long:"cors-origins" description:"Comma separated origins like https://dash.example.com which may access the server from browsers, * allows all origins (Default is no CORS headers)"`
+	DBConnectBackoff   time.Duration        `long:"db-connect-backoff" default:"1s" description:"Wait this time before the first retry of --db-connect-retries, which doubles with every retry up to a minute"`
+	DBConnectRetries   int                  `long:"db-connect-retries" default:"0" description:"Retry failed connections to the database at startup this count of times, e.g. if the database starts after the server"`
+	DisableCompression bool                 `long:"disable-compression" description:"Do not compress responses with gzip, e.g. if a reverse proxy compresses them"`
+	InitDB             bool                 `long:"init-db" description:"Create missing database tables and exit" no-ini:"true"`
+	ItemLinks          string               `long:"item-links" default:"source" choice:"source" choice:"self" description:"Links of feed entries point to the source site or to the item pages of the server"`
+	LogFile            string               `long:"log-file" description:"Write log messages to this file instead of STDERR"`
+	LogFormat          string               `long:"log-format" default:"text" choice:"text" choice:"json" description:"Format of log messages"`
+	LogLevel           string               `long:"log-level" default:"info" choice:"debug" choice:"info" choice:"warn" choice:"error" description:"Minimum level of log messages"`
+	Logging            bool                 `long:"enable-logging" description:"Enable request logging"`
+	MaxBodySize        int64                `long:"max-body-size" default:"1048576" description:"Max size of the request bodies of POST requests in bytes"`
+	MaxIdleConns       int                  `long:"max-idle-conns" default:"10" description:"Max idle connections of the database"`
+	MaxOpenConns       int                  `long:"max-open-conns" default:"10" description:"Max open connections of the database (0 is unlimited)"`
+	MediaDir           string               `long:"media-dir" description:"Serve the cached images of --media-dir of the feedme crawler via /media/<hash> and point the items to them (Default is the source images)"`
+	Migrate            bool                 `long:"migrate" description:"Apply pending database schema migrations and exit" no-ini:"true"`
+	Port               uint                 `short:"p" long:"port" default:"9090" description:"HTTP port of the server"`
+	RateBurst          int                  `long:"rate-burst" description:"Max requests of a client IP at once, i.e. the bucket size of --rate-limit (Default is the count of --rate-limit)"`
+	RateLimit          string               `long:"rate-limit" description:"Max requests per client IP like 60/m with the unit s, m or h. Exceeding requests are answered with 429 (Default is no limit)"`
+	RateLimitExempt    []string             `long:"rate-limit-exempt" description:"CIDR or IP of clients which are not rate limited (can be used more than once)"`
+	RefreshTimeout     time.Duration        `long:"refresh-timeout" default:"60s" description:"Max time a refresh request waits for the crawl of its feed. The crawl continues after the timeout"`
+	SnippetsDir        string               `long:"snippets-dir" description:"Directory of the transform snippets of the feedme crawler which are included by the transforms of refreshed feeds"`
+	Spec               string               `short:"s" long:"spec" default:"dbname=feedme sslmode=disable" description:"The database connection spec"`
+	TLSAuto            bool                 `long:"tls-auto" description:"Serve HTTPS with certificates of Let's Encrypt for the hosts of --tls-host"`
+	TLSCache           string               `long:"tls-cache" default:"certs" description:"Cache directory for the certificates of --tls-auto"`
+	TLSCert            string               `long:"tls-cert" description:"Serve HTTPS with this certificate file which is reloaded on SIGHUP"`
+	TLSHosts           []string             `long:"tls-host" description:"Host that is allowed to request certificates with --tls-auto (can be used more than once)"`
+	TLSHTTPPort        uint                 `long:"tls-http-port" default:"80" description:"HTTP port which answers the certificate challenges of --tls-auto and redirects all other requests to HTTPS (0 disables it)"`
+	TLSKey             string               `long:"tls-key" description:"Key file of the certificate of --tls-cert"`
+	TrustedProxies     []string             `long:"trusted-proxies" description:"CIDR or IP of reverse proxies whose X-Forwarded-For headers identify the clients of --rate-limit and whose X-Forwarded-Proto and X-Forwarded-Host headers define the external URL of the server (can be used more than once)"`
+	WarnEmptyAfter     int                  `long:"warn-empty-after" default:"3" description:"Report the transforms of feeds as likely broken in /<feed>/status after this count of consecutive crawls without items (0 disables the report)"`
+	WebSubHub          string               `long:"websub-hub" description:"URL of a WebSub hub which is announced with hub and self links in the feeds of the feeds. The feedme crawler pings the hub about new items"`
 
 	configFile string
 }
 
 var db backend.Backend
+var logger = slog.Default()
+var serverMetrics = metrics.NewRegistry()
 
-func checkError(res http.ResponseWriter, err error) bool {
-	if err != nil {
-		panic(err)
+func writeError(res http.ResponseWriter, status int, message string) {
+	data, _ := json.Marshal(map[string]string{
+		"error": message,
+	})
+
+	// caching headers of the failed response must not stick
+	for _, h := range []string{"Cache-Control", "ETag", "Last-Modified"} {
+		res.Header().Del(h)
 	}
 
-	return false
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(data)
+}
+
+// requestToken returns the token of the request which is given via the token query parameter or a bearer Authorization header
+func requestToken(req *http.Request) string {
+	token := req.URL.Query().Get("token")
+	if auth := req.Header.Get("Authorization"); token == "" && strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return token
+}
+
+// checkFeedToken answers with 403 and returns false if the feed is private and the request does not hold its token
+func checkFeedToken(res http.ResponseWriter, req *http.Request, feed *feedme.Feed) bool {
+	if !feed.Private() {
+		return true
+	}
+
+	if !hasFeedToken(req, feed) {
+		writeError(res, http.StatusForbidden, fmt.Sprintf("feed %q needs a valid token", feed.Name))
+
+		return false
+	}
+
+	return true
+}
+
+// hasFeedToken returns if the request holds the token of the private feed
+func hasFeedToken(req *http.Request, feed *feedme.Feed) bool {
+	return subtle.ConstantTimeCompare([]byte(requestToken(req)), []byte(feed.Token)) == 1
+}
+
+// readableFeeds returns the feeds without the private feeds whose token the request does not hold
+func readableFeeds(req *http.Request, feeds []feedme.Feed) []feedme.Feed {
+	if isAdmin(req) {
+		return feeds
+	}
+
+	readable := make([]feedme.Feed, 0, len(feeds))
+	for i := range feeds {
+		if !feeds[i].Private() || hasFeedToken(req, &feeds[i]) {
+			readable = append(readable, feeds[i])
+		}
+	}
+
+	return readable
+}
+
+// basicAuth answers all requests without the credentials of --auth-user and --auth-password with 401
+func basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		user, password, ok := req.BasicAuth()
+
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(opts.AuthUser)) != 1 || subtle.ConstantTimeCompare([]byte(password), []byte(opts.AuthPassword)) != 1 {
+			res.Header().Set("WWW-Authenticate", `Basic realm="feedme"`)
+			writeError(res, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
 }
 
-func checkNotFound(res http.ResponseWriter, item interface{}) bool {
-	if item == nil || !reflect.ValueOf(item).Elem().IsValid() {
-		res.WriteHeader(http.StatusNotFound)
+// checkError answers with 404 for backend.ErrNotFound and with 500 for all other errors and returns if there was an error
+func checkError(res http.ResponseWriter, req *http.Request, err error) bool {
+	if errors.Is(err, backend.ErrNotFound) {
+		writeError(res, http.StatusNotFound, err.Error())
+
+		return true
+	} else if err != nil {
+		logger.Error("cannot handle request", "method", req.Method, "path", req.URL.Path, "error", err)
+
+		writeError(res, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 
 		return true
 	}
@@ -61,127 +188,914 @@ func checkNotFound(res http.ResponseWriter, item interface{}) bool {
 	return false
 }
 
+// baseETag returns the ETag without its weak prefix and encoding suffix
+func baseETag(etag string) string {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	if strings.HasSuffix(etag, gzipSuffix+`"`) {
+		etag = strings.TrimSuffix(etag, gzipSuffix+`"`) + `"`
+	}
+
+	return etag
+}
+
+// checkNotModified sets the caching headers and answers with 304 if the cached version of the client is still valid
+func checkNotModified(res http.ResponseWriter, req *http.Request, etag string, modified time.Time) bool {
+	if opts.CacheMaxAge > 0 {
+		res.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", opts.CacheMaxAge))
+	}
+
+	if compressed(res) {
+		// caches must not mix up the encodings of a response
+		etag = strings.TrimSuffix(etag, `"`) + gzipSuffix + `"`
+	}
+
+	res.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		res.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	notModified := false
+
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, m := range strings.Split(match, ",") {
+			m = strings.TrimSpace(m)
+
+			// all variants of a response match without their weak prefix and encoding suffix
+			if m == "*" || baseETag(m) == baseETag(etag) {
+				notModified = true
+
+				break
+			}
+		}
+	} else if since := req.Header.Get("If-Modified-Since"); since != "" && !modified.IsZero() {
+		if t, err := http.ParseTime(since); err == nil && !modified.Truncate(time.Second).After(t) {
+			notModified = true
+		}
+	}
+
+	if notModified {
+		res.WriteHeader(http.StatusNotModified)
+	}
+
+	return notModified
+}
+
+func weakETag(values ...interface{}) string {
+	h := sha1.New()
+
+	for _, v := range values {
+		fmt.Fprintf(h, "%v\x00", v)
+	}
+
+	return fmt.Sprintf("W/\"%x\"", h.Sum(nil))
+}
+
+// itemsCacheKey returns the ETag and the Last-Modified time of the items of the feed which are restricted by the filter
+func itemsCacheKey(feed *feedme.Feed, filter *itemFilter, items []feedme.Item) (string, time.Time) {
+	var newestID int
+	var modified time.Time
+
+	for _, i := range items {
+		if i.ID > newestID {
+			newestID = i.ID
+		}
+		if i.Modified().After(modified) {
+			modified = i.Modified()
+		}
+	}
+
+	// edited items change the modification time but neither the newest ID nor the count, the URL differs between searches of the same query
+	if filter != nil {
+		return weakETag(feed.Name, feed.URL, newestID, len(items), modified.UnixNano(), filter.key()), modified
+	}
+
+	return weakETag(feed.Name, feed.URL, newestID, len(items), modified.UnixNano()), modified
+}
+
+// feedSummary represents a feed in the feed list of the server
+type feedSummary struct {
+	Name         string     `json:"name"`
+	URL          string     `json:"url,omitempty"`
+	Category     string     `json:"category,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	Items        int        `json:"items"`
+	NewestItem   *time.Time `json:"newest_item,omitempty"`
+	LastCrawled  *time.Time `json:"last_crawled,omitempty"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastStatus   string     `json:"last_status,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	FailureCount int        `json:"failure_count"`
+	RSS          string     `json:"rss"`
+	Atom         string     `json:"atom"`
+	Transform    string     `json:"transform,omitempty"`
+}
+
+// feedSummaries returns the summaries of the feeds with the stats of the backend
+func feedSummaries(req *http.Request, feeds []feedme.Feed) ([]feedSummary, error) {
+	stats, err := db.FeedStats(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	statsByFeed := make(map[int]*backend.FeedStat, len(stats))
+	for i := range stats {
+		statsByFeed[stats[i].Feed] = &stats[i]
+	}
+
+	admin := isAdmin(req)
+	base := baseURL(req)
+
+	summaries := make([]feedSummary, len(feeds))
+	for i, feed := range feeds {
+		summary := feedSummary{
+			Name:         feed.Name,
+			URL:          feed.URL,
+			Category:     feed.Category,
+			Enabled:      feed.Enabled,
+			LastCrawled:  feed.LastCrawled,
+			LastError:    hideSource(&feed, feed.LastError),
+			FailureCount: feed.FailureCount,
+			RSS:          base + url.PathEscape(feed.Name) + "/rss",
+			Atom:         base + url.PathEscape(feed.Name) + "/atom",
+		}
+
+		if stat, ok := statsByFeed[feed.ID]; ok {
+			summary.Items = stat.Items
+			summary.NewestItem = stat.NewestItem
+			summary.LastRun = stat.LastRun
+
+			if stat.LastRun != nil {
+				if stat.LastRunError == "" {
+					summary.LastStatus = "ok"
+				} else {
+					summary.LastStatus = "failed"
+				}
+			}
+		}
+
+		// transforms and hidden sources are only included for admins
+		if admin {
+			summary.Transform = feed.Transform
+			summary.LastError = feed.LastError
+		} else if feed.HideSource {
+			summary.URL = ""
+		}
+
+		summaries[i] = summary
+	}
+
+	return summaries, nil
+}
+
 func handleFeeds(res http.ResponseWriter, req *http.Request) {
 	var err error
 
-	feeds, err := db.SearchFeeds(nil)
-	if checkError(res, err) {
+	feeds, err := db.SearchFeeds(req.Context(), nil, "", true)
+	if checkError(res, req, err) {
+		return
+	}
+	feeds = readableFeeds(req, feeds)
+
+	summaries, err := feedSummaries(req, feeds)
+	if checkError(res, req, err) {
+		return
+	}
+
+	data, err := json.Marshal(summaries)
+	if checkError(res, req, err) {
+		return
+	}
+
+	res.Header().Add("Vary", "Accept, Authorization")
+
+	if !accepts(req, "application/json") {
+		handleFeedsHTML(res, req, feeds, string(data))
+
+		return
+	}
+
+	if checkNotModified(res, req, weakETag(string(data)), time.Time{}) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// getFeedItems returns the feed with its newest items which are restricted by the filter if it is not nil
+func getFeedItems(ctx context.Context, feedName string, filter *itemFilter) (*feedme.Feed, []feedme.Item, error) {
+	var err error
+	var items []feedme.Item
+
+	feed, err := db.FindFeed(ctx, feedName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if filter == nil {
+		items, err = db.SearchItems(ctx, feed)
+	} else {
+		items, err = db.SearchItemsQuery(ctx, filter.query(feed))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if filter != nil {
+		items = filter.apply(items)
+	}
+
+	return feed, items, nil
+}
+
+func writeFeed(typ FeedEnum, res http.ResponseWriter, req *http.Request, feed *feedme.Feed, filter *itemFilter, items []feedme.Item, links ...feedme.FeedLink) {
+	var err error
+	var data string
+
+	etag, modified := itemsCacheKey(feed, filter, items)
+	if checkNotModified(res, req, etag, modified) {
 		return
 	}
 
-	data, err := json.Marshal(feeds)
-	if checkError(res, err) {
+	cachedImages(req, items)
+
+	if feed.Link() == "" {
+		// the links of the items are resolved against the feed before the HTML page of the server becomes its site URL
+		items, err = resolveItems(feed, items)
+		if checkError(res, req, err) {
+			return
+		}
+
+		f := *feed
+		f.SiteURL = feedLink(req, feed)
+		feed = &f
+	}
+
+	if typ == FeedAtom {
+		data, err = feed.Atom(items, links...)
+	} else {
+		data, err = feed.Rss(items, links...)
+	}
+	if checkError(res, req, err) {
 		return
 	}
 
+	res.Header().Set("Content-Type", "application/xml")
 	res.WriteHeader(http.StatusOK)
+	res.Write([]byte(data))
+}
+
+func handleItems(typ FeedEnum, res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	filter, err := parseItemFilter(req)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	feed, items, err := getFeedItems(req.Context(), req.PathValue("feed"), filter)
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	if opts.ItemLinks == "self" {
+		for i := range items {
+			items[i].URI = itemURL(req, feed, &items[i])
+		}
+	}
+
+	writeFeed(typ, res, req, feed, filter, items, websubLinks(typ, req, feed)...)
+}
+
+// websubLinks returns the hub and self links of the feed of a feed for --websub-hub
+func websubLinks(typ FeedEnum, req *http.Request, feed *feedme.Feed) []feedme.FeedLink {
+	// the hub cannot read private feeds
+	if opts.WebSubHub == "" || feed.Private() {
+		return nil
+	}
+
+	variant := "rss"
+	if typ == FeedAtom {
+		variant = "atom"
+	}
+
+	return []feedme.FeedLink{
+		{Rel: "hub", Href: opts.WebSubHub},
+		{Rel: "self", Href: baseURL(req) + url.PathEscape(feed.Name) + "/" + variant},
+	}
+}
+
+// itemURL returns the URL of the item page of the server
+func itemURL(req *http.Request, feed *feedme.Feed, item *feedme.Item) string {
+	u := baseURL(req) + url.PathEscape(feed.Name) + "/item/" + strconv.Itoa(item.ID)
+	if feed.Private() {
+		u += "?token=" + url.QueryEscape(requestToken(req))
+	}
+
+	return u
+}
+
+func handleItem(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	id, err := strconv.Atoi(req.PathValue("id"))
+	if err != nil {
+		writeError(res, http.StatusNotFound, fmt.Sprintf("item %q of feed %q not found", req.PathValue("id"), req.PathValue("feed")))
+
+		return
+	}
+
+	item, err := db.FindItemByID(req.Context(), feed, id)
+	if checkError(res, req, err) {
+		return
+	}
+	// hidden items are only displayed to admins, e.g. to check them before unhiding them
+	if item.Hidden && !isAdmin(req) {
+		writeError(res, http.StatusNotFound, fmt.Sprintf("item %d of feed %q not found", id, feed.Name))
+
+		return
+	}
+
+	item.URI, err = feed.ResolveURI(item.URI)
+	if checkError(res, req, err) {
+		return
+	}
+	if item.Enclosure.URL != "" {
+		item.Enclosure.URL, err = feed.ResolveURI(item.Enclosure.URL)
+		if checkError(res, req, err) {
+			return
+		}
+	}
+	cachedImage(req, item)
+
+	data, err := json.Marshal(item)
+	if checkError(res, req, err) {
+		return
+	}
+
+	res.Header().Add("Vary", "Accept")
+
+	html := accepts(req, "text/html")
+
+	if checkNotModified(res, req, weakETag(html, string(data)), item.Modified()) {
+		return
+	}
+
+	if html {
+		writeHTML(res, req, "item.html", htmlItem{
+			Base: baseURL(req),
+			Feed: feed,
+			Item: item,
+		})
+
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+func handleItemsAtom(res http.ResponseWriter, req *http.Request) {
+	handleItems(FeedAtom, res, req)
+}
+
+func handleItemsRss(res http.ResponseWriter, req *http.Request) {
+	handleItems(FeedRSS, res, req)
+}
+
+// feedStatus represents the crawl status of a feed
+type feedStatus struct {
+	Feed         string           `json:"feed"`
+	Enabled      bool             `json:"enabled"`
+	FailureCount int              `json:"failure_count"`
+	LastError    string           `json:"last_error"`
+	Items        int              `json:"items"`
+	LastRun      *feedme.CrawlRun `json:"last_run"`
+	LastNewItems *time.Time       `json:"last_new_items"`
+	EmptyRuns    int              `json:"empty_runs"`
+	LikelyBroken bool             `json:"likely_broken"`
+}
+
+func handleStatus(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+	if !checkFeedToken(res, req, feed) {
+		return
+	}
+
+	counts, err := db.CountItems(req.Context())
+	if checkError(res, req, err) {
+		return
+	}
+
+	runs, err := db.SearchCrawlRuns(req.Context(), feed, backend.CrawlRunsRetention)
+	if checkError(res, req, err) {
+		return
+	}
+
+	status := feedStatus{
+		Feed:         feed.Name,
+		Enabled:      feed.Enabled,
+		FailureCount: feed.FailureCount,
+		LastError:    hideSource(feed, feed.LastError),
+		Items:        counts[feed.ID],
+		EmptyRuns:    feed.EmptyRuns,
+		LikelyBroken: opts.WarnEmptyAfter > 0 && feed.EmptyRuns >= opts.WarnEmptyAfter,
+	}
+
+	if len(runs) != 0 {
+		status.LastRun = &runs[0]
+		status.LastRun.Error = hideSource(feed, status.LastRun.Error)
+	}
+	for _, run := range runs {
+		if run.ItemsInserted != 0 {
+			status.LastNewItems = &run.Started
+
+			break
+		}
+	}
+
+	data, err := json.Marshal(status)
+	if checkError(res, req, err) {
+		return
+	}
+
 	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
 	res.Write(data)
 }
 
-func getFeedItems(feedName string) (*feeds.Feed, error) {
+// feedLink returns the link of the feed to its site, which is the HTML page of the feed for feeds with a hidden source and without a site URL
+func feedLink(req *http.Request, feed *feedme.Feed) string {
+	if link := feed.Link(); link != "" {
+		return link
+	}
+
+	return baseURL(req) + url.PathEscape(feed.Name) + "/html"
+}
+
+// hideSource replaces the URL of feeds with a hidden source in the message
+func hideSource(feed *feedme.Feed, message string) string {
+	if !feed.HideSource || feed.URL == "" {
+		return message
+	}
+
+	return strings.ReplaceAll(message, feed.URL, "<hidden source>")
+}
+
+// baseURL returns the external URL of the server with a trailing slash
+func baseURL(req *http.Request) string {
+	if opts.BaseURL != "" {
+		return strings.TrimRight(opts.BaseURL, "/") + "/"
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	host := req.Host
+
+	// only --trusted-proxies may set the scheme and the host
+	if fromTrustedProxy(req) {
+		if proto := forwardedHeader(req, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if h := forwardedHeader(req, "X-Forwarded-Host"); h != "" {
+			host = h
+		}
+	}
+
+	return scheme + "://" + host + "/"
+}
+
+// forwardedHeader returns the first value of a forwarded header
+func forwardedHeader(req *http.Request, name string) string {
+	// the first value is the one of the proxy nearest to the client
+	value, _, _ := strings.Cut(req.Header.Get(name), ",")
+
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// basePath returns the path of --base-url without a trailing slash which is stripped from the paths of requests
+func basePath() string {
+	u, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimRight(u.Path, "/")
+}
+
+func getAllItems(req *http.Request) (*feedme.Feed, []feedme.Item, error) {
 	var err error
 
-	feed, err := db.FindFeed(feedName)
+	feeds, err := db.SearchFeeds(req.Context(), nil, "", true)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if feed == nil {
-		return nil, nil
+
+	feedsByID := make(map[int]*feedme.Feed, len(feeds))
+	for i := range feeds {
+		feedsByID[feeds[i].ID] = &feeds[i]
 	}
 
-	items, err := db.SearchItems(feed)
+	all, err := db.SearchItemsAll(req.Context(), opts.AllItems)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if items == nil {
-		return nil, nil
+
+	// items of private feeds must not be visible in the combined feed
+	items := all[:0]
+	for _, item := range all {
+		if feed, ok := feedsByID[item.Feed]; !ok || !feed.Private() {
+			items = append(items, item)
+		}
+	}
+
+	err = mergeItems(req, feedsByID, items)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	reProtocol := regexp.MustCompile(`[a-zA-Z0-9+\-.]+://`)
+	allFeed := &feedme.Feed{
+		Name: "all",
+		URL:  baseURL(req),
+	}
+
+	return allFeed, items, nil
+}
+
+// getCategoryItems returns the newest items of all public feeds of the category
+func getCategoryItems(req *http.Request, category string) (*feedme.Feed, []feedme.Item, error) {
+	var err error
 
-	u, err := url.Parse(feed.URL)
+	feeds, err := db.SearchFeeds(req.Context(), nil, category, true)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	u.RawQuery = ""
-	feedURL := u.String()
-	if feedURL[len(feedURL)-1] != '/' {
-		feedURL += "/"
+
+	query := backend.ItemQuery{
+		Limit: opts.AllItems,
+		Order: backend.ItemOrderDate,
 	}
-	u.Path = ""
-	feedURLWithoutPath := u.String()
 
-	feeder := &feeds.Feed{
-		Title: feed.Name,
-		Link:  &feeds.Link{Href: feed.URL},
+	feedsByID := make(map[int]*feedme.Feed, len(feeds))
+	for i := range feeds {
+		if !feeds[i].Private() {
+			feedsByID[feeds[i].ID] = &feeds[i]
+			query.Feeds = append(query.Feeds, feeds[i].ID)
+		}
 	}
 
-	for _, i := range items {
-		if feeder.Updated.IsZero() || feeder.Updated.Before(i.Created) {
-			feeder.Updated = i.Created
+	if len(query.Feeds) == 0 {
+		return nil, nil, fmt.Errorf("category %q %w", category, backend.ErrNotFound)
+	}
+
+	items, err := db.SearchItemsQuery(req.Context(), query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = mergeItems(req, feedsByID, items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	categoryFeed := &feedme.Feed{
+		Name: "category: " + category,
+		URL:  baseURL(req) + "category/" + url.PathEscape(category) + "/",
+	}
+
+	return categoryFeed, items, nil
+}
+
+// resolveItems returns copies of the items with the absolute URIs and enclosure URLs of the feed
+func resolveItems(feed *feedme.Feed, items []feedme.Item) ([]feedme.Item, error) {
+	var err error
+
+	resolved := make([]feedme.Item, len(items))
+	copy(resolved, items)
+
+	for i := range resolved {
+		resolved[i].URI, err = feed.ResolveURI(resolved[i].URI)
+		if err != nil {
+			return nil, err
 		}
 
-		var link string
+		if resolved[i].Enclosure.URL != "" {
+			resolved[i].Enclosure.URL, err = feed.ResolveURI(resolved[i].Enclosure.URL)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 
-		if reProtocol.MatchString(i.URI) {
-			link = i.URI
-		} else if i.URI[0] == '/' {
-			link = fmt.Sprintf("%s%s", feedURLWithoutPath, i.URI)
-		} else {
-			link = fmt.Sprintf("%s%s", feedURL, i.URI)
+	return resolved, nil
+}
+
+// mergeItems resolves the URIs of items of different feeds and prefixes their titles with the names of their feeds
+func mergeItems(req *http.Request, feedsByID map[int]*feedme.Feed, items []feedme.Item) error {
+	var err error
+
+	for i := range items {
+		feed, ok := feedsByID[items[i].Feed]
+		if !ok {
+			continue
 		}
 
-		feeder.Add(&feeds.Item{
-			Id:          strconv.Itoa(i.ID),
-			Title:       i.Title,
-			Link:        &feeds.Link{Href: link},
-			Description: i.Description,
-			Created:     i.Created,
-		})
+		items[i].URI, err = feed.ResolveURI(items[i].URI)
+		if err != nil {
+			return err
+		}
+
+		if items[i].Enclosure.URL != "" {
+			items[i].Enclosure.URL, err = feed.ResolveURI(items[i].Enclosure.URL)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.ItemLinks == "self" {
+			items[i].URI = itemURL(req, feed, &items[i])
+		}
+
+		items[i].Title = feed.Name + ": " + items[i].Title
 	}
 
-	return feeder, nil
+	return nil
 }
 
-func handleItems(typ FeedEnum, res http.ResponseWriter, req *http.Request, params martini.Params) {
+func handleAllItems(typ FeedEnum, res http.ResponseWriter, req *http.Request) {
 	var err error
 
-	feeder, err := getFeedItems(params["feed"])
-	if checkError(res, err) {
+	feed, items, err := getAllItems(req)
+	if checkError(res, req, err) {
 		return
 	}
-	if checkNotFound(res, feeder) {
+
+	writeFeed(typ, res, req, feed, nil, items)
+}
+
+func handleAllItemsAtom(res http.ResponseWriter, req *http.Request) {
+	handleAllItems(FeedAtom, res, req)
+}
+
+func handleAllItemsRss(res http.ResponseWriter, req *http.Request) {
+	handleAllItems(FeedRSS, res, req)
+}
+
+func handleCategoryItems(typ FeedEnum, res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feed, items, err := getCategoryItems(req, req.PathValue("category"))
+	if checkError(res, req, err) {
 		return
 	}
 
-	var data string
+	writeFeed(typ, res, req, feed, nil, items)
+}
 
-	if typ == FeedAtom {
-		data, err = feeder.ToAtom()
-	} else {
-		data, err = feeder.ToRss()
+func handleCategoryItemsAtom(res http.ResponseWriter, req *http.Request) {
+	handleCategoryItems(FeedAtom, res, req)
+}
+
+func handleCategoryItemsRss(res http.ResponseWriter, req *http.Request) {
+	handleCategoryItems(FeedRSS, res, req)
+}
+
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Type    string `xml:"type,attr"`
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr"`
+	XMLURL  string `xml:"xmlUrl,attr"`
+	HTMLURL string `xml:"htmlUrl,attr"`
+}
+
+func handleOPML(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feeds, err := db.SearchFeeds(req.Context(), nil, "", true)
+	if checkError(res, req, err) {
+		return
+	}
+
+	base := baseURL(req)
+
+	doc := opml{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       "feedme feeds",
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, feed := range feeds {
+		if feed.Private() {
+			continue
+		}
+
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Type:    "rss",
+			Text:    feed.Title(),
+			Title:   feed.Title(),
+			XMLURL:  base + url.PathEscape(feed.Name) + "/rss",
+			HTMLURL: feedLink(req, &feed),
+		})
 	}
-	if checkError(res, err) {
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if checkError(res, req, err) {
 		return
 	}
 
+	res.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
 	res.WriteHeader(http.StatusOK)
-	res.Header().Set("Content-Type", "application/xml")
-	res.Write([]byte(data))
+	res.Write([]byte(xml.Header))
+	res.Write(data)
+}
+
+// logRequest logs the method, path, status, duration and client of every request
+func logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		sw := &statusWriter{
+			ResponseWriter: res,
+		}
+
+		next.ServeHTTP(sw, req)
+
+		logger.Info("request", "method", req.Method, "path", req.URL.Path, "status", sw.status, "duration", time.Since(start), "remote", req.RemoteAddr)
+	})
+}
+
+// instrument records the request count and duration of a route with the metrics feedme_server_requests_total and feedme_server_request_duration_seconds
+func instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		sw := &statusWriter{
+			ResponseWriter: res,
+		}
+
+		handler(sw, req)
+
+		status := http.StatusOK
+		if sw.status != 0 {
+			status = sw.status
+		}
+
+		labels := metrics.Labels{
+			"route":  route,
+			"status": strconv.Itoa(status),
+		}
+		// unknown feed names would create arbitrary many label values
+		if feed := req.PathValue("feed"); feed != "" && status != http.StatusNotFound {
+			labels["feed"] = feed
+		}
+
+		serverMetrics.Add("feedme_server_requests_total", "Count of handled requests", labels, 1)
+		serverMetrics.Observe("feedme_server_request_duration_seconds", "Duration of handled requests", metrics.Labels{"route": route}, time.Since(start).Seconds())
+	}
 }
 
-func handleItemsAtom(res http.ResponseWriter, req *http.Request, params martini.Params) {
-	handleItems(FeedAtom, res, req, params)
+func handleMetrics(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	feeds, err := db.SearchFeeds(req.Context(), nil, "", true)
+	if checkError(res, req, err) {
+		return
+	}
+
+	counts, err := db.CountItems(req.Context())
+	if checkError(res, req, err) {
+		return
+	}
+
+	// removed feeds must not linger
+	serverMetrics.Reset("feedme_server_feed_items")
+	for _, feed := range feeds {
+		serverMetrics.Set("feedme_server_feed_items", "Count of stored items per feed", metrics.Labels{"feed": feed.Name}, float64(counts[feed.ID]))
+	}
+
+	// the samples of private feeds, e.g. their request counts, are only displayed with their tokens
+	hidden := make(map[string]bool)
+	for _, feed := range feeds {
+		hidden[feed.Name] = true
+	}
+	for _, feed := range readableFeeds(req, feeds) {
+		delete(hidden, feed.Name)
+	}
+
+	res.Header().Set("Content-Type", metrics.ContentType)
+	res.Header().Add("Vary", "Authorization")
+	res.WriteHeader(http.StatusOK)
+	serverMetrics.WriteFunc(res, func(labels metrics.Labels) bool {
+		return !hidden[labels["feed"]]
+	})
 }
 
-func handleItemsRss(res http.ResponseWriter, req *http.Request, params martini.Params) {
-	handleItems(FeedRSS, res, req, params)
+// validBaseURL returns if the URL is an absolute http or https URL without a query
+func validBaseURL(value string) bool {
+	u, err := url.Parse(value)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+// checkOptions validates the ranges of the numeric options
+func checkOptions() error {
+	switch {
+	case opts.AllItems < 1:
+		return fmt.Errorf("--all-items must be at least 1")
+	case opts.CacheMaxAge < 0:
+		return fmt.Errorf("--cache-max-age must not be negative")
+	case opts.MaxIdleConns < 0:
+		return fmt.Errorf("--max-idle-conns must not be negative")
+	case opts.MaxOpenConns < 0:
+		return fmt.Errorf("--max-open-conns must not be negative")
+	case opts.DBConnectRetries < 0:
+		return fmt.Errorf("--db-connect-retries must not be negative")
+	case opts.DBConnectBackoff <= 0:
+		return fmt.Errorf("--db-connect-backoff must be positive")
+	case opts.Port < 1 || opts.Port > 65535:
+		return fmt.Errorf("--port must be between 1 and 65535")
+	case opts.RefreshTimeout <= 0:
+		return fmt.Errorf("--refresh-timeout must be positive")
+	case opts.WarnEmptyAfter < 0:
+		return fmt.Errorf("--warn-empty-after must not be negative")
+	case opts.AuthPassword != "" && opts.AuthUser == "":
+		return fmt.Errorf("--auth-password requires --auth-user")
+	case (opts.TLSCert == "") != (opts.TLSKey == ""):
+		return fmt.Errorf("--tls-cert and --tls-key must be used together")
+	case opts.TLSAuto && opts.TLSCert != "":
+		return fmt.Errorf("--tls-auto cannot be used with --tls-cert")
+	case opts.TLSAuto && len(opts.TLSHosts) == 0:
+		return fmt.Errorf("--tls-auto requires at least one --tls-host")
+	case opts.TLSHTTPPort > 65535:
+		return fmt.Errorf("--tls-http-port must be between 0 and 65535")
+	case opts.TLSAuto && opts.TLSHTTPPort == opts.Port:
+		return fmt.Errorf("--tls-http-port must differ from --port")
+	// without the challenges of the HTTP port Let's Encrypt can only reach the server via the TLS challenges of port 443
+	case opts.TLSAuto && opts.TLSHTTPPort == 0 && opts.Port != 443:
+		return fmt.Errorf("--tls-auto requires --port 443 if --tls-http-port is disabled")
+	case opts.MaxBodySize < 1:
+		return fmt.Errorf("--max-body-size must be positive")
+	case opts.RateBurst < 0:
+		return fmt.Errorf("--rate-burst must not be negative")
+	case opts.RateBurst != 0 && opts.RateLimit == "":
+		return fmt.Errorf("--rate-burst requires --rate-limit")
+	case opts.BaseURL != "" && !validBaseURL(opts.BaseURL):
+		return fmt.Errorf("--base-url must be an absolute http or https URL like https://example.com/feeds")
+	case opts.WebSubHub != "" && !validBaseURL(opts.WebSubHub):
+		return fmt.Errorf("--websub-hub must be an absolute http or https URL")
+	case opts.CORSCredentials && opts.CORSOrigins == "":
+		return fmt.Errorf("--cors-credentials requires --cors-origins")
+	}
+
+	return checkCORSOrigins()
 }
 
 func main() {
 	var err error
 
+	ctx := context.Background()
+
 	p := flags.NewNamedParser("feedme-server", flags.HelpFlag)
 	p.ShortDescription = "The feedme server"
 
@@ -224,23 +1138,58 @@ func main() {
 		os.Exit(ReturnOk)
 	}
 
-	if opts.MaxIdleConns < 0 {
-		opts.MaxIdleConns = 0
+	logger, err = logging.New(opts.LogFormat, opts.LogLevel, opts.LogFile)
+	if err != nil {
+		panic(err)
 	}
 
-	if opts.MaxOpenConns <= 0 {
-		opts.MaxOpenConns = 1
+	err = checkOptions()
+	if err != nil {
+		logger.Error(err.Error())
+
+		os.Exit(ReturnHelp)
 	}
 
-	db, err = backend.NewBackend("postgresql")
+	trustedProxies, err = parsePrefixes("--trusted-proxies", opts.TrustedProxies)
+	if err != nil {
+		logger.Error(err.Error())
+
+		os.Exit(ReturnHelp)
+	}
+
+	var limiter *rateLimiter
+	if opts.RateLimit != "" {
+		limiter, err = newRateLimiter(opts.RateLimit, opts.RateBurst, opts.RateLimitExempt)
+		if err != nil {
+			logger.Error(err.Error())
+
+			os.Exit(ReturnHelp)
+		}
+	}
+
+	if opts.SnippetsDir != "" {
+		err = transform.LoadSnippets(opts.SnippetsDir)
+		if err != nil {
+			logger.Error("cannot load snippets", "dir", opts.SnippetsDir, "error", err)
+
+			os.Exit(ReturnHelp)
+		}
+	}
+
+	db, err = backend.NewBackend(opts.Backend)
 	if err != nil {
 		panic(err)
 	}
 
 	params := backend.Parameters{
-		Spec:         opts.Spec,
-		MaxIdleConns: opts.MaxIdleConns,
-		MaxOpenConns: opts.MaxOpenConns,
+		Spec:            opts.Spec,
+		MaxIdleConns:    opts.MaxIdleConns,
+		MaxOpenConns:    opts.MaxOpenConns,
+		ConnMaxLifetime: opts.ConnMaxLifetime,
+		ConnMaxIdleTime: opts.ConnMaxIdleTime,
+		ConnectRetries:  opts.DBConnectRetries,
+		ConnectBackoff:  opts.DBConnectBackoff,
+		Log:             logger,
 	}
 
 	err = db.Init(params)
@@ -248,26 +1197,128 @@ func main() {
 		panic(err)
 	}
 
-	ma := martini.New()
+	if opts.InitDB {
+		err = db.InitSchema(ctx)
+		if err != nil {
+			panic(err)
+		}
 
-	if opts.Logging {
-		ma.Use(martini.Logger())
+		os.Exit(ReturnOk)
 	}
-	ma.Use(martini.Recovery())
 
-	r := martini.NewRouter()
-	ma.Action(r.Handle)
+	if opts.Migrate {
+		from, _, err := db.SchemaVersion(ctx)
+		if err != nil {
+			panic(err)
+		}
+
+		err = db.Migrate(ctx)
+		if err != nil {
+			panic(err)
+		}
+
+		to, _, err := db.SchemaVersion(ctx)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Migrated database schema from version %d to %d\n", from, to)
+
+		os.Exit(ReturnOk)
+	}
+
+	err = db.CheckSchema(ctx)
+	if err != nil {
+		if errors.Is(err, backend.ErrSchemaMissing) {
+			logger.Error("please initialize the database with --init-db", "error", err)
+		} else if errors.Is(err, backend.ErrSchemaOutdated) {
+			logger.Error("please migrate the database with --migrate", "error", err)
+		} else {
+			logger.Error("unusable database schema", "error", err)
+		}
 
-	m := martini.ClassicMartini{
-		Martini: ma,
-		Router:  r,
+		os.Exit(ReturnSchemaError)
 	}
 
-	m.Get("/", handleFeeds)
-	m.Get("/:feed/atom", handleItemsAtom)
-	m.Get("/:feed/rss", handleItemsRss)
+	crawlerOptions := crawler.DefaultOptions
+	crawlerOptions.MediaDir = opts.MediaDir
 
-	http.ListenAndServe(fmt.Sprintf(":%d", opts.Port), m)
+	feedCrawler = crawler.New(db, crawlerOptions)
+	events = listenEvents(ctx)
+
+	// middlewares are wrapped from the inside out, i.e. the logging sees a request first and the probes skip the authentication and the rate limit
+	var handler http.Handler = newRouter()
+	if opts.AuthUser != "" {
+		handler = basicAuth(handler)
+	}
+	handler = compressResponse(handler)
+	handler = limitBody(handler)
+	if limiter != nil {
+		handler = limiter.limit(handler)
+	}
+	if origins := corsOrigins(); len(origins) != 0 {
+		handler = handleCORS(origins, handler)
+	}
+	handler = handleProbes(handler)
+	handler = recoverPanic(handler)
+	if opts.Logging {
+		handler = logRequest(handler)
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", opts.Port),
+		Handler: handler,
+	}
+
+	if opts.TLSAuto {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.TLSHosts...),
+			Cache:      autocert.DirCache(opts.TLSCache),
+		}
+
+		server.TLSConfig = manager.TLSConfig()
+
+		if opts.TLSHTTPPort != 0 {
+			challenges := &http.Server{
+				Addr:    fmt.Sprintf(":%d", opts.TLSHTTPPort),
+				Handler: manager.HTTPHandler(nil),
+			}
+
+			go func() {
+				err := challenges.ListenAndServe()
+				if err != nil {
+					logger.Error("cannot serve certificate challenges", "address", challenges.Addr, "error", err)
+
+					os.Exit(ReturnServerError)
+				}
+			}()
+		}
+
+		err = server.ListenAndServeTLS("", "")
+	} else if opts.TLSCert != "" {
+		var certificate *certificateLoader
+
+		certificate, err = newCertificateLoader(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			panic(err)
+		}
+
+		certificate.ReloadOnSignal()
+
+		server.TLSConfig = &tls.Config{
+			GetCertificate: certificate.GetCertificate,
+		}
+
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		logger.Error("cannot serve", "address", server.Addr, "error", err)
+
+		os.Exit(ReturnServerError)
+	}
 
 	os.Exit(ReturnOk)
 }
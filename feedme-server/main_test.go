@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/metrics"
+)
+
+func TestCheckFeedToken(t *testing.T) {
+	testOptions(t)
+
+	private := &feedme.Feed{Name: "secret", Token: testFeedToken}
+	public := &feedme.Feed{Name: "news"}
+
+	for _, tc := range []struct {
+		name   string
+		feed   *feedme.Feed
+		path   string
+		header http.Header
+		ok     bool
+	}{
+		{"public feed", public, "/news/atom", nil, true},
+		{"public feed with any token", public, "/news/atom?token=wrong", nil, true},
+		{"missing token", private, "/secret/atom", nil, false},
+		{"wrong token", private, "/secret/atom?token=wrong", nil, false},
+		{"prefix of token", private, "/secret/atom?token=" + testFeedToken[:4], nil, false},
+		{"admin token", private, "/secret/atom?token=" + testAdminToken, nil, false},
+		{"wrong bearer token", private, "/secret/atom", http.Header{"Authorization": {"Bearer wrong"}}, false},
+		{"token of other scheme", private, "/secret/atom", http.Header{"Authorization": {"Basic " + testFeedToken}}, false},
+		{"correct token", private, "/secret/atom?token=" + testFeedToken, nil, true},
+		{"correct bearer token", private, "/secret/atom", http.Header{"Authorization": {"Bearer " + testFeedToken}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			res := httptest.NewRecorder()
+
+			ok := checkFeedToken(res, req, tc.feed)
+			if ok != tc.ok {
+				t.Fatalf("expected %t, got %t", tc.ok, ok)
+			}
+
+			if ok {
+				if res.Code != http.StatusOK || res.Body.Len() != 0 {
+					t.Errorf("expected no response, got %d: %s", res.Code, res.Body.String())
+				}
+			} else if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), `feed \"secret\" needs a valid token`) {
+				t.Errorf("expected 403, got %d: %s", res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	testOptions(t)
+
+	opts.AuthUser = "user"
+	opts.AuthPassword = "password"
+
+	handler := basicAuth(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("served"))
+	}))
+
+	for _, tc := range []struct {
+		name     string
+		user     string
+		password string
+		// auth sets the credentials
+		auth   bool
+		status int
+	}{
+		{"missing credentials", "", "", false, http.StatusUnauthorized},
+		{"empty credentials", "", "", true, http.StatusUnauthorized},
+		{"wrong user", "other", "password", true, http.StatusUnauthorized},
+		{"wrong password", "user", "wrong", true, http.StatusUnauthorized},
+		{"swapped credentials", "password", "user", true, http.StatusUnauthorized},
+		{"prefix of password", "user", "pass", true, http.StatusUnauthorized},
+		{"correct credentials", "user", "password", true, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.auth {
+				req.SetBasicAuth(tc.user, tc.password)
+			}
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			if res.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, res.Code)
+			}
+
+			if tc.status == http.StatusOK {
+				if res.Body.String() != "served" {
+					t.Errorf("expected the request to be served, got %s", res.Body.String())
+				}
+			} else {
+				if res.Header().Get("WWW-Authenticate") != `Basic realm="feedme"` {
+					t.Errorf("expected a WWW-Authenticate header, got %q", res.Header().Get("WWW-Authenticate"))
+				}
+				if strings.Contains(res.Body.String(), "served") {
+					t.Errorf("expected the request not to be served")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleFeedsPrivate(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	r := newRouter()
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{"without token", "/", []string{"category", "media", "news"}},
+		{"wrong token", "/?token=wrong", []string{"category", "media", "news"}},
+		{"feed token", "/?token=" + testFeedToken, []string{"category", "media", "news", "secret"}},
+		{"admin token", "/?token=" + testAdminToken, []string{"category", "media", "news", "secret"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(r, "GET", tc.path, jsonHeader)
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", res.Code, res.Body.String())
+			}
+
+			var summaries []feedSummary
+			err := json.Unmarshal(res.Body.Bytes(), &summaries)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, summary := range summaries {
+				names = append(names, summary.Name)
+			}
+			sort.Strings(names)
+
+			if strings.Join(names, " ") != strings.Join(tc.expected, " ") {
+				t.Errorf("expected the feeds %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestHandleMetricsPrivate(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	saved := serverMetrics
+	t.Cleanup(func() {
+		serverMetrics = saved
+	})
+	serverMetrics = metrics.NewRegistry()
+
+	r := newRouter()
+
+	// count requests of the private feed
+	serve(r, "GET", "/secret/atom?token="+testFeedToken, nil)
+	serve(r, "GET", "/secret/atom", nil)
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		private bool
+	}{
+		{"without token", "/metrics", false},
+		{"wrong token", "/metrics?token=wrong", false},
+		{"feed token", "/metrics?token=" + testFeedToken, true},
+		{"admin token", "/metrics?token=" + testAdminToken, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(r, "GET", tc.path, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", res.Code, res.Body.String())
+			}
+
+			body := res.Body.String()
+
+			if !strings.Contains(body, `feedme_server_feed_items{feed="news"} 2`) {
+				t.Errorf("expected the items of the public feed, got %s", body)
+			}
+			if !strings.Contains(body, `feedme_server_request_duration_seconds_count{route="/:feed/atom"} 2`) {
+				t.Errorf("expected the samples without feeds, got %s", body)
+			}
+
+			if strings.Contains(body, `feed="secret"`) != tc.private {
+				t.Errorf("expected samples of the private feed to be included %t, got %s", tc.private, body)
+			}
+		})
+	}
+}
+
+func TestHandleItemsNotModified(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	opts.CacheMaxAge = 60
+
+	r := newRouter()
+
+	first := serve(r, "GET", "/news/atom", nil)
+	etag := first.Header().Get("ETag")
+	modified := first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || modified == "" {
+		t.Fatalf("expected 200 with an ETag and a Last-Modified header, got %d with %q and %q", first.Code, etag, modified)
+	}
+	if cache := first.Header().Get("Cache-Control"); cache != "max-age=60" {
+		t.Errorf("expected the Cache-Control header of --cache-max-age, got %q", cache)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"ETag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"list of ETags", http.Header{"If-None-Match": {`W/"other", ` + etag}}, http.StatusNotModified},
+		{"any ETag", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"other ETag", http.Header{"If-None-Match": {`W/"other"`}}, http.StatusOK},
+		{"Last-Modified", http.Header{"If-Modified-Since": {modified}}, http.StatusNotModified},
+		{"older Last-Modified", http.Header{"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"}}, http.StatusOK},
+		// the ETag takes precedence
+		{"other ETag and Last-Modified", http.Header{"If-None-Match": {`W/"other"`}, "If-Modified-Since": {modified}}, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(r, "GET", "/news/atom", tc.header)
+			if res.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, res.Code)
+			}
+
+			if tc.status == http.StatusNotModified && res.Body.Len() != 0 {
+				t.Errorf("expected no body, got %s", res.Body.String())
+			}
+			if res.Header().Get("ETag") != etag {
+				t.Errorf("expected the ETag %s, got %s", etag, res.Header().Get("ETag"))
+			}
+		})
+	}
+
+	// an edited item changes neither the newest ID nor the count of the items but their modification time
+	time.Sleep(time.Millisecond)
+
+	feed, err := db.FindFeed(context.Background(), "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, updated, err := db.CreateItems(context.Background(), feed, []feedme.Item{
+		{GUID: "news/First", Title: "First edited", URI: "/first"},
+		{GUID: "news/Second", Title: "Second", URI: "/second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated) != 1 {
+		t.Fatalf("expected 1 updated item, got %d", len(updated))
+	}
+
+	edited := serve(r, "GET", "/news/atom", http.Header{"If-None-Match": {etag}})
+	if edited.Code != http.StatusOK || !strings.Contains(edited.Body.String(), "First edited") {
+		t.Fatalf("expected 200 with the edited item, got %d: %s", edited.Code, edited.Body.String())
+	}
+
+	editedETag := edited.Header().Get("ETag")
+	if editedETag == "" || editedETag == etag {
+		t.Fatalf("expected a new ETag, got %q", editedETag)
+	}
+
+	res := serve(r, "GET", "/news/atom", http.Header{"If-None-Match": {editedETag}})
+	if res.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the new ETag, got %d", res.Code)
+	}
+
+	// the ETags depend on the items, the RSS variant of the same items has the same ETag
+	res = serve(r, "GET", "/news/rss", http.Header{"If-None-Match": {editedETag}})
+	if res.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the RSS variant of the same items, got %d", res.Code)
+	}
+}
+
+func TestHandleFeedsNotModified(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	r := newRouter()
+
+	first := serve(r, "GET", "/", jsonHeader)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d with %q", first.Code, etag)
+	}
+
+	res := serve(r, "GET", "/", http.Header{"Accept": {"application/json"}, "If-None-Match": {etag}})
+	if res.Code != http.StatusNotModified || res.Body.Len() != 0 {
+		t.Fatalf("expected 304 without a body, got %d: %s", res.Code, res.Body.String())
+	}
+
+	// the HTML page has its own ETag
+	res = serve(r, "GET", "/", http.Header{"If-None-Match": {etag}})
+	if res.Code != http.StatusOK {
+		t.Errorf("expected 200 for the HTML page, got %d", res.Code)
+	}
+
+	// a new feed changes the ETag
+	testFeedItems(t, &feedme.Feed{Name: "later", URL: "http://example.com/later", Enabled: true}, "Later")
+
+	res = serve(r, "GET", "/", http.Header{"Accept": {"application/json"}, "If-None-Match": {etag}})
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"name":"later"`) {
+		t.Fatalf("expected 200 with the new feed, got %d: %s", res.Code, res.Body.String())
+	}
+	if res.Header().Get("ETag") == etag {
+		t.Errorf("expected a new ETag")
+	}
+}
+
+func TestCheckOptionsTLSAuto(t *testing.T) {
+	testOptions(t)
+
+	opts.MaxBodySize = 1
+	opts.TLSAuto = true
+	opts.TLSHosts = []string{"feeds.example.com"}
+
+	for _, tc := range []struct {
+		name     string
+		port     uint
+		httpPort uint
+		expected string
+	}{
+		{"challenges on port 80", 9090, 80, ""},
+		{"challenges on other port", 9090, 8080, ""},
+		{"TLS challenges on port 443", 443, 0, ""},
+		{"no challenges", 9090, 0, "--tls-auto requires --port 443 if --tls-http-port is disabled"},
+		{"same ports", 8080, 8080, "--tls-http-port must differ from --port"},
+		{"invalid port", 443, 65536, "--tls-http-port must be between 0 and 65535"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts.Port = tc.port
+			opts.TLSHTTPPort = tc.httpPort
+
+			err := checkOptions()
+			if tc.expected == "" && err != nil {
+				t.Errorf("expected valid options, got %v", err)
+			} else if tc.expected != "" && (err == nil || err.Error() != tc.expected) {
+				t.Errorf("expected the error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckOptionsDBConnectBackoff(t *testing.T) {
+	testOptions(t)
+
+	opts.MaxBodySize = 1
+	opts.Port = 9090
+
+	for _, tc := range []struct {
+		backoff  time.Duration
+		expected string
+	}{
+		{-time.Second, "--db-connect-backoff must be positive"},
+		{0, "--db-connect-backoff must be positive"},
+		{time.Millisecond, ""},
+		{time.Second, ""},
+	} {
+		opts.DBConnectBackoff = tc.backoff
+
+		err := checkOptions()
+		if tc.expected == "" && err != nil {
+			t.Errorf("expected the backoff %s to be valid, got %v", tc.backoff, err)
+		} else if tc.expected != "" && (err == nil || err.Error() != tc.expected) {
+			t.Errorf("expected the error %q for the backoff %s, got %v", tc.expected, tc.backoff, err)
+		}
+	}
+}
+
+func TestHandleItemsHiddenSource(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	const source = "https://example.com/private/feed?token=secret"
+
+	// items stored before their links were made absolute by the crawler keep relative links
+	feed := &feedme.Feed{Name: "hidden", URL: source, Enabled: true, HideSource: true}
+	err := db.CreateFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = db.CreateItems(context.Background(), feed, []feedme.Item{
+		{GUID: "1", Title: "Relative", URI: "article/1", Enclosure: feedme.Enclosure{URL: "audio/1.mp3", Type: "audio/mpeg"}},
+		{GUID: "2", Title: "Root relative", URI: "/article/2"},
+		{GUID: "3", Title: "Empty", URI: ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRouter()
+
+	for _, path := range []string{"/hidden/atom", "/hidden/rss", "/hidden/items", "/hidden/item/6", "/hidden/html", "/search?q=relative", "/all/atom"} {
+		t.Run(path, func(t *testing.T) {
+			res := serve(r, "GET", path, nil)
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", res.Code, res.Body.String())
+			}
+
+			body := res.Body.String()
+			for _, hidden := range []string{source, "/private", "secret"} {
+				if strings.Contains(body, hidden) {
+					t.Errorf("expected the hidden source %q not to be exposed, got %s", hidden, body)
+				}
+			}
+		})
+	}
+
+	res := serve(r, "GET", "/hidden/rss", nil)
+	if !strings.Contains(res.Body.String(), "https://example.com/article/1") {
+		t.Errorf("expected the links to be resolved against the host of the source, got %s", res.Body.String())
+	}
+}
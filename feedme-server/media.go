@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/crawler"
+)
+
+// mediaCacheControl lets clients cache media files forever
+const mediaCacheControl = "public, max-age=31536000, immutable"
+
+// mediaURL returns the URL of the cached media file on the server
+func mediaURL(req *http.Request, media string) string {
+	return baseURL(req) + "media/" + media
+}
+
+// cachedImage points the enclosure and the description of the item to the cached image of the item on the server instead of its source, if --media-dir serves cached images
+func cachedImage(req *http.Request, item *feedme.Item) {
+	if opts.MediaDir == "" || item.Media == "" || item.Image == "" {
+		return
+	}
+
+	u := mediaURL(req, item.Media)
+
+	if item.Enclosure.URL == item.Image {
+		item.Enclosure.URL = u
+	}
+
+	// the links of descriptions are absolute and their attributes may be escaped
+	item.Description = strings.ReplaceAll(item.Description, item.Image, u)
+	if escaped := html.EscapeString(item.Image); escaped != item.Image {
+		item.Description = strings.ReplaceAll(item.Description, escaped, html.EscapeString(u))
+	}
+}
+
+// cachedImages points the items to their cached images
+func cachedImages(req *http.Request, items []feedme.Item) {
+	for i := range items {
+		cachedImage(req, &items[i])
+	}
+}
+
+func handleMedia(res http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("hash")
+	if opts.MediaDir == "" || !crawler.IsMediaFile(name) {
+		writeError(res, http.StatusNotFound, fmt.Sprintf("media %q not found", name))
+
+		return
+	}
+
+	f, err := os.Open(filepath.Join(opts.MediaDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		writeError(res, http.StatusNotFound, fmt.Sprintf("media %q not found", name))
+
+		return
+	} else if checkError(res, req, err) {
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if checkError(res, req, err) {
+		return
+	}
+
+	// the names of media files are the hashes of their contents
+	res.Header().Set("Cache-Control", mediaCacheControl)
+	res.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(name)))
+	res.Header().Set("ETag", `"`+strings.TrimSuffix(name, filepath.Ext(name))+`"`)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(res, req, name, stat.ModTime(), f)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweep is the interval of removing the buckets of clients which have not been seen for long enough to refill
+const rateLimitSweep = time.Minute
+
+// trustedProxies holds the networks of --trusted-proxies whose X-Forwarded-For headers are used to find the client of a request
+var trustedProxies []netip.Prefix
+
+// rateLimiter limits the requests of every client IP with a token bucket
+type rateLimiter struct {
+	rate   float64 // tokens per second
+	burst  float64
+	exempt []netip.Prefix
+
+	lock    sync.Mutex
+	buckets map[netip.Addr]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// parseRateLimit parses a rate limit like 60/m, 10/s or 1000/h into the count of requests and their period
+func parseRateLimit(value string) (int, time.Duration, error) {
+	count, unit, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate limit %q must be given as count/unit like 60/m", value)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 1 {
+		return 0, 0, fmt.Errorf("count of the rate limit %q must be a positive number", value)
+	}
+
+	var period time.Duration
+	switch strings.TrimSpace(unit) {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return 0, 0, fmt.Errorf("unit of the rate limit %q must be s, m or h", value)
+	}
+
+	return n, period, nil
+}
+
+// parsePrefixes parses the networks of an argument given as CIDRs like 10.0.0.0/8 or single IPs
+func parsePrefixes(name string, values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+
+			if prefix, err := netip.ParsePrefix(v); err == nil {
+				prefixes = append(prefixes, prefix.Masked())
+			} else if addr, err := netip.ParseAddr(v); err == nil {
+				addr = addr.Unmap()
+
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			} else {
+				return nil, fmt.Errorf("%s holds the invalid network %q", name, v)
+			}
+		}
+	}
+
+	return prefixes, nil
+}
+
+// containsAddr returns if one of the networks holds the address
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fromTrustedProxy returns if the request comes from one of the networks of --trusted-proxies
+func fromTrustedProxy(req *http.Request) bool {
+	addr, ok := remoteAddr(req)
+
+	return ok && containsAddr(trustedProxies, addr)
+}
+
+// remoteAddr returns the IP of the connection of the request
+func remoteAddr(req *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
+
+// clientIP returns the IP of the client of the request
+func clientIP(req *http.Request) (netip.Addr, bool) {
+	addr, ok := remoteAddr(req)
+	if !ok || !containsAddr(trustedProxies, addr) {
+		return addr, ok
+	}
+
+	// the client is the last address of the header which is not a trusted proxy
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		a = a.Unmap()
+
+		addr = a
+		if !containsAddr(trustedProxies, a) {
+			break
+		}
+	}
+
+	return addr, true
+}
+
+// newRateLimiter returns a rate limiter for the rate limit of --rate-limit with the burst of --rate-burst, which defaults to the count of the rate limit, and the exempted networks of --rate-limit-exempt
+func newRateLimiter(limit string, burst int, exempt []string) (*rateLimiter, error) {
+	n, period, err := parseRateLimit(limit)
+	if err != nil {
+		return nil, fmt.Errorf("--rate-limit: %s", err.Error())
+	}
+
+	if burst == 0 {
+		burst = n
+	}
+
+	prefixes, err := parsePrefixes("--rate-limit-exempt", exempt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateLimiter{
+		rate:    float64(n) / period.Seconds(),
+		burst:   float64(burst),
+		exempt:  prefixes,
+		buckets: make(map[netip.Addr]*bucket),
+	}, nil
+}
+
+// take takes a token of the bucket of the address and returns if the request is allowed with the time until the next token
+func (l *rateLimiter) take(addr netip.Addr, now time.Time) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.swept) > rateLimitSweep {
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for a, b := range l.buckets {
+			if now.Sub(b.last) > full {
+				delete(l.buckets, a)
+			}
+		}
+
+		l.swept = now
+	}
+
+	b, ok := l.buckets[addr]
+	if !ok {
+		b = &bucket{
+			tokens: l.burst,
+			last:   now,
+		}
+
+		l.buckets[addr] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// limit answers requests of clients which exceed the rate limit with 429 and a Retry-After header
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if addr, ok := clientIP(req); ok && !containsAddr(l.exempt, addr) {
+			if allowed, wait := l.take(addr, time.Now()); !allowed {
+				serverMetrics.Add("feedme_server_rate_limited_total", "Count of requests which were denied by the rate limit", nil, 1)
+
+				res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(res, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+
+				return
+			}
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// limitBody answers requests of mutating methods whose body is bigger than --max-body-size with 413 and limits the reading of their bodies
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" && req.Method != "OPTIONS" {
+			if req.ContentLength > opts.MaxBodySize {
+				writeError(res, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+
+				return
+			}
+
+			req.Body = http.MaxBytesReader(res, req.Body, opts.MaxBodySize)
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/crawler"
+)
+
+var feedCrawler *crawler.Crawler
+
+// refresh represents a running crawl of a feed which is shared by all concurrent refresh requests of the feed
+type refresh struct {
+	done   chan struct{}
+	result crawler.Result
+}
+
+var refreshLock sync.Mutex
+var refreshes = make(map[string]*refresh)
+
+// refreshUnlock releases the crawler lock of the database which the running refreshes share
+var refreshUnlock func()
+
+// refreshResult represents the response of a finished refresh
+type refreshResult struct {
+	Feed          string        `json:"feed"`
+	ItemsFound    int           `json:"items_found"`
+	ItemsInserted int           `json:"items_inserted"`
+	Duration      time.Duration `json:"duration"`
+}
+
+// refreshFeed starts a crawl of the feed or returns the already running crawl of the feed
+func refreshFeed(feed *feedme.Feed) (*refresh, error) {
+	refreshLock.Lock()
+	defer refreshLock.Unlock()
+
+	if r, ok := refreshes[feed.Name]; ok {
+		return r, nil
+	}
+
+	if len(refreshes) == 0 {
+		// the first running refresh does not wait for the crawler lock, backend.ErrLocked is returned while the feedme crawler holds it
+		unlock, err := db.LockCrawler(context.Background(), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// the lock keeps the refreshes from overlapping with runs of the feedme crawler
+		refreshUnlock = unlock
+	}
+
+	r := &refresh{
+		done: make(chan struct{}),
+	}
+	refreshes[feed.Name] = r
+
+	go func() {
+		r.result = feedCrawler.Crawl(context.Background(), feed, logger.With("feed", feed.Name))
+
+		refreshLock.Lock()
+		delete(refreshes, feed.Name)
+		if len(refreshes) == 0 {
+			refreshUnlock()
+			refreshUnlock = nil
+		}
+		refreshLock.Unlock()
+
+		close(r.done)
+	}()
+
+	return r, nil
+}
+
+// isAdmin returns if the request holds the token of --admin-token
+func isAdmin(req *http.Request) bool {
+	return opts.AdminToken != "" && subtle.ConstantTimeCompare([]byte(requestToken(req)), []byte(opts.AdminToken)) == 1
+}
+
+// checkAdminToken answers with 403 and returns false if the request does not hold the token of --admin-token
+func checkAdminToken(res http.ResponseWriter, req *http.Request) bool {
+	if opts.AdminToken == "" {
+		writeError(res, http.StatusForbidden, "the request needs an --admin-token")
+
+		return false
+	}
+
+	if !isAdmin(req) {
+		writeError(res, http.StatusForbidden, "the request needs a valid admin token")
+
+		return false
+	}
+
+	return true
+}
+
+func handleRefresh(res http.ResponseWriter, req *http.Request) {
+	if !checkAdminToken(res, req) {
+		return
+	}
+
+	feed, err := db.FindFeed(req.Context(), req.PathValue("feed"))
+	if checkError(res, req, err) {
+		return
+	}
+
+	r, err := refreshFeed(feed)
+	if errors.Is(err, backend.ErrLocked) {
+		writeError(res, http.StatusConflict, fmt.Sprintf("refresh of feed %q is skipped while the feedme crawler is running", feed.Name))
+
+		return
+	} else if checkError(res, req, err) {
+		return
+	}
+
+	select {
+	case <-r.done:
+	case <-time.After(opts.RefreshTimeout):
+		writeError(res, http.StatusGatewayTimeout, fmt.Sprintf("refresh of feed %q is still running", feed.Name))
+
+		return
+	}
+
+	if r.result.Err != nil {
+		writeError(res, http.StatusBadGateway, r.result.Err.Error())
+
+		return
+	}
+
+	data, err := json.Marshal(refreshResult{
+		Feed:          r.result.Feed,
+		ItemsFound:    r.result.ItemsFound,
+		ItemsInserted: r.result.ItemsInserted,
+		Duration:      r.result.Duration,
+	})
+	if checkError(res, req, err) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
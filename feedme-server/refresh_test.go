@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+	"github.com/zimmski/feedme/crawler"
+)
+
+// testRefreshFeed sets up a crawler for the feed slow whose page is answered once the returned release channel is closed
+func testRefreshFeed(t *testing.T) (chan struct{}, chan struct{}) {
+	requested := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		select {
+		// the requested channel receives a value when the page is requested
+		case requested <- struct{}{}:
+		default:
+		}
+		<-release
+
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(res, `<html><body><div class="item"><a href="/a">A</a></div></body></html>`)
+	}))
+	t.Cleanup(server.Close)
+
+	saved := feedCrawler
+	t.Cleanup(func() {
+		feedCrawler = saved
+	})
+
+	options := crawler.DefaultOptions
+	options.IgnoreRobots = true
+	feedCrawler = crawler.New(db, options)
+
+	err := db.CreateFeed(context.Background(), &feedme.Feed{
+		Name: "slow",
+		URL:  server.URL + "/slow",
+		Transform: `{
+			"items": [{"search": "div.item", "do": [{"find": "a", "do": [
+				{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+				{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+			]}]}],
+			"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+		}`,
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return requested, release
+}
+
+func TestHandleRefreshCrawlerLock(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	requested, release := testRefreshFeed(t)
+
+	r := newRouter()
+
+	// a running crawler skips the refresh
+	unlock, err := db.LockCrawler(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := serve(r, "POST", "/slow/refresh?token="+testAdminToken, nil)
+	if res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), "feedme crawler is running") {
+		t.Fatalf("expected 409 while the crawler is running, got %d: %s", res.Code, res.Body.String())
+	}
+
+	select {
+	case <-requested:
+		t.Fatal("expected the feed not to be crawled")
+	default:
+	}
+
+	unlock()
+
+	// a running refresh holds the lock until its crawl finishes
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(r, "POST", "/slow/refresh?token="+testAdminToken, nil)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the feed to be crawled")
+	}
+
+	_, err = db.LockCrawler(context.Background(), 0)
+	if !errors.Is(err, backend.ErrLocked) {
+		t.Errorf("expected the refresh to hold the crawler lock, got %v", err)
+	}
+
+	close(release)
+
+	res = <-done
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"items_inserted":1`) {
+		t.Fatalf("expected 200 with the inserted item, got %d: %s", res.Code, res.Body.String())
+	}
+
+	unlock, err = db.LockCrawler(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("expected the refresh to release the crawler lock, got %v", err)
+	}
+	unlock()
+}
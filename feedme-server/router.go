@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zimmski/feedme/crawler"
+)
+
+// statusWriter records the status code of a response for the logging and the metrics of requests
+type statusWriter struct {
+	http.ResponseWriter
+
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(data []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	return sw.ResponseWriter.Write(data)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// router dispatches the requests to the routes of the server
+type router struct {
+	// the category routes have their own mux since they and the item routes of feeds both match paths like /category/item/atom
+	categories *http.ServeMux
+	routes     *http.ServeMux
+	// media has its own mux as well since its route matches paths like /media/atom of the routes of feeds
+	media *http.ServeMux
+
+	// prefix is the path of --base-url which is stripped from the paths of requests
+	prefix string
+}
+
+func newRouter() *router {
+	r := &router{
+		categories: http.NewServeMux(),
+		routes:     http.NewServeMux(),
+		media:      http.NewServeMux(),
+		prefix:     basePath(),
+	}
+
+	r.media.HandleFunc("GET /media/{hash}", instrument("/media/:hash", handleMedia))
+
+	r.categories.HandleFunc("GET /category/{category}/atom", instrument("/category/:category/atom", handleCategoryItemsAtom))
+	r.categories.HandleFunc("GET /category/{category}/rss", instrument("/category/:category/rss", handleCategoryItemsRss))
+
+	r.routes.HandleFunc("GET /{$}", instrument("/", handleFeeds))
+	r.routes.HandleFunc("GET /all/atom", instrument("/all/atom", handleAllItemsAtom))
+	r.routes.HandleFunc("GET /all/rss", instrument("/all/rss", handleAllItemsRss))
+	r.routes.HandleFunc("GET /events", instrument("/events", handleAllEvents))
+	r.routes.HandleFunc("GET /metrics", handleMetrics)
+	r.routes.HandleFunc("GET /opml", instrument("/opml", handleOPML))
+	r.routes.HandleFunc("GET /search", instrument("/search", handleSearch))
+	r.routes.HandleFunc("GET /search/atom", instrument("/search/atom", handleSearchAtom))
+	r.routes.HandleFunc("GET /search/rss", instrument("/search/rss", handleSearchRss))
+	r.routes.HandleFunc("GET /style.css", handleStyle)
+	r.routes.HandleFunc("GET /{feed}/atom", instrument("/:feed/atom", handleItemsAtom))
+	r.routes.HandleFunc("GET /{feed}/events", instrument("/:feed/events", handleEvents))
+	r.routes.HandleFunc("GET /{feed}/html", instrument("/:feed/html", handleItemsHTML))
+	r.routes.HandleFunc("DELETE /{feed}/item/{id}", instrument("/:feed/item/:id", handleHideItem))
+	r.routes.HandleFunc("GET /{feed}/item/{id}", instrument("/:feed/item/:id", handleItem))
+	r.routes.HandleFunc("POST /{feed}/item/{id}/unhide", instrument("/:feed/item/:id/unhide", handleUnhideItem))
+	r.routes.HandleFunc("GET /{feed}/items", instrument("/:feed/items", handleItemsPage))
+	r.routes.HandleFunc("GET /{feed}/rss", instrument("/:feed/rss", handleItemsRss))
+	r.routes.HandleFunc("GET /{feed}/status", instrument("/:feed/status", handleStatus))
+	r.routes.HandleFunc("POST /{feed}/refresh", instrument("/:feed/refresh", handleRefresh))
+
+	return r
+}
+
+// strip returns the request with the path which the routes match
+func (r *router) strip(req *http.Request) *http.Request {
+	path := req.URL.Path
+
+	// routes match with and without the prefix
+	if r.prefix != "" && (path == r.prefix || strings.HasPrefix(path, r.prefix+"/")) {
+		path = path[len(r.prefix):]
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	// routes match with and without a trailing slash
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	if path == req.URL.Path {
+		return req
+	}
+
+	u := *req.URL
+	u.Path = path
+	u.RawPath = ""
+
+	req = req.Clone(req.Context())
+	req.URL = &u
+
+	return req
+}
+
+func (r *router) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	req = r.strip(req)
+
+	// only the paths of media files are media routes so that a feed named media keeps working
+	if name, ok := strings.CutPrefix(req.URL.Path, "/media/"); ok && crawler.IsMediaFile(name) {
+		r.media.ServeHTTP(res, req)
+
+		return
+	}
+
+	// the category routes only have GET patterns, matching their paths as GET lets the categories mux answer other methods with 405
+	// category routes win the paths of item routes of feeds
+	match := *req
+	match.Method = http.MethodGet
+	if _, pattern := r.categories.Handler(&match); pattern != "" {
+		r.categories.ServeHTTP(res, req)
+
+		return
+	}
+
+	r.routes.ServeHTTP(res, req)
+}
+
+// recoverPanic answers requests whose handlers panic with 500 and logs the panic with its stack trace
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{
+			ResponseWriter: res,
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+
+				logger.Error("panic while handling request", "method", req.Method, "path", req.URL.Path, "error", crawler.NewPanicError(r))
+
+				if sw.status == 0 {
+					writeError(sw, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				}
+			}
+		}()
+
+		next.ServeHTTP(sw, req)
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// testAdminToken is the --admin-token of the tests
+const testAdminToken = "admin-token"
+
+// testFeedToken is the token of the private feed secret of testBackend
+const testFeedToken = "feed-token"
+
+// testMedia is the name of the cached image of testBackend
+const testMedia = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.png"
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	os.Exit(m.Run())
+}
+
+// testOptions sets the defaults of the options which the handlers need and restores the options after the test
+func testOptions(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() {
+		opts = saved
+	})
+
+	opts.AdminToken = testAdminToken
+	opts.AllItems = 50
+	opts.Backend = "memory"
+	opts.DBConnectBackoff = time.Second
+	opts.ItemLinks = "source"
+	opts.RefreshTimeout = time.Minute
+	opts.WarnEmptyAfter = 3
+}
+
+// testBackend replaces the backend with a memory backend of test feeds and restores it after the test
+func testBackend(t *testing.T) backend.Backend {
+	savedDB, savedEvents := db, events
+	t.Cleanup(func() {
+		db, events = savedDB, savedEvents
+	})
+
+	db = backend.NewBackendMemory()
+	events = listenEvents(context.Background())
+
+	for _, f := range []struct {
+		feed   feedme.Feed
+		titles []string
+	}{
+		{feedme.Feed{Name: "news", URL: "http://example.com/news", Category: "tech", Enabled: true}, []string{"First", "Second"}},
+		{feedme.Feed{Name: "secret", URL: "http://example.com/secret", Enabled: true, Token: testFeedToken}, []string{"Classified"}},
+		{feedme.Feed{Name: "media", URL: "http://example.com/media", Enabled: true}, []string{"Picture"}},
+		{feedme.Feed{Name: "category", URL: "http://example.com/category", Enabled: true}, []string{"Categorized"}},
+	} {
+		testFeedItems(t, &f.feed, f.titles...)
+	}
+
+	return db
+}
+
+// testFeedItems creates the feed with one item per title
+func testFeedItems(t *testing.T, feed *feedme.Feed, titles ...string) []feedme.Item {
+	t.Helper()
+
+	err := db.CreateFeed(context.Background(), feed)
+	if err != nil {
+		t.Fatalf("cannot create feed %s: %v", feed.Name, err)
+	}
+
+	var items []feedme.Item
+	for _, title := range titles {
+		items = append(items, feedme.Item{
+			GUID:  feed.Name + "/" + title,
+			Title: title,
+			URI:   "/" + strings.ToLower(title),
+		})
+	}
+
+	items, _, err = db.CreateItems(context.Background(), feed, items)
+	if err != nil {
+		t.Fatalf("cannot create items of feed %s: %v", feed.Name, err)
+	}
+
+	return items
+}
+
+// testMediaDir sets --media-dir to a directory with the cached image testMedia
+func testMediaDir(t *testing.T) {
+	opts.MediaDir = t.TempDir()
+
+	err := os.WriteFile(filepath.Join(opts.MediaDir, testMedia), []byte("\x89PNG\r\n\x1a\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve answers the request with the handler and returns the recorded response
+func serve(handler http.Handler, method string, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	return res
+}
+
+var jsonHeader = http.Header{"Accept": {"application/json"}}
+
+func TestRouter(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+	testMediaDir(t)
+
+	r := newRouter()
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		status int
+		// body is a part of the expected body which identifies the handler
+		body string
+	}{
+		{"feeds JSON", "GET", "/", jsonHeader, http.StatusOK, `"name":"news"`},
+		{"feeds HTML", "GET", "/", nil, http.StatusOK, "<html"},
+		{"all atom", "GET", "/all/atom", nil, http.StatusOK, "<feed"},
+		{"all rss", "GET", "/all/rss", nil, http.StatusOK, "<rss"},
+		{"all events", "GET", "/events", nil, http.StatusNotImplemented, "does not support event streams"},
+		{"metrics", "GET", "/metrics", nil, http.StatusOK, "feedme_server_feed_items"},
+		{"opml", "GET", "/opml", nil, http.StatusOK, "<opml"},
+		{"search", "GET", "/search?q=first", nil, http.StatusOK, `"title":"news: First"`},
+		{"search without query", "GET", "/search", nil, http.StatusBadRequest, "search needs a q parameter"},
+		{"search atom", "GET", "/search/atom?q=first", nil, http.StatusOK, "<feed"},
+		{"search rss", "GET", "/search/rss?q=first", nil, http.StatusOK, "<rss"},
+		{"style", "GET", "/style.css", nil, http.StatusOK, "{"},
+		{"feed atom", "GET", "/news/atom", nil, http.StatusOK, "<feed"},
+		{"feed rss", "GET", "/news/rss", nil, http.StatusOK, "<rss"},
+		{"feed events", "GET", "/news/events", nil, http.StatusNotImplemented, "does not support event streams"},
+		{"feed html", "GET", "/news/html", nil, http.StatusOK, "Second"},
+		{"feed items", "GET", "/news/items", nil, http.StatusOK, `"title":"Second"`},
+		{"feed status", "GET", "/news/status", nil, http.StatusOK, `"feed":"news"`},
+		{"item", "GET", "/news/item/1", nil, http.StatusOK, `"title":"First"`},
+		{"hide item", "DELETE", "/news/item/2?token=" + testAdminToken, nil, http.StatusNoContent, ""},
+		{"unhide item", "POST", "/news/item/2/unhide?token=" + testAdminToken, nil, http.StatusNoContent, ""},
+		{"refresh without token", "POST", "/news/refresh", nil, http.StatusForbidden, "needs a valid admin token"},
+		{"category atom", "GET", "/category/tech/atom", nil, http.StatusOK, "category: tech"},
+		{"category rss", "GET", "/category/tech/rss", nil, http.StatusOK, "category: tech"},
+		{"media", "GET", "/media/" + testMedia, nil, http.StatusOK, "PNG"},
+
+		{"trailing slash", "GET", "/news/atom/", nil, http.StatusOK, "<feed"},
+		{"private feed without token", "GET", "/secret/atom", nil, http.StatusForbidden, "needs a valid token"},
+		{"private feed with token", "GET", "/secret/atom?token=" + testFeedToken, nil, http.StatusOK, "Classified"},
+
+		{"unknown feed", "GET", "/unknown/atom", nil, http.StatusNotFound, "not found"},
+		{"unknown item", "GET", "/news/item/99", nil, http.StatusNotFound, "not found"},
+		{"unknown route of feed", "GET", "/news/unknown", nil, http.StatusNotFound, ""},
+		{"unknown path", "GET", "/a/b/c/d/e", nil, http.StatusNotFound, ""},
+		{"unknown category", "GET", "/category/unknown/atom", nil, http.StatusNotFound, `category \"unknown\" not found`},
+		{"unknown media", "GET", "/media/" + strings.Repeat("f", 64) + ".png", nil, http.StatusNotFound, "not found"},
+
+		{"POST of feed", "POST", "/news/atom", nil, http.StatusMethodNotAllowed, ""},
+		{"GET of refresh", "GET", "/news/refresh", nil, http.StatusMethodNotAllowed, ""},
+		{"PUT of item", "PUT", "/news/item/1", nil, http.StatusMethodNotAllowed, ""},
+		{"GET of unhide", "GET", "/news/item/1/unhide", nil, http.StatusMethodNotAllowed, ""},
+		{"POST of feeds", "POST", "/", nil, http.StatusMethodNotAllowed, ""},
+		{"POST of category", "POST", "/category/tech/atom", nil, http.StatusMethodNotAllowed, ""},
+
+		// routes of feeds whose names collide with the media and category routes
+		{"feed named media", "GET", "/media/atom", nil, http.StatusOK, "Picture"},
+		{"item of feed named media", "GET", "/media/item/4", nil, http.StatusOK, `"title":"Picture"`},
+		{"feed named category", "GET", "/category/atom", nil, http.StatusOK, "Categorized"},
+		{"item of feed named category", "GET", "/category/item/5", nil, http.StatusOK, `"title":"Categorized"`},
+		{"category route wins", "GET", "/category/item/atom", nil, http.StatusNotFound, `category \"item\" not found`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(r, tc.method, tc.path, tc.header)
+
+			if res.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, res.Code, res.Body.String())
+			}
+			if !strings.Contains(res.Body.String(), tc.body) {
+				t.Errorf("expected a body containing %q, got %s", tc.body, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouterBaseURL(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+	testMediaDir(t)
+
+	opts.BaseURL = "https://example.com/feeds/"
+
+	r := newRouter()
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/feeds", http.StatusOK, `"name":"news"`},
+		{"/feeds/", http.StatusOK, `"name":"news"`},
+		{"/feeds/news/atom", http.StatusOK, "<feed"},
+		{"/feeds/news/atom/", http.StatusOK, "<feed"},
+		{"/feeds/category/tech/rss", http.StatusOK, "category: tech"},
+		{"/feeds/media/" + testMedia, http.StatusOK, "PNG"},
+		{"/feeds/media/atom", http.StatusOK, "Picture"},
+		// routes match without the prefix as well, e.g. behind proxies which strip it
+		{"/", http.StatusOK, `"name":"news"`},
+		{"/news/atom", http.StatusOK, "<feed"},
+		{"/category/tech/rss", http.StatusOK, "category: tech"},
+		{"/media/" + testMedia, http.StatusOK, "PNG"},
+		// only whole path segments are stripped
+		{"/feedsnews/atom", http.StatusNotFound, `feed \"feedsnews\"`},
+		{"/feeds/unknown/atom", http.StatusNotFound, "not found"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			res := serve(r, "GET", tc.path, jsonHeader)
+
+			if res.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, res.Code, res.Body.String())
+			}
+			if !strings.Contains(res.Body.String(), tc.body) {
+				t.Errorf("expected a body containing %q, got %s", tc.body, res.Body.String())
+			}
+		})
+	}
+
+	// links point to the external URL with the prefix
+	res := serve(r, "GET", "/feeds", jsonHeader)
+	if !strings.Contains(res.Body.String(), `"atom":"https://example.com/feeds/news/atom"`) {
+		t.Errorf("expected links with the prefix, got %s", res.Body.String())
+	}
+}
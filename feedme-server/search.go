@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zimmski/feedme"
+	"github.com/zimmski/feedme/backend"
+)
+
+// searchDefaultLimit is the count of items of a search without a limit parameter
+const searchDefaultLimit = 50
+
+// parseSearchDate parses a date parameter of a search which is either a date or a RFC 3339 time
+func parseSearchDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// searchItems searches the items matching the parameters of the request
+func searchItems(res http.ResponseWriter, req *http.Request) (*backend.ItemQuery, []feedme.Item) {
+	var err error
+
+	params := req.URL.Query()
+
+	query := &backend.ItemQuery{
+		Query: strings.TrimSpace(params.Get("q")),
+		Limit: searchDefaultLimit,
+		Order: params.Get("order"),
+	}
+	if query.Query == "" {
+		// invalid requests are answered with an error and nil is returned as query
+		writeError(res, http.StatusBadRequest, "search needs a q parameter")
+
+		return nil, nil
+	}
+
+	switch query.Order {
+	case "":
+		query.Order = backend.ItemOrderDate
+	case backend.ItemOrderDate, backend.ItemOrderRank:
+	default:
+		writeError(res, http.StatusBadRequest, fmt.Sprintf("order parameter must be %s or %s", backend.ItemOrderDate, backend.ItemOrderRank))
+
+		return nil, nil
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"since", &query.Since},
+		{"until", &query.Until},
+	} {
+		if v := params.Get(p.name); v != "" {
+			*p.value, err = parseSearchDate(v)
+			if err != nil {
+				writeError(res, http.StatusBadRequest, fmt.Sprintf("%s parameter must be a date like 2006-01-02 or a RFC 3339 time", p.name))
+
+				return nil, nil
+			}
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		query.Limit, err = strconv.Atoi(v)
+		if err != nil || query.Limit < 1 {
+			writeError(res, http.StatusBadRequest, "limit parameter must be a positive integer")
+
+			return nil, nil
+		}
+		if query.Limit > backend.ItemQueryMaxLimit {
+			query.Limit = backend.ItemQueryMaxLimit
+		}
+	}
+
+	feedsByID := make(map[int]*feedme.Feed)
+
+	if name := params.Get("feed"); name != "" {
+		feed, err := db.FindFeed(req.Context(), name)
+		if checkError(res, req, err) {
+			return nil, nil
+		}
+		if !checkFeedToken(res, req, feed) {
+			return nil, nil
+		}
+
+		feedsByID[feed.ID] = feed
+	} else {
+		feeds, err := db.SearchFeeds(req.Context(), nil, "", true)
+		if checkError(res, req, err) {
+			return nil, nil
+		}
+
+		// items of private feeds must not be found by searching all feeds
+		for i := range feeds {
+			if !feeds[i].Private() {
+				feedsByID[feeds[i].ID] = &feeds[i]
+			}
+		}
+	}
+
+	if len(feedsByID) == 0 {
+		return query, nil
+	}
+
+	for id := range feedsByID {
+		query.Feeds = append(query.Feeds, id)
+	}
+
+	items, err := db.SearchItemsQuery(req.Context(), *query)
+	if checkError(res, req, err) {
+		return nil, nil
+	}
+
+	for i := range items {
+		feed := feedsByID[items[i].Feed]
+
+		// URIs of the items are resolved as the feeds can store relative ones
+		items[i].URI, err = feed.ResolveURI(items[i].URI)
+		if checkError(res, req, err) {
+			return nil, nil
+		}
+
+		if items[i].Enclosure.URL != "" {
+			items[i].Enclosure.URL, err = feed.ResolveURI(items[i].Enclosure.URL)
+			if checkError(res, req, err) {
+				return nil, nil
+			}
+		}
+
+		if opts.ItemLinks == "self" {
+			items[i].URI = itemURL(req, feed, &items[i])
+		}
+
+		// titles are prefixed with the feed names so that items of different feeds can be told apart
+		if len(feedsByID) > 1 {
+			items[i].Title = feed.Name + ": " + items[i].Title
+		}
+	}
+
+	return query, items
+}
+
+func handleSearch(res http.ResponseWriter, req *http.Request) {
+	var err error
+
+	query, items := searchItems(res, req)
+	if query == nil {
+		return
+	}
+
+	if items == nil {
+		items = []feedme.Item{}
+	}
+	cachedImages(req, items)
+
+	data, err := json.Marshal(items)
+	if checkError(res, req, err) {
+		return
+	}
+
+	if checkNotModified(res, req, weakETag(string(data)), time.Time{}) {
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(data)
+}
+
+// searchParams returns the search parameters of the request without other parameters like the token
+func searchParams(req *http.Request) url.Values {
+	params := req.URL.Query()
+	search := url.Values{}
+
+	// the token must not be exposed by the links of search feeds
+	for _, name := range []string{"q", "feed", "order", "since", "until", "limit"} {
+		if v := params.Get(name); v != "" {
+			search.Set(name, v)
+		}
+	}
+
+	return search
+}
+
+func handleSearchFeed(typ FeedEnum, res http.ResponseWriter, req *http.Request) {
+	query, items := searchItems(res, req)
+	if query == nil {
+		return
+	}
+
+	searchFeed := &feedme.Feed{
+		Name: "search: " + query.Query,
+		URL:  baseURL(req) + "search?" + searchParams(req).Encode(),
+	}
+
+	writeFeed(typ, res, req, searchFeed, nil, items)
+}
+
+func handleSearchAtom(res http.ResponseWriter, req *http.Request) {
+	handleSearchFeed(FeedAtom, res, req)
+}
+
+func handleSearchRss(res http.ResponseWriter, req *http.Request) {
+	handleSearchFeed(FeedRSS, res, req)
+}
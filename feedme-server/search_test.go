@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleSearchFeedLinks(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	r := newRouter()
+
+	res := serve(r, "GET", "/search/atom?q=first&feed=news&token="+testFeedToken+"&limit=10", nil)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", res.Code, res.Body.String())
+	}
+
+	body := res.Body.String()
+	if strings.Contains(body, testFeedToken) {
+		t.Errorf("expected the token not to be exposed, got %s", body)
+	}
+	if !strings.Contains(body, "search?feed=news&amp;limit=10&amp;q=first") {
+		t.Errorf("expected the search parameters in the links, got %s", body)
+	}
+}
+
+func TestHandleSearchFeedNotModified(t *testing.T) {
+	testOptions(t)
+	testBackend(t)
+
+	r := newRouter()
+
+	first := serve(r, "GET", "/search/atom?q=first", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d with %q", first.Code, etag)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/search/atom?q=first", http.StatusNotModified},
+		{"/search/rss?q=first", http.StatusNotModified},
+		// the token is no search parameter
+		{"/search/atom?q=first&token=" + testFeedToken, http.StatusNotModified},
+		{"/search/atom?q=first&order=rank", http.StatusOK},
+		{"/search/atom?q=first&feed=news", http.StatusOK},
+		{"/search/atom?q=first&since=2000-01-01", http.StatusOK},
+		{"/search/atom?q=first&until=2100-01-01", http.StatusOK},
+		{"/search/atom?q=first&limit=10", http.StatusOK},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			res := serve(r, "GET", tc.path, http.Header{"If-None-Match": {etag}})
+			if res.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, res.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// certificateLoader holds a TLS certificate which is reloaded from its files on SIGHUP
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertificateLoader(certFile string, keyFile string) (*certificateLoader, error) {
+	c := &certificateLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Load reads the certificate and its key from their files
+func (c *certificateLoader) Load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.cert = &cert
+	c.lock.Unlock()
+
+	return nil
+}
+
+// GetCertificate returns the current certificate for the tls.Config of the server
+func (c *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.cert, nil
+}
+
+// ReloadOnSignal reloads the certificate whenever the process receives a SIGHUP
+func (c *certificateLoader) ReloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			err := c.Load()
+			if err != nil {
+				// a failed reload keeps the current certificate
+				logger.Error("cannot reload TLS certificate", "cert", c.certFile, "key", c.keyFile, "error", err)
+			} else {
+				logger.Info("reloaded TLS certificate", "cert", c.certFile)
+			}
+		}
+	}()
+}
@@ -1,23 +1,240 @@
 package feedme
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
 // Feed represents a feed
 type Feed struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	Transform string `json:"transform"`
+	ID          int        `db:"id" json:"id"`
+	Name        string     `db:"name" json:"name"`
+	URL         string     `db:"url" json:"url"`
+	Transform   string     `db:"transform" json:"transform"`
+	Interval    int        `db:"crawl_interval" json:"interval"`
+	LastCrawled *time.Time `db:"last_crawled" json:"last_crawled,omitempty"`
+	Category    string     `db:"category" json:"category,omitempty"`
+	// Schedule is a duration or a cron expression of ParseSchedule which overrides the interval
+	Schedule string `db:"schedule" json:"schedule,omitempty"`
+
+	// DisplayTitle, Description, Language and SiteURL describe the generated feed. The title defaults to the name and the site to the URL.
+	DisplayTitle string `db:"display_title" json:"display_title,omitempty"`
+	Description  string `db:"description" json:"description,omitempty"`
+	Language     string `db:"language" json:"language,omitempty"`
+	SiteURL      string `db:"site_url" json:"site_url,omitempty"`
+	// HideSource hides the URL of the feed from the server, e.g. if it holds a private token, so the feed links to its site URL or its HTML page of the server instead
+	HideSource bool `db:"hide_source" json:"hide_source,omitempty"`
+
+	Enabled      bool   `db:"enabled" json:"enabled"`
+	FailureCount int    `db:"failure_count" json:"failure_count"`
+	LastError    string `db:"last_error" json:"last_error"`
+	// EmptyRuns is the count of consecutive crawls which found no items
+	EmptyRuns int `db:"empty_runs" json:"empty_runs"`
+
+	Token string `db:"token" json:"-"`
+}
+
+// Private returns true if the feed can only be read with its token
+func (f *Feed) Private() bool {
+	return f.Token != ""
+}
+
+// Title returns the title of the generated feed which is the display title or the name of the feed
+func (f *Feed) Title() string {
+	if f.DisplayTitle != "" {
+		return f.DisplayTitle
+	}
+
+	return f.Name
+}
+
+// Link returns the link of the generated feed to its site
+func (f *Feed) Link() string {
+	// feeds with a hidden source have only their site URL
+	if f.SiteURL != "" || f.HideSource {
+		return f.SiteURL
+	}
+
+	return f.URL
+}
+
+// Due returns true if the feed should be crawled at the given time
+func (f *Feed) Due(now time.Time) bool {
+	return !f.NextRun(now).After(now)
+}
+
+// NextRun returns the time of the next crawl of the feed by its schedule or, without a valid schedule, by its interval
+func (f *Feed) NextRun(now time.Time) time.Time {
+	if f.LastCrawled == nil {
+		return now
+	}
+
+	last := *f.LastCrawled
+	// e.g. after the clock was turned back
+	if last.After(now) {
+		last = now
+	}
+
+	if f.Schedule != "" {
+		if schedule, err := ParseSchedule(f.Schedule); err == nil {
+			return schedule.Next(last)
+		}
+	}
+
+	if f.Interval <= 0 {
+		return now
+	}
+
+	return last.Add(time.Duration(f.Interval) * time.Second)
 }
 
 // Item represents an item of a feed
 type Item struct {
-	Feed        int
-	ID          int
-	Title       string
-	URI         string
-	Description string
-	Created     time.Time
+	Feed        int        `db:"feed" json:"feed"`
+	ID          int        `db:"id" json:"id"`
+	GUID        string     `db:"guid" json:"guid"`
+	Title       string     `db:"title" json:"title"`
+	URI         string     `db:"uri" json:"uri"`
+	Description string     `db:"description" json:"description"`
+	Author      string     `db:"author" json:"author"`
+	Categories  Categories `db:"categories" json:"categories"`
+	Enclosure   `json:"enclosure"`
+	Created     time.Time `db:"created" json:"created"`
+	// Updated is the time of the last crawl which changed the title or the description of the item
+	Updated *time.Time `db:"updated" json:"updated,omitempty"`
+	// LastSeen is the time of the last crawl which found the item and Expired is true if a later crawl of a feed with a track-presence transform did not find it
+	LastSeen *time.Time `db:"last_seen" json:"last_seen,omitempty"`
+	Expired  bool       `db:"expired" json:"expired"`
+	// Hidden is true if the item was hidden via the server, hidden items are kept so that crawls do not insert them again
+	Hidden bool `db:"hidden" json:"hidden,omitempty"`
+	// Image is the URL of the image of the item and Media the file of its cached copy which is served by the server
+	Image string `db:"image" json:"image,omitempty"`
+	Media string `db:"media" json:"media,omitempty"`
+	// Fields holds the values of the transform templates which are not item fields, e.g. a price or a location
+	Fields Fields `db:"fields" json:"fields,omitempty"`
+}
+
+// Modified returns the time of the last change of the item, which is its creation time if it was never updated
+func (i *Item) Modified() time.Time {
+	if i.Updated != nil {
+		return *i.Updated
+	}
+
+	return i.Created
+}
+
+// CrawlRun represents a crawl of a feed
+type CrawlRun struct {
+	Feed          int           `db:"feed" json:"feed"`
+	ID            int           `db:"id" json:"id"`
+	Started       time.Time     `db:"started" json:"started"`
+	Duration      time.Duration `db:"duration" json:"duration"`
+	ItemsFound    int           `db:"items_found" json:"items_found"`
+	ItemsInserted int           `db:"items_inserted" json:"items_inserted"`
+	Error         string        `db:"error" json:"error"`
+}
+
+// RobotsFile represents the fetched robots.txt of an origin like https://example.com
+type RobotsFile struct {
+	Origin  string    `db:"origin" json:"origin"`
+	Content string    `db:"content" json:"content"`
+	Fetched time.Time `db:"fetched" json:"fetched"`
+}
+
+// Enclosure represents a media object of an item
+type Enclosure struct {
+	URL    string `db:"enclosure_url" json:"url"`
+	Type   string `db:"enclosure_type" json:"type"`
+	Length int64  `db:"enclosure_length" json:"length"`
+}
+
+// Categories represents the categories of an item which are stored as a comma separated string
+type Categories []string
+
+// ParseCategories splits a comma separated string into categories
+func ParseCategories(s string) Categories {
+	var categories Categories
+
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+
+		if c != "" {
+			categories = append(categories, c)
+		}
+	}
+
+	return categories
+}
+
+// Scan implements the sql.Scanner interface
+func (c *Categories) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+	case string:
+		*c = ParseCategories(v)
+	case []byte:
+		*c = ParseCategories(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into categories", value)
+	}
+
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (c Categories) Value() (driver.Value, error) {
+	return strings.Join(c, ","), nil
+}
+
+// Fields represents the extra fields of an item by their names which are stored as a JSON object
+type Fields map[string]string
+
+// Scan implements the sql.Scanner interface
+func (f *Fields) Scan(value interface{}) error {
+	var data []byte
+
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into fields", value)
+	}
+
+	var fields Fields
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return fmt.Errorf("cannot scan fields: %s", err.Error())
+	}
+
+	// items without extra fields have none instead of an empty map
+	if len(fields) == 0 {
+		fields = nil
+	}
+	*f = fields
+
+	return nil
+}
+
+// Value implements the driver.Valuer interface
+func (f Fields) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(map[string]string(f))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
 }
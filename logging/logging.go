@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// New creates a logger with the given format ("text" or "json") and level ("debug", "info", "warn" or "error") which writes to the given file or to STDERR if the file is empty
+func New(format string, level string, file string) (*slog.Logger, error) {
+	var l slog.Level
+
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	var w io.Writer = os.Stderr
+
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open log file: %v", err)
+		}
+
+		w = f
+	}
+
+	handlerOptions := &slog.HandlerOptions{
+		Level: l,
+	}
+
+	var handler slog.Handler
+
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(handler), nil
+}
@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the Prometheus type of a metric
+type Type string
+
+const (
+	Counter Type = "counter"
+	Gauge   Type = "gauge"
+	Summary Type = "summary"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Labels holds the label names and values of a metric sample
+type Labels map[string]string
+
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, labelEscaper.Replace(l[name]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type sample struct {
+	labels Labels
+	value  float64
+	count  uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     Type
+	samples map[string]*sample
+}
+
+// Registry holds metrics and writes them in the Prometheus text exposition format
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+func (r *Registry) sample(name string, help string, typ Type, labels Labels) *sample {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			name:    name,
+			help:    help,
+			typ:     typ,
+			samples: make(map[string]*sample),
+		}
+
+		r.families[name] = f
+	}
+
+	key := labels.String()
+
+	s, ok := f.samples[key]
+	if !ok {
+		s = &sample{
+			labels: labels,
+		}
+
+		f.samples[key] = s
+	}
+
+	return s
+}
+
+// Add adds a value to a counter
+func (r *Registry) Add(name string, help string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sample(name, help, Counter, labels).value += value
+}
+
+// Set sets the value of a gauge
+func (r *Registry) Set(name string, help string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sample(name, help, Gauge, labels).value = value
+}
+
+// Observe adds an observation to a summary which is exported as its sum and count
+func (r *Registry) Observe(name string, help string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.sample(name, help, Summary, labels)
+	s.value += value
+	s.count++
+}
+
+// Reset removes all samples of a metric
+func (r *Registry) Reset(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		f.samples = make(map[string]*sample)
+	}
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	return r.WriteFunc(w, nil)
+}
+
+// WriteFunc writes the metrics whose samples are kept by the function in the Prometheus text exposition format
+func (r *Registry) WriteFunc(w io.Writer, keep func(labels Labels) bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+
+	for _, name := range names {
+		f := r.families[name]
+
+		fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.typ)
+
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.samples[key]
+			// e.g. samples of some label values are hidden, a nil function keeps all samples
+			if keep != nil && !keep(s.labels) {
+				continue
+			}
+
+			if f.typ == Summary {
+				fmt.Fprintf(&buf, "%s_sum%s %s\n", f.name, key, formatFloat(s.value))
+				fmt.Fprintf(&buf, "%s_count%s %d\n", f.name, key, s.count)
+			} else {
+				fmt.Fprintf(&buf, "%s%s %s\n", f.name, key, formatFloat(s.value))
+			}
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// WriteFile atomically writes all metrics to a file, e.g. for the textfile collector of the node exporter
+func (r *Registry) WriteFile(file string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".")
+	if err != nil {
+		return err
+	}
+
+	err = r.Write(tmp)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return err
+	}
+
+	return nil
+}
+
+// Push replaces the metrics of the Pushgateway group of the URL with all metrics
+func (r *Registry) Push(url string) error {
+	var buf bytes.Buffer
+
+	err := r.Write(&buf)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("push to %s failed with status %s", url, res.Status)
+	}
+
+	return nil
+}
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,214 @@
+package feedme
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule represents the crawl schedule of a feed
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses the crawl schedule of a feed which is either a duration like 15m or a cron expression like "0 7 * * mon-fri"
+func ParseSchedule(schedule string) (Schedule, error) {
+	fields := strings.Fields(schedule)
+
+	switch len(fields) {
+	case 1:
+		d, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q must be a duration like 15m or a cron expression like \"0 7 * * mon-fri\"", schedule)
+		} else if d < time.Minute {
+			return nil, fmt.Errorf("schedule %q must be at least 1m", schedule)
+		}
+
+		return intervalSchedule(d), nil
+	case 5:
+		s := &cronSchedule{
+			// cron expressions are evaluated in the local time zone
+			location: time.Local,
+		}
+
+		for i, field := range []struct {
+			name  string
+			bits  *uint64
+			min   int
+			max   int
+			names []string
+		}{
+			{"minute", &s.minute, 0, 59, nil},
+			{"hour", &s.hour, 0, 23, nil},
+			{"day of month", &s.dom, 1, 31, nil},
+			{"month", &s.month, 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+			// 7 is also Sunday
+			{"day of week", &s.dow, 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+		} {
+			bits, err := parseCronField(fields[i], field.min, field.max, field.names)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %q has an invalid %s field: %s", schedule, field.name, err.Error())
+			}
+
+			*field.bits = bits
+		}
+
+		if s.dow&(1<<7) != 0 {
+			s.dow |= 1
+		}
+		s.domAny = strings.HasPrefix(fields[2], "*")
+		s.dowAny = strings.HasPrefix(fields[4], "*")
+
+		if s.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("schedule %q never matches", schedule)
+		}
+
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("schedule %q must be a duration like 15m or a cron expression with five fields like \"0 7 * * mon-fri\"", schedule)
+}
+
+// intervalSchedule runs after every duration
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+// cronSchedule runs at the matching minutes of a cron expression
+type cronSchedule struct {
+	// the fields are bit sets of their matching values
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny and dowAny are true if the day fields start with *, as a day then only has to match the other day field
+	domAny bool
+	dowAny bool
+
+	location *time.Location
+}
+
+// cronSearchYears is the count of years which are searched for the next match of a cron expression
+const cronSearchYears = 5
+
+// Next returns the first matching minute after the given time or the zero time if there is none
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	after = after.In(s.location)
+	limit := after.AddDate(cronSearchYears, 0, 0)
+
+	// the wall clock is advanced by absolute durations so that skipped and repeated hours of DST changes are handled by the time package
+	t := after.Truncate(time.Second).Add(time.Minute - time.Duration(after.Second())*time.Second)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		// times which are skipped on DST changes do not run and times which are repeated only run once
+		case s.minute&(1<<uint(t.Minute())) == 0 || !wallClockAfter(t, after):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches returns true if the day of the time matches the day fields
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+
+	// like cron, a day only has to match one of the fields if both are restricted
+	return dom || dow
+}
+
+// wallClockAfter returns true if the wall clock minute of t is after the one of u
+func wallClockAfter(t time.Time, u time.Time) bool {
+	wall := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+	}
+
+	// the second pass of an hour that is repeated on a DST change is not after the first one
+	return wall(t).After(wall(u))
+}
+
+// parseCronField parses a comma separated list of *, values and ranges like 1-5, each with an optional step like */15, into a bit set of the matching values
+func parseCronField(field string, min int, max int, names []string) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		expr, step := part, 1
+
+		if i := strings.IndexByte(part, '/'); i != -1 {
+			var err error
+
+			expr = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+		}
+
+		from, to := min, max
+		if expr != "*" {
+			start, end, isRange := strings.Cut(expr, "-")
+
+			var err error
+
+			from, err = parseCronValue(start, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+
+			to = from
+			if isRange {
+				to, err = parseCronValue(end, min, max, names)
+				if err != nil {
+					return 0, err
+				}
+			} else if step != 1 {
+				// like cron, a value with a step starts a range up to the maximum
+				to = max
+			}
+
+			if to < from {
+				return 0, fmt.Errorf("invalid range %q", expr)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// parseCronValue parses a number or a name of a cron field
+func parseCronValue(value string, min int, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return i + min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value %q must be between %d and %d", value, min, max)
+	}
+
+	return v, nil
+}
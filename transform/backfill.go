@@ -0,0 +1,227 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BackfillSteps holds the steps of date ranges of the backfill element
+var BackfillSteps = []string{"day", "week", "month", "year"}
+
+// Backfill represents the backfill element of a transform
+type Backfill struct {
+	// Next is the selector of the link to the next page of html sources or the path of the URL of the next page of json sources
+	Next string
+	// MaxPages limits the pages of a backfill below the max pages of the crawler (0 keeps the limit of the crawler)
+	MaxPages int
+
+	// url is the template of the archive pages, nil if the pages are found by following Next
+	url *template.Template
+	// dates marks date ranges which use fromDate, toDate and stepDate instead of the numbers
+	dates      bool
+	fromNumber int
+	toNumber   int
+	stepNumber int
+	fromDate   time.Time
+	toDate     time.Time
+	stepDate   string
+}
+
+// parseBackfill parses the backfill element of a transform with the given source
+func parseBackfill(raw *json.RawMessage, source string) (*Backfill, error) {
+	var err error
+
+	node, err := jsonHash(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be a hash")
+	}
+
+	b := &Backfill{}
+
+	if node["max-pages"] != nil {
+		b.MaxPages, _, err = jsonInt(node["max-pages"])
+		if err != nil {
+			return nil, fmt.Errorf("max-pages must be an integer")
+		} else if b.MaxPages < 0 {
+			return nil, fmt.Errorf("max-pages must not be negative")
+		}
+	}
+
+	if node["next"] != nil {
+		b.Next, err = jsonString(node["next"])
+		if err != nil {
+			return nil, fmt.Errorf("next must be a string")
+		}
+	}
+
+	var tem string
+	if node["url"] != nil {
+		tem, err = jsonString(node["url"])
+		if err != nil {
+			return nil, fmt.Errorf("url must be a string")
+		}
+	}
+
+	switch {
+	case b.Next == "" && tem == "":
+		return nil, fmt.Errorf("needs a next or an url element")
+	case b.Next != "" && tem != "":
+		return nil, fmt.Errorf("next cannot be used with url")
+	case b.Next != "":
+		if source == "feed" {
+			return nil, fmt.Errorf("next needs a html or json source")
+		}
+		for _, key := range []string{"from", "to", "step"} {
+			if node[key] != nil {
+				return nil, fmt.Errorf("%s needs an url element", key)
+			}
+		}
+
+		if source == "json" {
+			_, err = parsePath(b.Next)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse path of next: %s", err.Error())
+			}
+		}
+
+		return b, nil
+	}
+
+	b.url, err = template.New("backfill").Funcs(templateFuncMap()).Parse(tem)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse url template: %s", err.Error())
+	}
+
+	if node["from"] == nil || node["to"] == nil {
+		return nil, fmt.Errorf("url needs a from and a to element")
+	}
+
+	// dates are given as strings and numbers as JSON numbers
+	from, err := jsonString(node["from"])
+	if err != nil {
+		b.fromNumber, _, err = jsonInt(node["from"])
+		if err != nil {
+			return nil, fmt.Errorf("from must be an integer or a date like 2006-01-02")
+		}
+		b.toNumber, _, err = jsonInt(node["to"])
+		if err != nil {
+			return nil, fmt.Errorf("to must be an integer like from")
+		}
+
+		b.stepNumber = 1
+		if node["step"] != nil {
+			b.stepNumber, _, err = jsonInt(node["step"])
+			if err != nil {
+				return nil, fmt.Errorf("step of numbers must be an integer")
+			} else if b.stepNumber < 1 {
+				return nil, fmt.Errorf("step must be positive")
+			}
+		}
+
+		return b, nil
+	}
+
+	b.dates = true
+
+	b.fromDate, err = time.Parse("2006-01-02", from)
+	if err != nil {
+		return nil, fmt.Errorf("from must be an integer or a date like 2006-01-02")
+	}
+	to, err := jsonString(node["to"])
+	if err == nil {
+		b.toDate, err = time.Parse("2006-01-02", to)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("to must be a date like from")
+	}
+
+	b.stepDate = "day"
+	if node["step"] != nil {
+		b.stepDate, err = jsonString(node["step"])
+		if err != nil {
+			return nil, fmt.Errorf("step of dates must be a string")
+		}
+
+		known := false
+		for _, step := range BackfillSteps {
+			if b.stepDate == step {
+				known = true
+
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown step %q, allowed are %s", b.stepDate, strings.Join(BackfillSteps, ", "))
+		}
+	}
+
+	return b, nil
+}
+
+// URLs returns at most max URLs of the url template and if the range has more URLs
+func (b *Backfill) URLs(max int) ([]string, bool, error) {
+	if b.url == nil {
+		// backfills which follow the next element have no URLs
+		return nil, false, nil
+	}
+
+	var urls []string
+
+	for i := 0; ; i++ {
+		data := make(map[string]interface{})
+
+		if b.dates {
+			date := b.dateAt(i)
+			if (b.toDate.Before(b.fromDate) && date.Before(b.toDate)) || (!b.toDate.Before(b.fromDate) && date.After(b.toDate)) {
+				return urls, false, nil
+			}
+
+			data["date"] = date
+		} else {
+			number := b.fromNumber + i*b.stepNumber
+			// the range goes backwards if to is before from
+			if b.toNumber < b.fromNumber {
+				number = b.fromNumber - i*b.stepNumber
+			}
+			if (b.toNumber < b.fromNumber && number < b.toNumber) || (b.toNumber >= b.fromNumber && number > b.toNumber) {
+				return urls, false, nil
+			}
+
+			data["page"] = number
+		}
+
+		if len(urls) == max {
+			return urls, true, nil
+		}
+
+		var buf bytes.Buffer
+		err := b.url.Execute(&buf, data)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot execute url template: %s", err.Error())
+		}
+
+		urls = append(urls, buf.String())
+	}
+}
+
+// dateAt returns the i-th date of the date range
+func (b *Backfill) dateAt(i int) time.Time {
+	if b.toDate.Before(b.fromDate) {
+		i = -i
+	}
+
+	switch b.stepDate {
+	case "week":
+		return b.fromDate.AddDate(0, 0, 7*i)
+	case "month":
+		return b.fromDate.AddDate(0, i, 0)
+	case "year":
+		return b.fromDate.AddDate(i, 0, 0)
+	}
+
+	return b.fromDate.AddDate(0, 0, i)
+}
@@ -0,0 +1,110 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CleanCases holds the cases of the case option of storing nodes
+var CleanCases = []string{"lower", "title", "upper"}
+
+// CleanOptions holds the options of storing nodes which clean their values before they are stored, which are also the elements of the store-defaults element
+var CleanOptions = []string{"case", "collapse-whitespace", "strip-prefix", "strip-suffix", "trim"}
+
+// whitespaceRuns matches the runs of whitespace which are replaced by one space by the collapse-whitespace option
+var whitespaceRuns = regexp.MustCompile(`\s+`)
+
+// cleanValue cleans the value with the options of the storing node
+func cleanValue(value string, rawTransform map[string]*json.RawMessage) (string, error) {
+	collapse, err := jsonBool(rawTransform["collapse-whitespace"])
+	if err != nil {
+		return "", fmt.Errorf("collapse-whitespace attribute must be a boolean: %s", err.Error())
+	}
+	trim, err := jsonBool(rawTransform["trim"])
+	if err != nil {
+		return "", fmt.Errorf("trim attribute must be a boolean: %s", err.Error())
+	}
+	prefix, err := jsonString(rawTransform["strip-prefix"])
+	if err != nil {
+		return "", fmt.Errorf("strip-prefix attribute must be a string: %s", err.Error())
+	}
+	suffix, err := jsonString(rawTransform["strip-suffix"])
+	if err != nil {
+		return "", fmt.Errorf("strip-suffix attribute must be a string: %s", err.Error())
+	}
+	c, err := jsonString(rawTransform["case"])
+	if err != nil {
+		return "", fmt.Errorf("case attribute must be a string: %s", err.Error())
+	}
+
+	// the options are applied in the order collapse-whitespace, trim, strip-prefix, strip-suffix and case
+	if collapse {
+		value = whitespaceRuns.ReplaceAllString(value, " ")
+	}
+	if trim {
+		value = strings.TrimSpace(value)
+	}
+
+	if prefix != "" || suffix != "" {
+		value = strings.TrimPrefix(value, prefix)
+		value = strings.TrimSuffix(value, suffix)
+
+		// the value is trimmed again after stripping
+		if trim {
+			value = strings.TrimSpace(value)
+		}
+	}
+
+	switch c {
+	case "":
+	case "lower":
+		value = strings.ToLower(value)
+	case "title":
+		value = templateTitle(strings.ToLower(value))
+	case "upper":
+		value = strings.ToUpper(value)
+	default:
+		return "", fmt.Errorf("unknown case %s", c)
+	}
+
+	return value, nil
+}
+
+// applyStoreDefaults sets the options of the store-defaults element for all storing nodes of the node and its nested nodes which do not set them themselves
+func applyStoreDefaults(node map[string]*json.RawMessage, defaults map[string]*json.RawMessage) error {
+	if node["copy"] != nil || node["regex"] != nil {
+		for key, value := range defaults {
+			if _, ok := node[key]; !ok {
+				node[key] = value
+			}
+		}
+	}
+
+	if node["do"] == nil {
+		return nil
+	}
+
+	do, err := jsonArray(node["do"])
+	if err != nil {
+		return err
+	}
+
+	for _, d := range do {
+		err = applyStoreDefaults(d, defaults)
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(do)
+	if err != nil {
+		return err
+	}
+
+	raw := json.RawMessage(data)
+	node["do"] = &raw
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// feedTemplates holds the templates of feed sources for the fields which are not defined by the transform element
+var feedTemplates = map[string]string{
+	"author":      "{{.author}}",
+	"category":    "{{.categories}}",
+	"description": "{{.description}}",
+	"enclosure":   "{{.enclosure}}",
+	"guid":        "{{.guid}}",
+	"title":       "{{.title}}",
+	"uri":         "{{.link}}",
+}
+
+// FeedIdentifiers holds the identifiers which are stored for every entry of a feed source
+var FeedIdentifiers = []string{"author", "categories", "date", "description", "enclosure", "guid", "link", "title"}
+
+// xmlFeed represents an RSS 2.0, RSS 1.0 or Atom document
+type xmlFeed struct {
+	XMLName xml.Name
+
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
+	Enclosure   struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomEntry struct {
+	Title     atomText `xml:"title"`
+	ID        string   `xml:"id"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Summary   atomText `xml:"summary"`
+	Content   atomText `xml:"content"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Author struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// atomText represents an Atom text construct which holds either text, escaped HTML or XHTML
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+
+	return strings.TrimSpace(t.Text)
+}
+
+// parseFeed parses an RSS or Atom document into the values of its entries with the identifiers of FeedIdentifiers
+func parseFeed(data []byte) ([]map[string]interface{}, error) {
+	var feed xmlFeed
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+
+	err := d.Decode(&feed)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []map[string]interface{}
+
+	switch feed.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(feed.Channel.Items, feed.Items...) {
+			description := item.Description
+			if description == "" {
+				description = item.Content
+			}
+
+			author := item.Author
+			if author == "" {
+				author = item.Creator
+			}
+
+			date := item.PubDate
+			if date == "" {
+				date = item.Date
+			}
+
+			entries = append(entries, feedEntry(item.Title, item.Link, description, item.GUID, author, item.Categories, item.Enclosure.URL, date))
+		}
+	case "feed":
+		for _, entry := range feed.Entries {
+			link := ""
+			enclosure := ""
+			for _, l := range entry.Links {
+				switch l.Rel {
+				case "", "alternate":
+					if link == "" {
+						link = l.Href
+					}
+				case "enclosure":
+					enclosure = l.Href
+				}
+			}
+
+			description := entry.Content.String()
+			if description == "" {
+				description = entry.Summary.String()
+			}
+
+			var categories []string
+			for _, c := range entry.Categories {
+				categories = append(categories, c.Term)
+			}
+
+			date := entry.Published
+			if date == "" {
+				date = entry.Updated
+			}
+
+			// titles are plain text
+			title := entry.Title.String()
+			if entry.Title.Type == "html" {
+				title = html.UnescapeString(title)
+			}
+
+			entries = append(entries, feedEntry(title, link, description, entry.ID, entry.Author.Name, categories, enclosure, date))
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed format with the root element %s, must be rss, RDF or feed", feed.XMLName.Local)
+	}
+
+	return entries, nil
+}
+
+func feedEntry(title string, link string, description string, guid string, author string, categories []string, enclosure string, date string) map[string]interface{} {
+	entry := map[string]interface{}{
+		"author":      strings.TrimSpace(author),
+		"categories":  strings.Join(categories, ","),
+		"description": strings.TrimSpace(description),
+		"enclosure":   strings.TrimSpace(enclosure),
+		"guid":        strings.TrimSpace(guid),
+		"link":        strings.TrimSpace(link),
+		"title":       strings.TrimSpace(title),
+	}
+
+	// the date is only set if the entry has one
+	if date = strings.TrimSpace(date); date != "" {
+		entry["date"] = date
+	}
+
+	return entry
+}
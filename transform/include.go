@@ -0,0 +1,237 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MaxIncludeDepth is the max nesting of included snippets
+const MaxIncludeDepth = 10
+
+// snippets holds the loaded transform snippets by their names
+var snippets = map[string][]byte{}
+
+var snippetNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var snippetVarPattern = regexp.MustCompile(`\$\{var\.([A-Za-z0-9_-]+)\}`)
+
+// LoadSnippets loads the transform snippets of the directory
+func LoadSnippets(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string][]byte, len(files))
+	for _, file := range files {
+		// every JSON file is a snippet named by its file name without the extension, e.g. blog-items.json is the snippet blog-items
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		if !snippetNamePattern.MatchString(name) {
+			return fmt.Errorf("snippet %q must be named only with letters, digits, - and _", name)
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read snippet %q: %s", name, err.Error())
+		}
+
+		var value interface{}
+		err = json.Unmarshal(data, &value)
+		if err != nil {
+			return fmt.Errorf("cannot parse snippet %q: %s", name, JSONErrorContext(data, err))
+		}
+
+		loaded[name] = data
+	}
+
+	// the snippets must be loaded before transforms are parsed to be included by them
+	snippets = loaded
+
+	return nil
+}
+
+// ExpandIncludes replaces the include nodes of the transform definition with the snippets they name
+func ExpandIncludes(spec string) (string, error) {
+	if !strings.Contains(spec, `"include"`) {
+		return spec, nil
+	}
+
+	value, err := decodeJSON([]byte(spec))
+	if err != nil {
+		return "", fmt.Errorf("cannot parse transform JSON: %s", JSONErrorContext([]byte(spec), err))
+	}
+
+	value, _, err = expandIncludes(value, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// decodeJSON decodes the JSON value while keeping its numbers as they are written
+func decodeJSON(data []byte) (interface{}, error) {
+	var value interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// expandIncludes expands the include nodes of the value and returns if the value was an include node
+func expandIncludes(value interface{}, stack []string) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v["include"]; ok {
+			expanded, err := expandInclude(v, stack)
+
+			return expanded, true, err
+		}
+
+		for key, element := range v {
+			expanded, _, err := expandIncludes(element, stack)
+			if err != nil {
+				return nil, false, err
+			}
+
+			v[key] = expanded
+		}
+	case []interface{}:
+		elements := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			expanded, included, err := expandIncludes(element, stack)
+			if err != nil {
+				return nil, false, err
+			}
+
+			// an array snippet which is included in an array is inserted into that array
+			if a, ok := expanded.([]interface{}); ok && included {
+				elements = append(elements, a...)
+			} else {
+				elements = append(elements, expanded)
+			}
+		}
+
+		return elements, false, nil
+	}
+
+	return value, false, nil
+}
+
+// expandInclude returns the expanded snippet of the include node
+func expandInclude(node map[string]interface{}, stack []string) (interface{}, error) {
+	name, ok := node["include"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("include element must be the name of a snippet")
+	}
+
+	// the stack holds the names of the snippets which are currently expanded to detect cycles
+	for _, n := range stack {
+		if n == name {
+			return nil, fmt.Errorf("snippet %q includes itself via %s", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+	if len(stack) == MaxIncludeDepth {
+		return nil, fmt.Errorf("snippet %q exceeds the max include depth of %d via %s", name, MaxIncludeDepth, strings.Join(append(stack, name), " -> "))
+	}
+
+	data, ok := snippets[name]
+	if !ok {
+		return nil, fmt.Errorf("snippet %q does not exist", name)
+	}
+
+	vars := map[string]string{}
+	if node["vars"] != nil {
+		v, ok := node["vars"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("vars element of the include of snippet %q must be an object", name)
+		}
+
+		for key, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("variable %q of the include of snippet %q must be a string", key, name)
+			}
+
+			vars[key] = s
+		}
+	}
+
+	var missing string
+	// the ${var.name} placeholders of the strings of the snippet are replaced by the vars of the include node
+	data = snippetVarPattern.ReplaceAllFunc(data, func(placeholder []byte) []byte {
+		key := string(snippetVarPattern.FindSubmatch(placeholder)[1])
+
+		value, ok := vars[key]
+		if !ok {
+			missing = key
+
+			return placeholder
+		}
+
+		// the value is encoded as the content of a JSON string
+		encoded, _ := json.Marshal(value)
+
+		return encoded[1 : len(encoded)-1]
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("variable %q of snippet %q is not defined by the include", missing, name)
+	}
+
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse snippet %q after substituting its variables: %s", name, JSONErrorContext(data, err))
+	}
+
+	// snippets can include other snippets
+	value, _, err = expandIncludes(value, append(stack, name))
+	if err != nil {
+		return nil, err
+	}
+
+	// the other elements of the include node override the elements of an object snippet
+	overrides := map[string]interface{}{}
+	for key, element := range node {
+		if key == "include" || key == "vars" {
+			continue
+		}
+
+		expanded, _, err := expandIncludes(element, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[key] = expanded
+	}
+
+	if len(overrides) != 0 {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("snippet %q must be an object to override its elements", name)
+		}
+
+		for key, element := range overrides {
+			object[key] = element
+		}
+	}
+
+	return value, nil
+}
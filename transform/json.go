@@ -0,0 +1,267 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// pathSegment represents an object key or, if index is not negative, an array index of a JSON path
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// parsePath parses a JSON path like data.items[0].title or data["dotted.key"]
+func parsePath(path string) ([]pathSegment, error) {
+	// the empty path has no segments and selects the current value
+	var segments []pathSegment
+
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("missing ] at position %d", i)
+			}
+			inner := path[i+1 : i+end]
+
+			if strings.HasPrefix(inner, `"`) {
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted key %s at position %d", inner, i)
+				}
+
+				segments = append(segments, pathSegment{key: key, index: -1})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid index %q at position %d", inner, i)
+				}
+
+				segments = append(segments, pathSegment{index: index})
+			}
+
+			i += end + 1
+		case path[i] == '.':
+			if i == 0 || i == len(path)-1 || path[i+1] == '.' || path[i+1] == '[' {
+				return nil, fmt.Errorf("empty key at position %d", i)
+			}
+
+			i++
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end == -1 {
+				end = len(path) - i
+			}
+
+			segments = append(segments, pathSegment{key: path[i : i+end], index: -1})
+
+			i += end
+		}
+	}
+
+	return segments, nil
+}
+
+func formatPath(segments []pathSegment) string {
+	var path strings.Builder
+
+	for i, segment := range segments {
+		switch {
+		case segment.index >= 0:
+			fmt.Fprintf(&path, "[%d]", segment.index)
+		case strings.ContainsAny(segment.key, ".[]"):
+			fmt.Fprintf(&path, "[%q]", segment.key)
+		default:
+			if i != 0 {
+				path.WriteByte('.')
+			}
+			path.WriteString(segment.key)
+		}
+	}
+
+	return path.String()
+}
+
+// selectJSONPath returns the value of the path relative to the given value
+func selectJSONPath(value interface{}, path string) (interface{}, string, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot parse path %q: %s", path, err.Error())
+	}
+
+	for i, segment := range segments {
+		if segment.index >= 0 {
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, "", fmt.Errorf("%s is not an array but %s", describePath(segments[:i]), jsonType(value))
+			}
+
+			// an element which does not exist returns the path up to the missing element
+			if segment.index >= len(array) {
+				return nil, formatPath(segments[:i+1]), nil
+			}
+
+			value = array[segment.index]
+		} else {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, "", fmt.Errorf("%s is not an object but %s", describePath(segments[:i]), jsonType(value))
+			}
+
+			v, ok := object[segment.key]
+			if !ok {
+				return nil, formatPath(segments[:i+1]), nil
+			}
+
+			value = v
+		}
+	}
+
+	return value, "", nil
+}
+
+func describePath(segments []pathSegment) string {
+	if len(segments) == 0 {
+		return "the current value"
+	}
+
+	return formatPath(segments)
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// jsonValueString converts a JSON value which is not an array or an object to a string
+func jsonValueString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("cannot store %s", jsonType(value))
+	}
+}
+
+// jsonSelect works like crawlSelect but selects the values of JSON data via path and field nodes
+func jsonSelect(value interface{}, rawTransform map[string]*json.RawMessage, itemValues []map[string]interface{}, log *slog.Logger) ([]map[string]interface{}, error) {
+	baseSelection := false
+
+	if itemValues == nil {
+		baseSelection = true
+
+		itemValues = []map[string]interface{}{
+			make(map[string]interface{}),
+		}
+	}
+
+	optional, err := jsonBool(rawTransform["optional"])
+	if err != nil {
+		return nil, fmt.Errorf("optional attribute must be a boolean: %s", err.Error())
+	}
+
+	if rawPath, ok := rawTransform["path"]; ok {
+		path, do, err := jsonSelectNode(rawTransform, rawPath)
+		if err != nil {
+			return nil, err
+		}
+
+		selected, missing, err := selectJSONPath(value, path)
+		if err != nil {
+			return nil, err
+		} else if missing != "" {
+			if !optional {
+				return nil, fmt.Errorf("no element %s found", missing)
+			}
+
+			log.Debug("optional path not found", "path", path)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		elements, ok := selected.([]interface{})
+		if !ok {
+			elements = []interface{}{selected}
+		}
+
+		for i, element := range elements {
+			for _, d := range do {
+				_, err = jsonSelect(element, d, itemValues, log)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", formatPathIndex(path, i, ok), err.Error())
+				}
+			}
+
+			if baseSelection && i != len(elements)-1 && len(itemValues[len(itemValues)-1]) != 0 {
+				itemValues = append(itemValues, make(map[string]interface{}))
+			}
+		}
+	} else if rawField, ok := rawTransform["field"]; ok {
+		field, do, err := jsonSelectNode(rawTransform, rawField)
+		if err != nil {
+			return nil, err
+		}
+
+		selected, missing, err := selectJSONPath(value, field)
+		if err != nil {
+			return nil, err
+		} else if missing != "" {
+			if !optional {
+				return nil, fmt.Errorf("no field %s found", missing)
+			}
+
+			log.Debug("optional field not found", "field", field)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		s, err := jsonValueString(selected)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", field, err.Error())
+		}
+
+		for _, d := range do {
+			err = crawlStore(s, d, itemValues[len(itemValues)-1], log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if _, ok := rawTransform["filter"]; ok {
+		// filters are applied after all values of an item are collected
+	} else {
+		return nil, fmt.Errorf("do not know how to transform a node with the elements %s", strings.Join(jsonKeys(rawTransform), ", "))
+	}
+
+	return itemValues, nil
+}
+
+// formatPathIndex returns the path of the element with the given index if the path selected an array
+func formatPathIndex(path string, index int, isArray bool) string {
+	if !isArray {
+		return path
+	}
+
+	return fmt.Sprintf("%s[%d]", path, index)
+}
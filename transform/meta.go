@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"log/slog"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// metaValue returns the value of the given key of the meta tags or of the JSON-LD blocks of the element
+func metaValue(element *goquery.Selection, key string, log *slog.Logger) (string, bool) {
+	if value, ok := findMetaValue(element, key, log); ok {
+		return value, true
+	}
+
+	if element.Length() == 0 {
+		return "", false
+	}
+
+	// the whole document of the element is searched if the element holds no value
+	root := element.Nodes[0]
+	for root.Parent != nil {
+		root = root.Parent
+	}
+
+	if root == element.Nodes[0] {
+		return "", false
+	}
+
+	return findMetaValue(goquery.NewDocumentFromNode(root).Selection, key, log)
+}
+
+// findMetaValue searches the content of a meta tag with the key as property, name or itemprop attribute and then the JSON-LD blocks with the key as path
+func findMetaValue(s *goquery.Selection, key string, log *slog.Logger) (string, bool) {
+	var value string
+	found := false
+
+	s.Find("meta[content]").EachWithBreak(func(i int, meta *goquery.Selection) bool {
+		for _, attr := range []string{"property", "name", "itemprop"} {
+			if v, ok := meta.Attr(attr); ok && v == key {
+				value, found = meta.AttrOr("content", ""), true
+
+				return false
+			}
+		}
+
+		return true
+	})
+	if found {
+		return value, true
+	}
+
+	s.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, script *goquery.Selection) bool {
+		data, err := parseJSON([]byte(script.Text()))
+		if err != nil {
+			log.Debug("cannot parse JSON-LD block", "block", i, "error", err)
+
+			return true
+		}
+
+		// a block can also hold an array of objects
+		candidates := []interface{}{data}
+		if array, ok := data.([]interface{}); ok {
+			candidates = append(candidates, array...)
+		}
+
+		for _, candidate := range candidates {
+			v, missing, err := selectJSONPath(candidate, key)
+			if err != nil || missing != "" {
+				continue
+			}
+
+			s, err := jsonValueString(v)
+			if err != nil {
+				continue
+			}
+
+			value, found = s, true
+
+			return false
+		}
+
+		return true
+	})
+
+	return value, found
+}
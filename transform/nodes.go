@@ -0,0 +1,938 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// itemFilter represents a filter node which drops or keeps items depending on a stored value
+type itemFilter struct {
+	Field  string `json:"field"`
+	Regex  string `json:"regex"`
+	Action string `json:"action"`
+
+	re *regexp.Regexp
+}
+
+// Drop returns true if the item with the given stored values must be dropped
+func (f *itemFilter) Drop(itemValue map[string]interface{}) bool {
+	value := ""
+	if v, ok := itemValue[f.Field]; ok {
+		value = fmt.Sprint(v)
+	}
+
+	matched := f.re.MatchString(value)
+
+	if f.Action == "keep" {
+		return !matched
+	}
+
+	return matched
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// parseDate returns the parsed date and true or the current time and false if the value is not a known date
+func parseDate(value interface{}) (time.Time, bool) {
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Now(), false
+}
+
+func crawlSelect(element *goquery.Selection, rawTransform map[string]*json.RawMessage, itemValues []map[string]interface{}, log *slog.Logger) ([]map[string]interface{}, error) {
+	baseSelection := false
+
+	if itemValues == nil {
+		baseSelection = true
+
+		itemValues = make([]map[string]interface{}, 1)
+		// TODO finde out why this is needed as itemValues with make of length 1 has already a map shown printed with %+v. But it is nil if it is accessed
+		itemValues[0] = make(map[string]interface{})
+	}
+
+	optional, err := jsonBool(rawTransform["optional"])
+	if err != nil {
+		return nil, fmt.Errorf("optional attribute must be a boolean: %s", err.Error())
+	}
+
+	if rawSelector, ok := rawTransform["search"]; ok {
+		selector, do, err := jsonSelectNode(rawTransform, rawSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes, err := sliceSelection(element.Find(selector), selector, rawTransform)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes.Each(func(i int, s *goquery.Selection) {
+			for _, d := range do {
+				_, err = crawlSelect(s, d, itemValues, log)
+				if err != nil {
+					return
+				}
+			}
+
+			if baseSelection && i != nodes.Length()-1 && len(itemValues[len(itemValues)-1]) != 0 {
+				itemValues = append(itemValues, make(map[string]interface{}))
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if rawSelector, ok := rawTransform["find"]; ok {
+		selector, do, err := jsonSelectNode(rawTransform, rawSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		s := element.Find(selector)
+		if s == nil {
+			return nil, fmt.Errorf("no element %s found", selector)
+		}
+
+		if s.Length() != 0 || !optional {
+			s, err = sliceSelection(s, selector, rawTransform)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if s.Length() == 0 && optional {
+			log.Debug("optional element not found", "selector", selector)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		for _, d := range do {
+			_, err = crawlSelect(s, d, itemValues, log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if kind, rawSelector := traversalNode(rawTransform); kind != "" {
+		selector, do, err := jsonTraversalNode(rawTransform, rawSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		if kind == "closest" && selector == "" {
+			return nil, fmt.Errorf("closest node needs a selector")
+		}
+
+		s := traversals[kind](element, selector)
+		if s.Length() == 0 {
+			if !optional {
+				if selector == "" {
+					return nil, fmt.Errorf("no %s element found", kind)
+				}
+
+				return nil, fmt.Errorf("no %s element %s found", kind, selector)
+			}
+
+			log.Debug("optional element not found", kind, selector)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		for _, d := range do {
+			_, err = crawlSelect(s, d, itemValues, log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if rawSelector, ok := rawTransform["attr"]; ok {
+		selector, do, err := jsonSelectNode(rawTransform, rawSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		attrValue, ok := element.Attr(selector)
+		if !ok {
+			if !optional {
+				return nil, fmt.Errorf("no attribute %s found", selector)
+			}
+
+			log.Debug("optional attribute not found", "attr", selector)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		for _, d := range do {
+			err = crawlStore(attrValue, d, itemValues[len(itemValues)-1], log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if rawSelector, ok := rawTransform["meta"]; ok {
+		key, do, err := jsonSelectNode(rawTransform, rawSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		metaValue, ok := metaValue(element, key, log)
+		if !ok {
+			if !optional {
+				return nil, fmt.Errorf("no meta value %s found", key)
+			}
+
+			log.Debug("optional meta value not found", "meta", key)
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		for _, d := range do {
+			err = crawlStore(metaValue, d, itemValues[len(itemValues)-1], log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if _, ok := rawTransform["text"]; ok {
+		_, do, err := jsonSelectNode(rawTransform, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// entities which are escaped twice by the page would be shown literally
+		text := element.Text()
+		if strings.TrimSpace(text) == "" && optional {
+			log.Debug("optional text not found")
+
+			return itemValues, crawlDefaults(do, itemValues[len(itemValues)-1], log)
+		}
+
+		for _, d := range do {
+			err = crawlStore(html.UnescapeString(text), d, itemValues[len(itemValues)-1], log)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if _, ok := rawTransform["filter"]; ok {
+		// filters are applied after all values of an item are collected
+	} else {
+		return nil, fmt.Errorf("do not know how to transform a node with the elements %s", strings.Join(jsonKeys(rawTransform), ", "))
+	}
+
+	return itemValues, nil
+}
+
+// TraversalNodes holds the selecting nodes which walk from the current element to its parents or siblings
+var TraversalNodes = []string{"parent", "closest", "next", "prev", "siblings"}
+
+var traversals = map[string]func(s *goquery.Selection, selector string) *goquery.Selection{
+	"parent": func(s *goquery.Selection, selector string) *goquery.Selection {
+		if selector == "" {
+			return s.Parent()
+		}
+
+		return s.ParentFiltered(selector)
+	},
+	"closest": func(s *goquery.Selection, selector string) *goquery.Selection {
+		return s.Closest(selector)
+	},
+	"next": func(s *goquery.Selection, selector string) *goquery.Selection {
+		if selector == "" {
+			return s.Next()
+		}
+
+		return s.NextFiltered(selector)
+	},
+	"prev": func(s *goquery.Selection, selector string) *goquery.Selection {
+		if selector == "" {
+			return s.Prev()
+		}
+
+		return s.PrevFiltered(selector)
+	},
+	"siblings": func(s *goquery.Selection, selector string) *goquery.Selection {
+		if selector == "" {
+			return s.Siblings()
+		}
+
+		return s.SiblingsFiltered(selector)
+	},
+}
+
+// traversalNode returns the kind and the selector of a traversal node or an empty kind if the node is none
+func traversalNode(rawTransform map[string]*json.RawMessage) (string, *json.RawMessage) {
+	for _, kind := range TraversalNodes {
+		if rawSelector, ok := rawTransform[kind]; ok {
+			return kind, rawSelector
+		}
+	}
+
+	return "", nil
+}
+
+// SliceModifiers holds the elements of search and find nodes which slice their selection
+var SliceModifiers = []string{"offset", "limit", "eq", "first", "last"}
+
+// sliceSelection applies the offset and limit elements and then the eq, first or last element of the node to the selection
+func sliceSelection(nodes *goquery.Selection, selector string, rawTransform map[string]*json.RawMessage) (*goquery.Selection, error) {
+	offset, hasOffset, err := jsonInt(rawTransform["offset"])
+	if err != nil {
+		return nil, fmt.Errorf("offset attribute of %s must be an integer: %s", selector, err.Error())
+	} else if hasOffset {
+		if offset < 0 {
+			// negative indexes count from the end
+			offset += nodes.Length()
+		}
+		if offset < 0 || offset > nodes.Length() {
+			return nil, fmt.Errorf("offset %d out of range for %s with %d elements", offset, selector, nodes.Length())
+		}
+
+		nodes = nodes.Slice(offset, nodes.Length())
+	}
+
+	limit, hasLimit, err := jsonInt(rawTransform["limit"])
+	if err != nil {
+		return nil, fmt.Errorf("limit attribute of %s must be an integer: %s", selector, err.Error())
+	} else if hasLimit {
+		if limit < 0 {
+			return nil, fmt.Errorf("limit %d of %s must not be negative", limit, selector)
+		}
+		if limit < nodes.Length() {
+			nodes = nodes.Slice(0, limit)
+		}
+	}
+
+	eq, hasEq, err := jsonInt(rawTransform["eq"])
+	if err != nil {
+		return nil, fmt.Errorf("eq attribute of %s must be an integer: %s", selector, err.Error())
+	}
+	first, err := jsonBool(rawTransform["first"])
+	if err != nil {
+		return nil, fmt.Errorf("first attribute of %s must be a boolean: %s", selector, err.Error())
+	}
+	last, err := jsonBool(rawTransform["last"])
+	if err != nil {
+		return nil, fmt.Errorf("last attribute of %s must be a boolean: %s", selector, err.Error())
+	}
+
+	switch {
+	case (hasEq && first) || (hasEq && last) || (first && last):
+		return nil, fmt.Errorf("%s can only use one of eq, first and last", selector)
+	case hasEq:
+		index := eq
+		if index < 0 {
+			// negative indexes count from the end
+			index += nodes.Length()
+		}
+		if index < 0 || index >= nodes.Length() {
+			return nil, fmt.Errorf("eq index %d out of range for %s with %d elements", eq, selector, nodes.Length())
+		}
+
+		nodes = nodes.Eq(index)
+	case first:
+		nodes = nodes.First()
+	case last:
+		nodes = nodes.Last()
+	}
+
+	return nodes, nil
+}
+
+// crawlFilters collects the filter nodes of the given node and its nested nodes
+func crawlFilters(rawTransform map[string]*json.RawMessage) ([]*itemFilter, error) {
+	var filters []*itemFilter
+
+	if rawFilter, ok := rawTransform["filter"]; ok {
+		f := &itemFilter{}
+
+		err := json.Unmarshal(*rawFilter, f)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Field == "" {
+			return nil, fmt.Errorf("filter node needs a field attribute")
+		}
+
+		switch f.Action {
+		case "":
+			f.Action = "drop"
+		case "drop", "keep":
+		default:
+			return nil, fmt.Errorf("unknown filter action %s", f.Action)
+		}
+
+		f.re, err = regexp.Compile(f.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile filter regex: %s", err.Error())
+		}
+
+		filters = append(filters, f)
+	}
+
+	if _, ok := rawTransform["do"]; ok {
+		do, err := jsonArray(rawTransform["do"])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range do {
+			nested, err := crawlFilters(d)
+			if err != nil {
+				return nil, err
+			}
+
+			filters = append(filters, nested...)
+		}
+	}
+
+	return filters, nil
+}
+
+// crawlSelectors compiles the CSS selectors of the search, find and traversal nodes of the given node and its nested nodes
+func crawlSelectors(rawTransform map[string]*json.RawMessage) error {
+	selector := ""
+	if rawSelector, ok := rawTransform["search"]; ok {
+		selector, _ = jsonString(rawSelector)
+	} else if rawSelector, ok := rawTransform["find"]; ok {
+		selector, _ = jsonString(rawSelector)
+	} else if kind, rawSelector := traversalNode(rawTransform); kind != "" {
+		selector, _ = jsonString(rawSelector)
+	}
+
+	if selector != "" {
+		_, err := cascadia.Compile(selector)
+		if err != nil {
+			return fmt.Errorf("cannot parse selector %q: %s", selector, err.Error())
+		}
+	}
+
+	if _, ok := rawTransform["do"]; ok {
+		do, err := jsonArray(rawTransform["do"])
+		if err != nil {
+			return err
+		}
+
+		for _, d := range do {
+			err = crawlSelectors(d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// crawlRegexes compiles the regexes of the regex nodes of the given node and its nested nodes
+func crawlRegexes(rawTransform map[string]*json.RawMessage) error {
+	if _, ok := rawTransform["regex"]; ok {
+		_, err := regexAlternatives(rawTransform)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := rawTransform["do"]; ok {
+		do, err := jsonArray(rawTransform["do"])
+		if err != nil {
+			return err
+		}
+
+		for _, d := range do {
+			err = crawlRegexes(d)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// crawlDefaults stores the default values of all storing nodes in the given nodes and their nested nodes
+func crawlDefaults(do []map[string]*json.RawMessage, itemValue map[string]interface{}, log *slog.Logger) error {
+	for _, d := range do {
+		if _, ok := d["default"]; ok {
+			err := crawlStore("", d, itemValue, log)
+			if err != nil {
+				return err
+			}
+		} else if _, ok := d["do"]; ok {
+			nested, err := jsonArray(d["do"])
+			if err != nil {
+				return err
+			}
+
+			err = crawlDefaults(nested, itemValue, log)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func crawlStore(value string, rawTransform map[string]*json.RawMessage, itemValue map[string]interface{}, log *slog.Logger) error {
+	var err error
+
+	_, hasDefault := rawTransform["default"]
+	def, err := jsonString(rawTransform["default"])
+	if err != nil {
+		return fmt.Errorf("default attribute must be a string: %s", err.Error())
+	}
+
+	value, err = cleanValue(value, rawTransform)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := rawTransform["regex"]; ok {
+		alternatives, err := regexAlternatives(rawTransform)
+		if err != nil {
+			return err
+		}
+
+		all, err := jsonBool(rawTransform["regex-all"])
+		if err != nil {
+			return fmt.Errorf("regex-all attribute must be a boolean: %s", err.Error())
+		}
+
+		regexes := make([]string, len(alternatives))
+		for i, alternative := range alternatives {
+			regexes[i] = alternative.regex
+		}
+		reg := strings.Join(regexes, " or ")
+
+		if all {
+			if _, ok := itemValue[regexAllKey]; ok {
+				return fmt.Errorf("only one regex-all node per item is allowed")
+			}
+
+			// the first alternative with matches is used
+			var alternative regexAlternative
+			var allMatches [][]string
+			for _, alternative = range alternatives {
+				allMatches = alternative.re.FindAllStringSubmatch(value, -1)
+				if allMatches != nil {
+					reg = alternative.regex
+
+					break
+				}
+			}
+
+			var matchValues []map[string]interface{}
+
+			if allMatches == nil && hasDefault {
+				log.Debug("use default value", "regex", reg, "default", def)
+
+				matchValue := make(map[string]interface{})
+
+				err = storeDefaultMatches(alternatives, def, matchValue, log)
+				if err != nil {
+					return err
+				}
+
+				matchValues = append(matchValues, matchValue)
+			}
+
+			for _, matches := range allMatches {
+				matchValue := make(map[string]interface{})
+
+				err = storeMatches(matches, alternative.matches, matchValue, log)
+				if err != nil {
+					return err
+				}
+
+				matchValues = append(matchValues, matchValue)
+			}
+
+			log.Debug("found regex matches", "regex", reg, "count", len(matchValues))
+
+			// the key starts with a NUL byte so that templates cannot use it
+			itemValue[regexAllKey] = matchValues
+
+			return nil
+		}
+
+		if value == "" && hasDefault {
+			log.Debug("use default value", "regex", reg, "default", def)
+
+			return storeDefaultMatches(alternatives, def, itemValue, log)
+		}
+
+		// the first matching alternative is used
+		for _, alternative := range alternatives {
+			matches := alternative.re.FindStringSubmatch(value)
+			if matches != nil {
+				return storeMatches(matches, alternative.matches, itemValue, log)
+			}
+		}
+
+		if !hasDefault {
+			for i := range regexes {
+				regexes[i] = strconv.Quote(regexes[i])
+			}
+
+			return fmt.Errorf("no matches found for %s in %q", strings.Join(regexes, " or "), value)
+		}
+
+		log.Debug("use default value", "regex", reg, "default", def)
+
+		return storeDefaultMatches(alternatives, def, itemValue, log)
+	} else if _, ok := rawTransform["copy"]; ok {
+		if _, ok := rawTransform["name"]; !ok {
+			return fmt.Errorf("copy needs a name attribute")
+		}
+		if _, ok := rawTransform["type"]; !ok {
+			return fmt.Errorf("copy needs a type attribute")
+		}
+
+		name, err := jsonString(rawTransform["name"])
+		if err != nil {
+			return err
+		}
+
+		typ, err := jsonString(rawTransform["type"])
+		if err != nil {
+			return err
+		}
+
+		if value == "" && hasDefault {
+			log.Debug("use default value", "name", name, "default", def)
+
+			value = def
+		}
+
+		err = storeValue(name, typ, value, itemValue, log)
+		if err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("do not know how to transform a node with the elements %s", strings.Join(jsonKeys(rawTransform), ", "))
+	}
+
+	return nil
+}
+
+// regexAlternative represents one regex of a regex node with the matches of its capturing groups
+type regexAlternative struct {
+	regex   string
+	re      *regexp.Regexp
+	matches []map[string]string
+}
+
+// regexAlternatives returns the regexes of a regex node in the order they are tried
+func regexAlternatives(rawTransform map[string]*json.RawMessage) ([]regexAlternative, error) {
+	var err error
+
+	var nodeMatches []map[string]string
+	if rawMatches, ok := rawTransform["matches"]; ok {
+		err = json.Unmarshal(*rawMatches, &nodeMatches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the regex element is one regex or an array of regexes and of hashes with a regex and its own matches element
+	var raws []*json.RawMessage
+	if _, err := jsonString(rawTransform["regex"]); err == nil {
+		raws = []*json.RawMessage{rawTransform["regex"]}
+	} else {
+		err = json.Unmarshal(*rawTransform["regex"], &raws)
+		if err != nil {
+			return nil, fmt.Errorf("regex attribute must be a string or an array: %s", err.Error())
+		} else if len(raws) == 0 {
+			return nil, fmt.Errorf("regex attribute needs at least one regex")
+		}
+	}
+
+	alternatives := make([]regexAlternative, len(raws))
+	for i, raw := range raws {
+		alternative := &alternatives[i]
+
+		if hash, err := jsonHash(raw); err == nil {
+			alternative.regex, err = jsonString(hash["regex"])
+			if err != nil {
+				return nil, err
+			}
+
+			if rawMatches, ok := hash["matches"]; ok {
+				err = json.Unmarshal(*rawMatches, &alternative.matches)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			alternative.regex, err = jsonString(raw)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if alternative.matches == nil {
+			// regexes without their own matches use the matches element of the node
+			if nodeMatches == nil {
+				return nil, fmt.Errorf("regex node requires a matches attribute")
+			}
+
+			alternative.matches = nodeMatches
+		}
+
+		alternative.re, err = regexp.Compile(alternative.regex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile regex: %s", err.Error())
+		}
+	}
+
+	return alternatives, nil
+}
+
+// storeDefaultMatches stores the default value for the matches of all alternatives
+func storeDefaultMatches(alternatives []regexAlternative, def string, itemValue map[string]interface{}, log *slog.Logger) error {
+	for _, alternative := range alternatives {
+		err := storeMatches(defaultMatches(len(alternative.matches), def), alternative.matches, itemValue, log)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// regexAllKey holds the matches of a regex-all node in the values of an item until the item is expanded
+const regexAllKey = "\x00regex-all"
+
+func defaultMatches(count int, def string) []string {
+	matches := make([]string, count+1)
+	for i := range matches {
+		matches[i] = def
+	}
+
+	return matches
+}
+
+// storeMatches stores the capturing groups of a regex match with the names and types of the matches attribute
+func storeMatches(matches []string, transformMatches []map[string]string, itemValue map[string]interface{}, log *slog.Logger) error {
+	if len(matches)-1 != len(transformMatches) {
+		return fmt.Errorf("unequal match count")
+	}
+
+	for i := 0; i < len(transformMatches); i++ {
+		if _, ok := transformMatches[i]["name"]; !ok {
+			return fmt.Errorf("match needs a name attribute")
+		}
+		if _, ok := transformMatches[i]["type"]; !ok {
+			return fmt.Errorf("match needs a type attribute")
+		}
+
+		err := storeValue(transformMatches[i]["name"], transformMatches[i]["type"], matches[i+1], itemValue, log)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeValue stores the value with the given name converted to the given type
+func storeValue(name string, typ string, value string, itemValue map[string]interface{}, log *slog.Logger) error {
+	switch typ {
+	case "int":
+		v, _ := strconv.Atoi(value)
+
+		itemValue[name] = v
+	case "relative-date":
+		t, err := parseRelativeDate(value, time.Now())
+		if err != nil {
+			// unknown relative dates are stored as now
+			log.Debug("cannot parse relative date, use current time", "name", name, "value", value, "error", err)
+		}
+
+		itemValue[name] = t.Format(time.RFC3339)
+	case "string":
+		itemValue[name] = value
+	default:
+		return fmt.Errorf("unknown type %s", typ)
+	}
+
+	return nil
+}
+
+// expandMatches replaces every item holding the matches of a regex-all node with one item per match
+func expandMatches(itemValues []map[string]interface{}) []map[string]interface{} {
+	var expanded []map[string]interface{}
+
+	for _, itemValue := range itemValues {
+		matchValues, ok := itemValue[regexAllKey].([]map[string]interface{})
+		if !ok {
+			expanded = append(expanded, itemValue)
+
+			continue
+		}
+
+		delete(itemValue, regexAllKey)
+
+		for _, matchValue := range matchValues {
+			item := make(map[string]interface{}, len(itemValue)+len(matchValue))
+			// all other values of the item are copied into every new item
+			for name, value := range itemValue {
+				item[name] = value
+			}
+			for name, value := range matchValue {
+				item[name] = value
+			}
+
+			expanded = append(expanded, item)
+		}
+	}
+
+	return expanded
+}
+
+// JSONErrorContext adds the line and column of the given JSON data to syntax and type errors
+func JSONErrorContext(data []byte, err error) error {
+	var offset int64
+
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+		if e.Field != "" {
+			err = fmt.Errorf("field %s: %s", e.Field, err.Error())
+		}
+	default:
+		return err
+	}
+
+	line, column := 1, 1
+
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return fmt.Errorf("line %d, column %d: %s", line, column, err.Error())
+}
+
+func jsonArray(raw *json.RawMessage) ([]map[string]*json.RawMessage, error) {
+	var array []map[string]*json.RawMessage
+
+	err := json.Unmarshal(*raw, &array)
+	if err != nil {
+		return nil, err
+	}
+
+	return array, nil
+}
+
+func jsonHash(raw *json.RawMessage) (map[string]*json.RawMessage, error) {
+	var hash map[string]*json.RawMessage
+
+	err := json.Unmarshal(*raw, &hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+func jsonString(raw *json.RawMessage) (string, error) {
+	if raw == nil {
+		return "", nil
+	}
+
+	var s string
+
+	err := json.Unmarshal(*raw, &s)
+	if err != nil {
+		return "", err
+	}
+
+	return s, nil
+}
+
+func jsonBool(raw *json.RawMessage) (bool, error) {
+	if raw == nil {
+		return false, nil
+	}
+
+	var b bool
+
+	err := json.Unmarshal(*raw, &b)
+	if err != nil {
+		return false, err
+	}
+
+	return b, nil
+}
+
+// jsonInt returns the integer and if the element is set
+func jsonInt(raw *json.RawMessage) (int, bool, error) {
+	if raw == nil {
+		return 0, false, nil
+	}
+
+	var i int
+
+	err := json.Unmarshal(*raw, &i)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return i, true, nil
+}
+
+// jsonTraversalNode works like jsonSelectNode but the selector can also be true to select without a filter
+func jsonTraversalNode(rawTransform map[string]*json.RawMessage, rawSelector *json.RawMessage) (string, []map[string]*json.RawMessage, error) {
+	if _, err := jsonBool(rawSelector); err == nil {
+		return jsonSelectNode(rawTransform, nil)
+	}
+
+	return jsonSelectNode(rawTransform, rawSelector)
+}
+
+func jsonSelectNode(rawTransform map[string]*json.RawMessage, rawSelector *json.RawMessage) (string, []map[string]*json.RawMessage, error) {
+	selector, err := jsonString(rawSelector)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, ok := rawTransform["do"]; !ok {
+		return "", nil, fmt.Errorf("select node needs a do attribute")
+	}
+
+	do, err := jsonArray(rawTransform["do"])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return selector, do, nil
+}
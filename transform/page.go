@@ -0,0 +1,47 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// parseDocument decodes the given page to UTF-8 and parses it
+func parseDocument(data []byte, contentType string, label string, log *slog.Logger) (*goquery.Document, error) {
+	var e encoding.Encoding
+	var name string
+
+	// the charset is taken from the given label, the given content type, a BOM or a meta tag of the page in this order
+	if label != "" {
+		e, name = charset.Lookup(label)
+		if e == nil {
+			return nil, fmt.Errorf("unknown charset %q", label)
+		}
+	} else {
+		e, name, _ = charset.DetermineEncoding(data, contentType)
+	}
+
+	log.Debug("decode page", "charset", name)
+
+	return goquery.NewDocumentFromReader(e.NewDecoder().Reader(bytes.NewReader(data)))
+}
+
+// parseJSON decodes the given page as JSON and keeps numbers as json.Number
+func parseJSON(data []byte) (interface{}, error) {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, JSONErrorContext(data, err)
+	}
+
+	return v, nil
+}
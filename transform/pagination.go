@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// PaginationMaxPages is the default of the max-pages element of the pagination element
+const PaginationMaxPages = 5
+
+// Pagination represents the pagination element of a transform
+type Pagination struct {
+	// Next is the selector of the link to the next page of html sources or the path of the URL of the next page of json sources
+	Next string
+	// MaxPages is the max count of transformed pages including the page of the feed
+	MaxPages int
+}
+
+// parsePagination parses the pagination element of a transform with the given source
+func parsePagination(raw *json.RawMessage, source string) (*Pagination, error) {
+	var err error
+
+	node, err := jsonHash(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be a hash")
+	}
+
+	p := &Pagination{
+		MaxPages: PaginationMaxPages,
+	}
+
+	if node["next"] != nil {
+		p.Next, err = jsonString(node["next"])
+		if err != nil {
+			return nil, fmt.Errorf("next must be a string")
+		}
+	}
+	if p.Next == "" {
+		return nil, fmt.Errorf("needs a next element")
+	} else if source == "feed" {
+		return nil, fmt.Errorf("next needs a html or json source")
+	} else if source == "json" {
+		_, err = parsePath(p.Next)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse path of next: %s", err.Error())
+		}
+	}
+
+	if node["max-pages"] != nil {
+		p.MaxPages, _, err = jsonInt(node["max-pages"])
+		if err != nil {
+			return nil, fmt.Errorf("max-pages must be an integer")
+		} else if p.MaxPages < 1 {
+			return nil, fmt.Errorf("max-pages must be at least 1")
+		}
+	}
+
+	return p, nil
+}
+
+// NextPage returns the absolute URL of the next page which the next element of the backfill element or of the pagination element selects on the given page of the URL, or an empty string if the page links no next page
+func (s *Spec) NextPage(next string, page []byte, contentType string, pageURL string) (string, error) {
+	if next == "" {
+		return "", nil
+	}
+
+	var link string
+
+	if s.Source == "json" {
+		data, err := parseJSON(page)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse page: %s", err.Error())
+		}
+
+		value, _, err := selectJSONPath(data, next)
+		if err != nil {
+			return "", err
+		}
+
+		link, err = jsonValueString(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot use next page of %s: %s", next, err.Error())
+		}
+	} else {
+		doc, err := parseDocument(page, contentType, s.Request.Charset, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err != nil {
+			return "", fmt.Errorf("cannot parse page: %s", err.Error())
+		}
+
+		link, _ = doc.Find(next).First().Attr("href")
+	}
+
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := base.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse next page %q: %s", link, err.Error())
+	}
+
+	return u.String(), nil
+}
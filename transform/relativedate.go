@@ -0,0 +1,162 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeDateLanguage holds the words of relative dates like "3 minutes ago" or "yesterday" of a language
+type relativeDateLanguage struct {
+	// days maps words like yesterday to the count of days before now
+	days map[string]int
+	// ago matches the count and the unit of dates like "3 minutes ago"
+	ago *regexp.Regexp
+	// counts maps words like "a" to their count
+	counts map[string]int
+	// units maps the words of units to the units second, minute, hour, day, week, month and year
+	units map[string]string
+}
+
+// relativeDateLanguages holds the languages of relative dates which are tried in order
+var relativeDateLanguages = []relativeDateLanguage{
+	{
+		days: map[string]int{
+			"now":       0,
+			"just now":  0,
+			"today":     0,
+			"yesterday": 1,
+		},
+		ago: regexp.MustCompile(`^(?:about |almost |over )?(\d+|[a-z]+)\s*([a-z]+)\s+ago$`),
+		counts: map[string]int{
+			"a":   1,
+			"an":  1,
+			"one": 1,
+		},
+		units: map[string]string{
+			"s":       "second",
+			"sec":     "second",
+			"secs":    "second",
+			"second":  "second",
+			"seconds": "second",
+			"m":       "minute",
+			"min":     "minute",
+			"mins":    "minute",
+			"minute":  "minute",
+			"minutes": "minute",
+			"h":       "hour",
+			"hr":      "hour",
+			"hrs":     "hour",
+			"hour":    "hour",
+			"hours":   "hour",
+			"d":       "day",
+			"day":     "day",
+			"days":    "day",
+			"w":       "week",
+			"week":    "week",
+			"weeks":   "week",
+			"month":   "month",
+			"months":  "month",
+			"y":       "year",
+			"year":    "year",
+			"years":   "year",
+		},
+	},
+	{
+		days: map[string]int{
+			"jetzt":       0,
+			"gerade eben": 0,
+			"heute":       0,
+			"gestern":     1,
+			"vorgestern":  2,
+		},
+		ago: regexp.MustCompile(`^vor (?:etwa |ca\. |über )?(\d+|[a-zäöü]+)\s*([a-zäöü]+)\.?$`),
+		counts: map[string]int{
+			"ein":   1,
+			"einem": 1,
+			"einer": 1,
+		},
+		units: map[string]string{
+			"sek":      "second",
+			"sekunde":  "second",
+			"sekunden": "second",
+			"min":      "minute",
+			"minute":   "minute",
+			"minuten":  "minute",
+			"std":      "hour",
+			"stunde":   "hour",
+			"stunden":  "hour",
+			"tag":      "day",
+			"tagen":    "day",
+			"woche":    "week",
+			"wochen":   "week",
+			"monat":    "month",
+			"monaten":  "month",
+			"jahr":     "year",
+			"jahren":   "year",
+		},
+	},
+}
+
+// parseRelativeDate returns the time of a relative date like "3 minutes ago", "yesterday" or "vor 2 Tagen" relative to the given time
+func parseRelativeDate(value string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(value), " "))
+
+	for _, language := range relativeDateLanguages {
+		if days, ok := language.days[s]; ok {
+			// dates of days like "yesterday" keep the clock of the given time
+			return now.AddDate(0, 0, -days), nil
+		}
+
+		matches := language.ago.FindStringSubmatch(s)
+		if matches == nil {
+			continue
+		}
+
+		count, err := strconv.Atoi(matches[1])
+		if err != nil {
+			var ok bool
+			count, ok = language.counts[matches[1]]
+			if !ok {
+				continue
+			}
+		}
+
+		unit, ok := language.units[matches[2]]
+		if !ok {
+			continue
+		}
+
+		switch unit {
+		case "second":
+			return now.Add(-time.Duration(count) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(count) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(count) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -count), nil
+		case "week":
+			return now.AddDate(0, 0, -7*count), nil
+		case "month":
+			return addMonths(now, -count), nil
+		case "year":
+			return addMonths(now, -12*count), nil
+		}
+	}
+
+	return now, fmt.Errorf("unknown relative date %q", value)
+}
+
+// addMonths adds the months to the time and clamps days which the resulting month does not have to its last day
+func addMonths(t time.Time, months int) time.Time {
+	shifted := t.AddDate(0, months, 0)
+	// AddDate would move a month before March 31 to the start of March instead of the last day of February
+	if shifted.Day() != t.Day() {
+		shifted = shifted.AddDate(0, 0, -shifted.Day())
+	}
+
+	return shifted
+}
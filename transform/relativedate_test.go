@@ -0,0 +1,179 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRelativeDate(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 4, 5, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value    string
+		expected time.Time
+	}{
+		// English
+		{"now", now},
+		{"just now", now},
+		{"today", now},
+		{"yesterday", time.Date(2024, 3, 30, 15, 4, 5, 0, time.UTC)},
+		{"3 seconds ago", now.Add(-3 * time.Second)},
+		{"30 secs ago", now.Add(-30 * time.Second)},
+		{"a minute ago", now.Add(-time.Minute)},
+		{"3 minutes ago", now.Add(-3 * time.Minute)},
+		{"5min ago", now.Add(-5 * time.Minute)},
+		{"an hour ago", now.Add(-time.Hour)},
+		{"about 2 hours ago", now.Add(-2 * time.Hour)},
+		{"2h ago", now.Add(-2 * time.Hour)},
+		{"one day ago", time.Date(2024, 3, 30, 15, 4, 5, 0, time.UTC)},
+		{"3 days ago", time.Date(2024, 3, 28, 15, 4, 5, 0, time.UTC)},
+		{"2 weeks ago", time.Date(2024, 3, 17, 15, 4, 5, 0, time.UTC)},
+		{"over 1 year ago", time.Date(2023, 3, 31, 15, 4, 5, 0, time.UTC)},
+		// case and spaces do not matter
+		{"  3   Minutes  AGO ", now.Add(-3 * time.Minute)},
+		{"Yesterday", time.Date(2024, 3, 30, 15, 4, 5, 0, time.UTC)},
+
+		// German
+		{"jetzt", now},
+		{"gerade eben", now},
+		{"heute", now},
+		{"gestern", time.Date(2024, 3, 30, 15, 4, 5, 0, time.UTC)},
+		{"vorgestern", time.Date(2024, 3, 29, 15, 4, 5, 0, time.UTC)},
+		{"vor 10 Sekunden", now.Add(-10 * time.Second)},
+		{"vor einer Minute", now.Add(-time.Minute)},
+		{"vor 5 Min.", now.Add(-5 * time.Minute)},
+		{"vor einer Stunde", now.Add(-time.Hour)},
+		{"vor etwa 3 Std.", now.Add(-3 * time.Hour)},
+		{"vor einem Tag", time.Date(2024, 3, 30, 15, 4, 5, 0, time.UTC)},
+		{"vor 2 Tagen", time.Date(2024, 3, 29, 15, 4, 5, 0, time.UTC)},
+		{"vor einer Woche", time.Date(2024, 3, 24, 15, 4, 5, 0, time.UTC)},
+		{"vor ca. 2 Wochen", time.Date(2024, 3, 17, 15, 4, 5, 0, time.UTC)},
+		{"vor über einem Jahr", time.Date(2023, 3, 31, 15, 4, 5, 0, time.UTC)},
+		{"Vor 2 Jahren", time.Date(2022, 3, 31, 15, 4, 5, 0, time.UTC)},
+
+		// boundaries
+		{"0 seconds ago", now},
+		{"vor 0 Minuten", now},
+		{"a month ago", time.Date(2024, 2, 29, 15, 4, 5, 0, time.UTC)},
+		{"vor einem Monat", time.Date(2024, 2, 29, 15, 4, 5, 0, time.UTC)},
+		{"13 months ago", time.Date(2023, 2, 28, 15, 4, 5, 0, time.UTC)},
+		{"vor 6 Monaten", time.Date(2023, 9, 30, 15, 4, 5, 0, time.UTC)},
+		{"1000 days ago", time.Date(2021, 7, 5, 15, 4, 5, 0, time.UTC)},
+		{"90 minutes ago", time.Date(2024, 3, 31, 13, 34, 5, 0, time.UTC)},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			actual, err := parseRelativeDate(tc.value, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !actual.Equal(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseRelativeDateBoundaries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		now      time.Time
+		value    string
+		expected time.Time
+	}{
+		{"yesterday of new year", time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC), "yesterday", time.Date(2023, 12, 31, 0, 30, 0, 0, time.UTC)},
+		{"hour before midnight", time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC), "an hour ago", time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC)},
+		{"month of new year", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), "vor einem Monat", time.Date(2023, 12, 15, 12, 0, 0, 0, time.UTC)},
+		{"year of leap day", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), "a year ago", time.Date(2023, 2, 28, 12, 0, 0, 0, time.UTC)},
+		{"years of leap day", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC), "vor 4 Jahren", time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"month of long month", time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC), "1 month ago", time.Date(2024, 4, 30, 12, 0, 0, 0, time.UTC)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseRelativeDate(tc.value, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !actual.Equal(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseRelativeDateInvalid(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 4, 5, 0, time.UTC)
+
+	for _, value := range []string{
+		"",
+		"   ",
+		"ago",
+		"vor",
+		"tomorrow",
+		"morgen",
+		"in 3 days",
+		"3 days",
+		"-3 days ago",
+		"3.5 hours ago",
+		"some minutes ago",
+		"3 fortnights ago",
+		"vor Tagen",
+		"vor 3 Fortnächten",
+		"vor drei Tagen",
+		"99999999999999999999 years ago",
+		"2024-03-31",
+		// the words of one language do not mix with the other
+		"3 Tagen ago",
+		"vor 3 days",
+	} {
+		t.Run(value, func(t *testing.T) {
+			actual, err := parseRelativeDate(value, now)
+			if err == nil || !strings.Contains(err.Error(), "unknown relative date") {
+				t.Fatalf("expected an error for %q, got %s and %v", value, actual, err)
+			}
+
+			// unknown relative dates fall back to the given time
+			if !actual.Equal(now) {
+				t.Errorf("expected the given time, got %s", actual)
+			}
+		})
+	}
+}
+
+func TestExtractRelativeDate(t *testing.T) {
+	before := time.Now()
+
+	s, err := Parse(`{
+		"items": [{"search": "div.post", "do": [
+			{"attr": "data-id", "do": [{"copy": true, "name": "id", "type": "int"}]},
+			{"find": "p.meta", "do": [{"text": true, "do": [{"regex": "^Posted on (\\S+)", "matches": [{"name": "date", "type": "relative-date"}]}]}]}
+		]}],
+		"transform": {"title": "{{.id}}", "uri": "/{{.id}}", "description": "{{.date}}"}
+	}`)
+	if err != nil {
+		t.Fatalf("cannot parse transform: %v", err)
+	}
+
+	items, err := s.Extract(testDocument(t, "posts.html"))
+	if err != nil {
+		t.Fatalf("expected unknown relative dates not to fail the items, got %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+
+	after := time.Now()
+
+	// the absolute dates of the fixture are no relative dates and fall back to the time of the crawl
+	for _, item := range items {
+		date, err := time.Parse(time.RFC3339, item.Description)
+		if err != nil {
+			t.Fatalf("expected an RFC 3339 date, got %q", item.Description)
+		}
+
+		if date.Before(before.Truncate(time.Second)) || date.After(after) {
+			t.Errorf("expected a date between %s and %s, got %s", before, after, date)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFunction represents a function which can be used in the templates of the transform element
+type templateFunction struct {
+	Name        string
+	Usage       string
+	Description string
+	Function    interface{}
+}
+
+var templateFunctions = []templateFunction{
+	{"htmlescape", "htmlescape STRING", "Escape the special HTML characters of STRING", html.EscapeString},
+	{"htmlunescape", "htmlunescape STRING", "Unescape the HTML entities of STRING", html.UnescapeString},
+	{"lower", "lower STRING", "Convert STRING to lower case", strings.ToLower},
+	{"replace", "replace OLD NEW STRING", "Replace all occurrences of OLD in STRING with NEW", templateReplace},
+	{"title", "title STRING", "Convert the first letter of every word of STRING to upper case", templateTitle},
+	{"trim", "trim STRING", "Remove leading and trailing white space of STRING", strings.TrimSpace},
+	{"truncate", "truncate N STRING", "Cut STRING to at most N characters", templateTruncate},
+	{"upper", "upper STRING", "Convert STRING to upper case", strings.ToUpper},
+	{"urldecode", "urldecode STRING", "Decode the URL query escaped STRING", url.QueryUnescape},
+	{"urlencode", "urlencode STRING", "Escape STRING so it can be used in a URL query", url.QueryEscape},
+}
+
+func templateFuncMap() template.FuncMap {
+	funcs := template.FuncMap{}
+
+	for _, f := range templateFunctions {
+		funcs[f.Name] = f.Function
+	}
+
+	return funcs
+}
+
+func templateReplace(old string, new string, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func templateTitle(s string) string {
+	var out strings.Builder
+
+	previous := ' '
+	for _, r := range s {
+		if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+			r = unicode.ToUpper(r)
+		}
+
+		out.WriteRune(r)
+
+		previous = r
+	}
+
+	return out.String()
+}
+
+func templateTruncate(n int, s string) string {
+	if n < 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+// PrintTemplateFunctions writes a table of all template functions with their usage and description
+func PrintTemplateFunctions(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FUNCTION\tDESCRIPTION")
+
+	for _, f := range templateFunctions {
+		fmt.Fprintf(w, "%s\t%s\n", f.Usage, f.Description)
+	}
+
+	return w.Flush()
+}
+
+// ParseNotifyTemplate parses the template of a notification body
+func ParseNotifyTemplate(name string, text string) (*template.Template, error) {
+	funcs := templateFuncMap()
+	// notify templates can also encode values as JSON
+	funcs["json"] = func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+
+		return string(data), err
+	}
+
+	return template.New(name).Funcs(funcs).Parse(text)
+}
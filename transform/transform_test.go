@@ -0,0 +1,599 @@
+package transform
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/zimmski/feedme"
+)
+
+// testDocument returns the parsed HTML fixture of the testdata directory
+func testDocument(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	doc, err := goquery.NewDocumentFromReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+// testItem holds the compared fields of an extracted item
+type testItem struct {
+	Title       string
+	URI         string
+	Description string
+}
+
+// extractTestItems parses the transform and extracts the compared fields of the items of the HTML fixture
+func extractTestItems(t *testing.T, spec string, fixture string) ([]testItem, error) {
+	t.Helper()
+
+	s, err := Parse(spec)
+	if err != nil {
+		t.Fatalf("cannot parse transform: %v", err)
+	}
+
+	items, err := s.Extract(testDocument(t, fixture))
+	if err != nil {
+		return nil, err
+	}
+
+	return testItems(items), nil
+}
+
+func testItems(items []feedme.Item) []testItem {
+	var compared []testItem
+	for _, item := range items {
+		compared = append(compared, testItem{
+			Title:       item.Title,
+			URI:         item.URI,
+			Description: item.Description,
+		})
+	}
+
+	return compared
+}
+
+func checkTestItems(t *testing.T, expected []testItem, actual []testItem) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d items, got %d: %+v", len(expected), len(actual), actual)
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("item %d: expected %+v, got %+v", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transform string
+		expected  []testItem
+	}{
+		{
+			name: "search find attr text copy",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "h2 a", "do": [
+					{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+					{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+				]}]}],
+				"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+			}`,
+			expected: []testItem{
+				{Title: "First post", URI: "/post/1"},
+				{Title: "Second post", URI: "/post/2"},
+				{Title: "Third post", URI: "/post/3"},
+			},
+		},
+		{
+			name: "copy int",
+			transform: `{
+				"items": [{"search": "div.post", "do": [
+					{"attr": "data-id", "do": [{"copy": true, "name": "id", "type": "int"}]}
+				]}],
+				"transform": {"title": "#{{.id}}", "uri": "/?id={{.id}}"}
+			}`,
+			expected: []testItem{
+				{Title: "#1", URI: "/?id=1"},
+				{Title: "#2", URI: "/?id=2"},
+				{Title: "#3", URI: "/?id=3"},
+			},
+		},
+		{
+			name: "regex of attr",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "h2 a", "do": [
+					{"attr": "href", "do": [{"regex": "^/post/(\\d+)$", "matches": [{"name": "id", "type": "int"}]}]}
+				]}]}],
+				"transform": {"title": "Post {{.id}}", "uri": "/p?id={{.id}}"}
+			}`,
+			expected: []testItem{
+				{Title: "Post 1", URI: "/p?id=1"},
+				{Title: "Post 2", URI: "/p?id=2"},
+				{Title: "Post 3", URI: "/p?id=3"},
+			},
+		},
+		{
+			name: "regex of text",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "p.meta", "do": [
+					{"text": true, "do": [{"regex": "Posted on (\\S+) by (\\w+)", "matches": [
+						{"name": "day", "type": "string"},
+						{"name": "author", "type": "string"}
+					]}]}
+				]}]}],
+				"transform": {"title": "{{.author}}", "uri": "/{{.day}}", "description": "{{.author}} on {{.day}}"}
+			}`,
+			expected: []testItem{
+				{Title: "Alice", URI: "/2024-01-02", Description: "Alice on 2024-01-02"},
+				{Title: "Bob", URI: "/2024-01-03", Description: "Bob on 2024-01-03"},
+				{Title: "Carol", URI: "/2024-01-04", Description: "Carol on 2024-01-04"},
+			},
+		},
+		{
+			name: "search of search",
+			transform: `{
+				"items": [{"search": "#posts", "do": [{"search": "div.post[data-id='2']", "do": [{"find": "h2 a", "do": [
+					{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+					{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+				]}]}]}],
+				"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+			}`,
+			expected: []testItem{
+				{Title: "Second post", URI: "/post/2"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			items, err := extractTestItems(t, tc.transform, "posts.html")
+			if err != nil {
+				t.Fatalf("cannot extract items: %v", err)
+			}
+
+			checkTestItems(t, tc.expected, items)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transform string
+		expected  string
+	}{
+		{
+			name:      "missing items",
+			transform: `{"transform": {"title": "x", "uri": "/"}}`,
+			expected:  "transform JSON needs a items element",
+		},
+		{
+			name:      "missing transform",
+			transform: `{"items": []}`,
+			expected:  "transform JSON needs a transform element",
+		},
+		{
+			name:      "invalid JSON",
+			transform: `{"items": [}`,
+			expected:  "cannot parse transform JSON",
+		},
+		{
+			name: "bad selector of search",
+			transform: `{
+				"items": [{"search": "div[class", "do": [{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}]}],
+				"transform": {"title": "{{.title}}", "uri": "/"}
+			}`,
+			expected: `cannot parse selector "div[class"`,
+		},
+		{
+			name: "bad selector of find",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "a:unknown", "do": [{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}]}]}],
+				"transform": {"title": "{{.title}}", "uri": "/"}
+			}`,
+			expected: `cannot parse selector "a:unknown"`,
+		},
+		{
+			name: "bad regex",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"text": true, "do": [{"regex": "(\\d+", "matches": [{"name": "id", "type": "int"}]}]}]}],
+				"transform": {"title": "{{.id}}", "uri": "/"}
+			}`,
+			expected: "cannot compile regex",
+		},
+		{
+			name: "regex without matches",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"text": true, "do": [{"regex": "(\\d+)"}]}]}],
+				"transform": {"title": "x", "uri": "/"}
+			}`,
+			expected: "regex node requires a matches attribute",
+		},
+		{
+			name: "bad template",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}]}],
+				"transform": {"title": "{{.title", "uri": "/"}
+			}`,
+			expected: "cannot create transform template",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.transform)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transform string
+		expected  string
+	}{
+		{
+			name: "missing attribute",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"attr": "data-missing", "do": [{"copy": true, "name": "title", "type": "string"}]}]}],
+				"transform": {"title": "{{.title}}", "uri": "/"}
+			}`,
+			expected: "no attribute data-missing found",
+		},
+		{
+			name: "missing element",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "span.missing", "do": [{"attr": "href", "do": [{"copy": true, "name": "title", "type": "string"}]}]}]}],
+				"transform": {"title": "{{.title}}", "uri": "/"}
+			}`,
+			expected: "no attribute href found",
+		},
+		{
+			name: "missing do",
+			transform: `{
+				"items": [{"search": "div.post"}],
+				"transform": {"title": "x", "uri": "/"}
+			}`,
+			expected: "select node needs a do attribute",
+		},
+		{
+			name: "regex without match",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"find": "h2 a", "do": [
+					{"attr": "href", "do": [{"regex": "^/article/(\\d+)$", "matches": [{"name": "id", "type": "int"}]}]}
+				]}]}],
+				"transform": {"title": "{{.id}}", "uri": "/"}
+			}`,
+			expected: `no matches found for "^/article/(\\d+)$" in "/post/`,
+		},
+		{
+			name: "unknown type",
+			transform: `{
+				"items": [{"search": "div.post", "do": [{"attr": "data-id", "do": [{"copy": true, "name": "id", "type": "float"}]}]}],
+				"transform": {"title": "{{.id}}", "uri": "/"}
+			}`,
+			expected: "unknown type float",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := extractTestItems(t, tc.transform, "posts.html")
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Fatalf("expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseInvalidRegex(t *testing.T) {
+	for name, regex := range map[string]string{
+		"regex":       `"(a"`,
+		"alternative": `["(\\d+)", "(a"]`,
+		"hash":        `[{"regex": "(a", "matches": [{"name": "title", "type": "string"}]}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(`{
+				"items": [{"search": "div", "do": [{"text": true, "do": [
+					{"regex": ` + regex + `, "matches": [{"name": "title", "type": "string"}]}
+				]}]}],
+				"transform": {"title": "{{.title}}", "uri": "/"}
+			}`)
+			if err == nil || !strings.Contains(err.Error(), "cannot compile regex") {
+				t.Fatalf("expected an error for the invalid regex, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateBadSelector(t *testing.T) {
+	errs := Validate(`{
+		"items": [{"search": "div[class", "do": [{"closest": "a:unknown", "do": [{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}]}]}],
+		"transform": {"title": "{{.title}}", "uri": "/"}
+	}`)
+
+	var paths []string
+	for _, err := range errs {
+		if strings.Contains(err.Message, "cannot parse selector") {
+			paths = append(paths, err.Path)
+		}
+	}
+
+	if strings.Join(paths, " ") != "items[0].search items[0].do[0].closest" {
+		t.Fatalf("expected errors for both selectors, got %v", errs)
+	}
+}
+
+func TestExtractOptionalDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		do       string
+		expected []string
+	}{
+		{
+			name:     "optional find with default",
+			do:       `{"find": "img", "optional": true, "do": [{"attr": "src", "do": [{"copy": true, "name": "value", "type": "string", "default": "/images/none.png"}]}]}`,
+			expected: []string{"/images/1.png", "/images/2.png", "/images/none.png"},
+		},
+		{
+			name:     "optional find without default",
+			do:       `{"find": "img", "optional": true, "do": [{"attr": "src", "do": [{"copy": true, "name": "value", "type": "string"}]}]}`,
+			expected: []string{"/images/1.png", "/images/2.png", ""},
+		},
+		{
+			name:     "optional attr with default",
+			do:       `{"find": "h2 a", "do": [{"attr": "title", "optional": true, "do": [{"copy": true, "name": "value", "type": "string", "default": "untitled"}]}]}`,
+			expected: []string{"untitled", "untitled", "untitled"},
+		},
+		{
+			name:     "optional text with default",
+			do:       `{"find": "span.tags", "optional": true, "do": [{"text": true, "optional": true, "do": [{"copy": true, "name": "value", "type": "string", "default": "none"}]}]}`,
+			expected: []string{"go, web", "none", "none"},
+		},
+		{
+			name:     "optional find with default of nested regex",
+			do:       `{"find": "img", "optional": true, "do": [{"attr": "src", "do": [{"regex": "/(\\d+)\\.png$", "matches": [{"name": "value", "type": "int"}], "default": "7"}]}]}`,
+			expected: []string{"1", "2", "7"},
+		},
+		{
+			name:     "default of regex without match",
+			do:       `{"find": "p.meta", "do": [{"text": true, "do": [{"regex": "by (Bob)$", "matches": [{"name": "value", "type": "string"}], "default": "someone"}]}]}`,
+			expected: []string{"someone", "Bob", "someone"},
+		},
+		{
+			name:     "default of optional regex alternatives",
+			do:       `{"find": "img", "optional": true, "do": [{"attr": "alt", "do": [{"regex": ["^(Second)$", {"regex": "^(F)irst$", "matches": [{"name": "value", "type": "string"}]}], "matches": [{"name": "value", "type": "string"}], "default": "none"}]}]}`,
+			expected: []string{"F", "Second", "none"},
+		},
+		{
+			name:     "default is not cleaned",
+			do:       `{"find": "span.tags", "optional": true, "do": [{"text": true, "do": [{"copy": true, "name": "value", "type": "string", "trim": true, "case": "upper", "default": " none "}]}]}`,
+			expected: []string{"GO, WEB", " none ", " none "},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Parse(`{
+				"items": [{"search": "div.post", "do": [
+					{"attr": "data-id", "do": [{"copy": true, "name": "id", "type": "int"}]},
+					` + tc.do + `
+				]}],
+				"transform": {"title": "{{.id}}", "uri": "/{{.id}}", "description": "{{if .value}}{{.value}}{{end}}"}
+			}`)
+			if err != nil {
+				t.Fatalf("cannot parse transform: %v", err)
+			}
+
+			items, err := s.Extract(testDocument(t, "posts.html"))
+			if err != nil {
+				t.Fatalf("cannot extract items: %v", err)
+			}
+
+			var values []string
+			for _, item := range items {
+				values = append(values, item.Description)
+			}
+
+			if strings.Join(values, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("expected the values %q, got %q", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestExtractRequiredWithDefault(t *testing.T) {
+	// defaults do not make missing elements of required nodes optional
+	_, err := extractTestItems(t, `{
+		"items": [{"search": "div.post", "do": [{"find": "img", "do": [
+			{"attr": "src", "do": [{"copy": true, "name": "title", "type": "string", "default": "none"}]}
+		]}]}],
+		"transform": {"title": "{{.title}}", "uri": "/"}
+	}`, "posts.html")
+	if err == nil || !strings.Contains(err.Error(), "no attribute src found") {
+		t.Fatalf("expected an error for the missing element, got %v", err)
+	}
+}
+
+func TestExtractPageCharset(t *testing.T) {
+	transform := func(charset string) string {
+		return `{
+			"request": {"charset": "` + charset + `"},
+			"items": [{"search": "div.offer", "do": [{"find": "a", "do": [
+				{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+				{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+			]}]}],
+			"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+		}`
+	}
+
+	latin1 := []string{"Café Müller", "Größe: 42 ½"}
+	windows1252 := []string{"Preis: 5 € – „Angebot“", "Déjà vu™"}
+
+	for _, tc := range []struct {
+		name        string
+		fixture     string
+		contentType string
+		charset     string
+		expected    []string
+	}{
+		{"meta tag of ISO-8859-1", "iso-8859-1.html", "text/html", "", latin1},
+		{"meta tag of Windows-1252", "windows-1252.html", "text/html", "", windows1252},
+		{"Content-Type header", "iso-8859-1-header.html", "text/html; charset=ISO-8859-1", "", latin1},
+		{"Content-Type header before meta tag", "windows-1252.html", "text/html; charset=windows-1252", "", windows1252},
+		{"charset of request for wrong header", "iso-8859-1-header.html", "text/html; charset=utf-8", "iso-8859-1", latin1},
+		{"charset of request for wrong meta tag", "windows-1252.html", "text/html", "latin1", windows1252},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := Parse(transform(tc.charset))
+			if err != nil {
+				t.Fatalf("cannot parse transform: %v", err)
+			}
+
+			items, _, err := s.ExtractPage(data, tc.contentType, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("cannot extract items: %v", err)
+			}
+
+			var titles []string
+			for _, item := range items {
+				titles = append(titles, item.Title)
+			}
+
+			if strings.Join(titles, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("expected the titles %q, got %q", tc.expected, titles)
+			}
+		})
+	}
+
+	s, err := Parse(transform("unknown"))
+	if err != nil {
+		t.Fatalf("cannot parse transform: %v", err)
+	}
+
+	_, _, err = s.ExtractPage([]byte("<html></html>"), "text/html", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), `unknown charset "unknown"`) {
+		t.Errorf("expected an error for the unknown charset, got %v", err)
+	}
+}
+
+func TestExtractSlice(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		search   string
+		find     string
+		expected []string
+		err      string
+	}{
+		{name: "all rows", search: `"search": "tr"`, expected: []string{"Version", "1.0", "1.1", "1.2", "2.0", "Older releases"}},
+		{name: "skip header row", search: `"search": "tr", "offset": 1, "limit": 4`, expected: []string{"1.0", "1.1", "1.2", "2.0"}},
+		{name: "negative limit", search: `"search": "tr", "offset": 1, "limit": -1`, err: "limit -1 of tr must not be negative"},
+		{name: "negative offset", search: `"search": "tr", "offset": -2`, expected: []string{"2.0", "Older releases"}},
+		{name: "offset of all rows", search: `"search": "tr", "offset": 6`, expected: nil},
+		{name: "limit beyond rows", search: `"search": "tr", "offset": 1, "limit": 100`, expected: []string{"1.0", "1.1", "1.2", "2.0", "Older releases"}},
+		{name: "limit of zero", search: `"search": "tr", "limit": 0`, expected: nil},
+		{name: "eq", search: `"search": "tr", "eq": 2`, expected: []string{"1.1"}},
+		{name: "negative eq", search: `"search": "tr", "eq": -2`, expected: []string{"2.0"}},
+		{name: "eq after offset", search: `"search": "tr", "offset": 1, "eq": 0`, expected: []string{"1.0"}},
+		{name: "first after offset", search: `"search": "tr", "offset": 1, "first": true`, expected: []string{"1.0"}},
+		{name: "last after limit", search: `"search": "tr", "limit": 5, "last": true`, expected: []string{"2.0"}},
+		{name: "first of find", search: `"search": "table"`, find: `"first": true`, expected: []string{"Version"}},
+		{name: "last of find", search: `"search": "table"`, find: `"last": true`, expected: []string{"Older releases"}},
+
+		{name: "offset out of range", search: `"search": "tr", "offset": 7`, err: "offset 7 out of range for tr with 6 elements"},
+		{name: "negative offset out of range", search: `"search": "tr", "offset": -7`, err: "offset -1 out of range for tr with 6 elements"},
+		{name: "eq out of range", search: `"search": "tr", "eq": 6`, err: "eq index 6 out of range for tr with 6 elements"},
+		{name: "negative eq out of range", search: `"search": "tr", "eq": -7`, err: "eq index -7 out of range for tr with 6 elements"},
+		{name: "eq out of range of find", search: `"search": "table"`, find: `"eq": 7`, err: "eq index 7 out of range for a with 6 elements"},
+		{name: "eq and first", search: `"search": "tr", "eq": 1, "first": true`, err: "tr can only use one of eq, first and last"},
+		{name: "offset of wrong type", search: `"search": "tr", "offset": "1"`, err: "offset attribute of tr must be an integer"},
+		{name: "first of wrong type", search: `"search": "tr", "first": 1`, err: "first attribute of tr must be a boolean"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			find := `"find": "a"`
+			if tc.find != "" {
+				find += ", " + tc.find
+			}
+
+			items, err := extractTestItems(t, `{
+				"items": [{`+tc.search+`, "do": [{`+find+`, "do": [
+					{"attr": "href", "do": [{"copy": true, "name": "uri", "type": "string"}]},
+					{"text": true, "do": [{"copy": true, "name": "title", "type": "string"}]}
+				]}]}],
+				"transform": {"title": "{{.title}}", "uri": "{{.uri}}"}
+			}`, "table.html")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected an error containing %q, got %v", tc.err, err)
+				}
+
+				return
+			} else if err != nil {
+				t.Fatalf("cannot extract items: %v", err)
+			}
+
+			var titles []string
+			for _, item := range items {
+				titles = append(titles, item.Title)
+			}
+
+			if strings.Join(titles, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("expected the items %q, got %q", tc.expected, titles)
+			}
+		})
+	}
+}
+
+func TestParseMaxLength(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		maxLength string
+		expected  map[string]int
+	}{
+		{"missing", "", map[string]int{}},
+		{"null", `"max-length": null,`, map[string]int{}},
+		{"empty", `"max-length": {},`, map[string]int{}},
+		{"title", `"max-length": {"title": 80},`, map[string]int{"title": 80}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Parse(`{
+				` + tc.maxLength + `
+				"items": [{"search": "div.post", "do": [{"attr": "data-id", "do": [{"copy": true, "name": "id", "type": "int"}]}]}],
+				"transform": {"title": "{{.id}}", "uri": "/{{.id}}"}
+			}`)
+			if err != nil {
+				t.Fatalf("cannot parse transform: %v", err)
+			}
+
+			if s.MaxLength == nil {
+				t.Fatal("expected a map of max lengths")
+			}
+			if fmt.Sprint(s.MaxLength) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected the max lengths %v, got %v", tc.expected, s.MaxLength)
+			}
+
+			// the crawler sets its limits of fields without max length
+			s.MaxLength["description"] = 100
+		})
+	}
+}
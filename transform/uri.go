@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultExcludeParams holds the query parameters which are removed by the URI normalization if the transform does not define its own
+var DefaultExcludeParams = []string{"utm_*", "fbclid", "gclid"}
+
+// NormalizeURI represents the normalize-uri element of a transform
+type NormalizeURI struct {
+	ExcludeParams []string `json:"exclude-params"`
+}
+
+var duplicateSlashes = regexp.MustCompile(`/{2,}`)
+
+// Normalize returns the canonical form of the URI without excluded query parameters and its fragment
+func (n *NormalizeURI) Normalize(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		// URIs which cannot be parsed are returned unchanged
+		return uri
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	// duplicate slashes of the path are collapsed
+	u.Path = duplicateSlashes.ReplaceAllString(u.Path, "/")
+	u.RawPath = duplicateSlashes.ReplaceAllString(u.RawPath, "/")
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if n.excluded(name) {
+				query.Del(name)
+			}
+		}
+
+		u.RawQuery = query.Encode()
+	}
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+func (n *NormalizeURI) excluded(name string) bool {
+	params := n.ExcludeParams
+	if params == nil {
+		params = DefaultExcludeParams
+	}
+
+	for _, p := range params {
+		// a trailing * matches every parameter with the prefix
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,911 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html/charset"
+)
+
+// Fields holds the feed item fields which can be defined by the templates of the transform element
+var Fields = []string{"author", "category", "description", "enclosure", "guid", "image", "title", "uri"}
+
+// DefaultIdentifiers holds the identifiers which are stored for every item without a storing node
+var DefaultIdentifiers = []string{"date"}
+
+// ValidationError represents a problem of a transform definition at the given JSON path, e.g. items[0].do[2].regex
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+
+	return e.Path + ": " + e.Message
+}
+
+type validator struct {
+	errors []*ValidationError
+	source string
+	stored map[string]bool
+	strict bool
+}
+
+// Validate checks the whole transform definition after expanding its includes and returns all found problems
+func Validate(spec string) []*ValidationError {
+	return validate(spec, false)
+}
+
+// ValidateStrict checks the transform definition like Validate but also reports the templates of the transform element which are not item fields
+func ValidateStrict(spec string) []*ValidationError {
+	return validate(spec, true)
+}
+
+func validate(spec string, strict bool) []*ValidationError {
+	v := &validator{
+		source: "html",
+		stored: make(map[string]bool),
+		strict: strict,
+	}
+
+	for _, name := range DefaultIdentifiers {
+		v.stored[name] = true
+	}
+
+	spec, err := ExpandIncludes(spec)
+	if err != nil {
+		v.errorf("", "cannot expand includes: %s", err.Error())
+
+		return v.errors
+	}
+
+	var raw map[string]*json.RawMessage
+	err = json.Unmarshal([]byte(spec), &raw)
+	if err != nil {
+		v.errorf("", "cannot parse transform JSON: %s", JSONErrorContext([]byte(spec), err))
+
+		return v.errors
+	}
+
+	v.checkKeys("", raw, "allow-empty", "backfill", "cache-images", "items", "max-age", "max-items", "max-length", "normalize-uri", "notify", "pagination", "request", "source", "store-defaults", "track-presence", "transform")
+
+	if raw["max-age"] != nil {
+		if maxAge, ok := v.string("max-age", raw["max-age"]); ok {
+			if d, err := time.ParseDuration(maxAge); err != nil {
+				v.errorf("max-age", "must be a duration like 720h")
+			} else if d < 0 {
+				v.errorf("max-age", "must not be negative")
+			}
+		}
+	}
+
+	if raw["max-items"] != nil {
+		if i, _, err := jsonInt(raw["max-items"]); err != nil {
+			v.errorf("max-items", "must be an integer")
+		} else if i < 0 {
+			v.errorf("max-items", "must not be negative")
+		}
+	}
+
+	if raw["max-length"] != nil {
+		v.maxLength("max-length", raw["max-length"])
+	}
+
+	if raw["source"] != nil {
+		if source, ok := v.string("source", raw["source"]); ok && source != "" {
+			known := false
+			for _, s := range Sources {
+				if source == s {
+					known = true
+
+					break
+				}
+			}
+
+			if known {
+				v.source = source
+			} else {
+				v.errorf("source", "unknown source %q, allowed are %s", source, strings.Join(Sources, ", "))
+			}
+		}
+	}
+
+	if raw["request"] != nil {
+		v.request("request", raw["request"])
+	}
+
+	if raw["backfill"] != nil {
+		v.backfill("backfill", raw["backfill"])
+	}
+
+	if raw["pagination"] != nil {
+		v.pagination("pagination", raw["pagination"])
+	}
+
+	if raw["notify"] != nil {
+		v.notify("notify", raw["notify"])
+	}
+
+	if raw["store-defaults"] != nil {
+		if defaults, err := jsonHash(raw["store-defaults"]); err != nil {
+			v.errorf("store-defaults", "must be a hash")
+		} else {
+			v.checkKeys("store-defaults", defaults, CleanOptions...)
+			v.cleanOptions("store-defaults", defaults)
+		}
+	}
+
+	if raw["normalize-uri"] != nil {
+		v.normalizeURI("normalize-uri", raw["normalize-uri"])
+	}
+
+	if raw["allow-empty"] != nil {
+		v.bool("allow-empty", raw["allow-empty"])
+	}
+
+	if raw["cache-images"] != nil {
+		v.bool("cache-images", raw["cache-images"])
+	}
+
+	if raw["track-presence"] != nil {
+		v.bool("track-presence", raw["track-presence"])
+	}
+
+	if v.source == "feed" {
+		for _, name := range FeedIdentifiers {
+			v.stored[name] = true
+		}
+	}
+
+	if raw["items"] == nil {
+		if v.source != "feed" {
+			v.errorf("", "needs an items element")
+		}
+	} else {
+		nodes, _ := v.array("items", raw["items"])
+		for i, node := range nodes {
+			v.selectNode(fmt.Sprintf("items[%d]", i), node)
+		}
+	}
+
+	if raw["transform"] == nil {
+		if v.source != "feed" {
+			v.errorf("", "needs a transform element")
+		}
+	} else {
+		// templates can only use stored identifiers so the transform element is checked after all items
+		v.transform("transform", raw["transform"])
+	}
+
+	return v.errors
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkKeys reports all elements of the node which are not allowed
+func (v *validator) checkKeys(path string, node map[string]*json.RawMessage, allowed ...string) {
+	for _, key := range jsonKeys(node) {
+		known := false
+		for _, a := range allowed {
+			if key == a {
+				known = true
+
+				break
+			}
+		}
+
+		if !known {
+			v.errorf(joinPath(path, key), "unknown element, allowed are %s", strings.Join(allowed, ", "))
+		}
+	}
+}
+
+func (v *validator) array(path string, raw *json.RawMessage) ([]map[string]*json.RawMessage, bool) {
+	nodes, err := jsonArray(raw)
+	if err != nil {
+		v.errorf(path, "must be an array of nodes")
+
+		return nil, false
+	}
+
+	return nodes, true
+}
+
+func (v *validator) string(path string, raw *json.RawMessage) (string, bool) {
+	s, err := jsonString(raw)
+	if err != nil {
+		v.errorf(path, "must be a string")
+
+		return "", false
+	}
+
+	return s, true
+}
+
+func (v *validator) bool(path string, raw *json.RawMessage) {
+	_, err := jsonBool(raw)
+	if err != nil {
+		v.errorf(path, "must be a boolean")
+	}
+}
+
+func (v *validator) normalizeURI(path string, raw *json.RawMessage) {
+	normalize, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, normalize, "exclude-params")
+
+	if normalize["exclude-params"] != nil {
+		var params []string
+		if err := json.Unmarshal(*normalize["exclude-params"], &params); err != nil {
+			v.errorf(joinPath(path, "exclude-params"), "must be an array of strings")
+		}
+	}
+}
+
+func (v *validator) maxLength(path string, raw *json.RawMessage) {
+	lengths, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, lengths, MaxLengthFields...)
+
+	for _, field := range jsonKeys(lengths) {
+		if i, _, err := jsonInt(lengths[field]); err != nil {
+			v.errorf(joinPath(path, field), "must be an integer")
+		} else if i < 0 {
+			v.errorf(joinPath(path, field), "must not be negative")
+		}
+	}
+}
+
+func (v *validator) backfill(path string, raw *json.RawMessage) {
+	backfill, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, backfill, "from", "max-pages", "next", "step", "to", "url")
+
+	if _, err := parseBackfill(raw, v.source); err != nil {
+		v.errorf(path, "%s", err.Error())
+	}
+}
+
+func (v *validator) pagination(path string, raw *json.RawMessage) {
+	pagination, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, pagination, "max-pages", "next")
+
+	if _, err := parsePagination(raw, v.source); err != nil {
+		v.errorf(path, "%s", err.Error())
+	}
+}
+
+func (v *validator) notify(path string, raw *json.RawMessage) {
+	notify, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, notify, "template", "url")
+
+	if notify["url"] != nil {
+		if u, ok := v.string(joinPath(path, "url"), notify["url"]); ok && u != "" {
+			if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				v.errorf(joinPath(path, "url"), "must be an absolute URL")
+			}
+		}
+	}
+
+	if notify["template"] != nil {
+		if tem, ok := v.string(joinPath(path, "template"), notify["template"]); ok {
+			if _, err := ParseNotifyTemplate("notify", tem); err != nil {
+				v.errorf(joinPath(path, "template"), "cannot parse template: %s", err.Error())
+			}
+		}
+	}
+}
+
+func isTrue(raw *json.RawMessage) bool {
+	b, _ := jsonBool(raw)
+
+	return b
+}
+
+func (v *validator) request(path string, raw *json.RawMessage) {
+	request, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, request, "charset", "content-types", "cookies", "ignore-robots", "login", "proxy")
+
+	if request["charset"] != nil {
+		label, ok := v.string(joinPath(path, "charset"), request["charset"])
+		if ok && label != "" {
+			if e, _ := charset.Lookup(label); e == nil {
+				v.errorf(joinPath(path, "charset"), "unknown charset %q", label)
+			}
+		}
+	}
+
+	if request["content-types"] != nil {
+		var types []string
+		if err := json.Unmarshal(*request["content-types"], &types); err != nil {
+			v.errorf(joinPath(path, "content-types"), "must be an array of strings")
+		} else {
+			for i, t := range types {
+				if !validMediaTypePattern(t) {
+					v.errorf(fmt.Sprintf("%s.content-types[%d]", path, i), "must be a media type like text/plain or a pattern like image/*")
+				}
+			}
+		}
+	}
+
+	if request["proxy"] != nil {
+		proxy, ok := v.string(joinPath(path, "proxy"), request["proxy"])
+		if ok && proxy != "" {
+			if _, err := ParseProxy(proxy); err != nil {
+				v.errorf(joinPath(path, "proxy"), "cannot parse proxy: %s", err.Error())
+			}
+		}
+	}
+
+	if request["cookies"] != nil {
+		if cookies, err := jsonArray(request["cookies"]); err != nil {
+			v.errorf(joinPath(path, "cookies"), "must be an array of hashes")
+		} else {
+			for i, cookie := range cookies {
+				p := fmt.Sprintf("%s.cookies[%d]", path, i)
+
+				v.checkKeys(p, cookie, "name", "value")
+
+				if cookie["name"] == nil {
+					v.errorf(p, "needs a name element")
+				} else if name, ok := v.string(joinPath(p, "name"), cookie["name"]); ok && name == "" {
+					v.errorf(joinPath(p, "name"), "must not be empty")
+				}
+				if cookie["value"] != nil {
+					v.string(joinPath(p, "value"), cookie["value"])
+				}
+			}
+		}
+	}
+
+	if request["ignore-robots"] != nil {
+		v.bool(joinPath(path, "ignore-robots"), request["ignore-robots"])
+	}
+
+	if request["login"] != nil {
+		v.login(joinPath(path, "login"), request["login"])
+	}
+}
+
+func (v *validator) login(path string, raw *json.RawMessage) {
+	login, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, login, "cookie", "fields", "url")
+
+	if login["url"] == nil {
+		v.errorf(path, "needs an url element")
+	} else if u, ok := v.string(joinPath(path, "url"), login["url"]); ok {
+		if _, err := url.Parse(u); err != nil || u == "" {
+			v.errorf(joinPath(path, "url"), "must be an URL")
+		}
+	}
+
+	if login["fields"] != nil {
+		fields, err := jsonHash(login["fields"])
+		if err != nil {
+			v.errorf(joinPath(path, "fields"), "must be a hash")
+		} else {
+			for _, name := range jsonKeys(fields) {
+				v.string(joinPath(joinPath(path, "fields"), name), fields[name])
+			}
+		}
+	}
+
+	if login["cookie"] != nil {
+		v.string(joinPath(path, "cookie"), login["cookie"])
+	}
+}
+
+// selectNode checks a node of the items element or of the do element of a selecting node which is not a storing parent
+func (v *validator) selectNode(path string, node map[string]*json.RawMessage) {
+	kinds := append([]string{"search", "find", "attr", "meta", "text", "filter"}, TraversalNodes...)
+	storingParents := "an attr, meta or text node"
+	if v.source == "json" || v.source == "feed" {
+		kinds = []string{"path", "field", "filter"}
+		storingParents = "a field node"
+	}
+
+	kind := v.nodeKind(path, node, kinds...)
+
+	switch kind {
+	case "":
+		if node["copy"] != nil || node["regex"] != nil {
+			v.errorf(path, "storing nodes must be in the do element of %s", storingParents)
+		} else {
+			v.errorf(path, "unknown node, needs one of the elements %s", strings.Join(kinds, ", "))
+		}
+
+		return
+	case "filter":
+		v.checkKeys(path, node, "filter")
+		v.filter(joinPath(path, "filter"), node["filter"])
+
+		return
+	case "search":
+		v.checkKeys(path, node, append([]string{"search", "do"}, SliceModifiers...)...)
+	case "find":
+		v.checkKeys(path, node, append([]string{"find", "do", "optional"}, SliceModifiers...)...)
+	default:
+		v.checkKeys(path, node, kind, "do", "optional")
+	}
+
+	for _, name := range []string{"optional", "first", "last"} {
+		if node[name] != nil {
+			v.bool(joinPath(path, name), node[name])
+		}
+	}
+
+	for _, name := range []string{"offset", "limit", "eq"} {
+		if node[name] != nil {
+			if i, _, err := jsonInt(node[name]); err != nil {
+				v.errorf(joinPath(path, name), "must be an integer")
+			} else if name == "limit" && i < 0 {
+				v.errorf(joinPath(path, name), "must not be negative")
+			}
+		}
+	}
+
+	if (node["eq"] != nil && isTrue(node["first"])) || (node["eq"] != nil && isTrue(node["last"])) || (isTrue(node["first"]) && isTrue(node["last"])) {
+		v.errorf(path, "can only use one of eq, first and last")
+	}
+
+	switch kind {
+	case "text":
+		v.bool(joinPath(path, "text"), node["text"])
+	case "parent", "closest", "next", "prev", "siblings":
+		selector := ""
+		if _, err := jsonBool(node[kind]); err != nil {
+			var ok bool
+			if selector, ok = v.string(joinPath(path, kind), node[kind]); !ok {
+				break
+			}
+		}
+
+		if kind == "closest" && selector == "" {
+			v.errorf(joinPath(path, kind), "must be a selector")
+		} else if selector != "" {
+			v.selector(joinPath(path, kind), selector)
+		}
+	case "path", "field":
+		if p, ok := v.string(joinPath(path, kind), node[kind]); ok {
+			_, err := parsePath(p)
+			if err != nil {
+				v.errorf(joinPath(path, kind), "cannot parse path: %s", err.Error())
+			}
+		}
+	default:
+		selector, ok := v.string(joinPath(path, kind), node[kind])
+		if ok && selector == "" {
+			v.errorf(joinPath(path, kind), "must not be empty")
+		} else if ok && (kind == "search" || kind == "find") {
+			v.selector(joinPath(path, kind), selector)
+		}
+	}
+
+	if node["do"] == nil {
+		v.errorf(path, "%s node needs a do element", kind)
+
+		return
+	}
+
+	do, _ := v.array(joinPath(path, "do"), node["do"])
+	for i, d := range do {
+		p := fmt.Sprintf("%s.do[%d]", path, i)
+
+		if kind == "attr" || kind == "meta" || kind == "text" || kind == "field" {
+			v.storeNode(p, d, storingParents)
+		} else {
+			v.selectNode(p, d)
+		}
+	}
+}
+
+// storeNode checks a node of the do element of a storing parent, i.e. an attr, meta or text node or for JSON a field node
+func (v *validator) storeNode(path string, node map[string]*json.RawMessage, storingParents string) {
+	kind := v.nodeKind(path, node, "copy", "regex")
+
+	if node["default"] != nil {
+		v.string(joinPath(path, "default"), node["default"])
+	}
+
+	v.cleanOptions(path, node)
+
+	switch kind {
+	case "":
+		v.errorf(path, "the do element of %s can only contain storing nodes, needs one of the elements copy or regex", storingParents)
+	case "copy":
+		v.checkKeys(path, node, append([]string{"copy", "name", "type", "default"}, CleanOptions...)...)
+		v.bool(joinPath(path, "copy"), node["copy"])
+		v.storedValue(path, node, "copy")
+	case "regex":
+		v.checkKeys(path, node, append([]string{"regex", "regex-all", "matches", "default"}, CleanOptions...)...)
+
+		if node["regex-all"] != nil {
+			v.bool(joinPath(path, "regex-all"), node["regex-all"])
+		}
+
+		nodeMatches := -1
+		if node["matches"] != nil {
+			nodeMatches = v.matches(joinPath(path, "matches"), node["matches"])
+		}
+
+		// the regex element is one regex or an array of alternatives which are regexes or hashes with their own matches
+		var alternatives []*json.RawMessage
+		if json.Unmarshal(*node["regex"], &alternatives) != nil {
+			groups := v.regex(joinPath(path, "regex"), node["regex"])
+
+			if node["matches"] == nil {
+				v.errorf(path, "regex node needs a matches element")
+			} else if groups >= 0 && nodeMatches >= 0 && groups != nodeMatches {
+				v.errorf(joinPath(path, "matches"), "has %d matches but the regex has %d capturing groups", nodeMatches, groups)
+			}
+
+			return
+		} else if len(alternatives) == 0 {
+			v.errorf(joinPath(path, "regex"), "needs at least one regex")
+		}
+
+		needsMatches := false
+		for i, raw := range alternatives {
+			p := fmt.Sprintf("%s.regex[%d]", path, i)
+
+			alternative, err := jsonHash(raw)
+			if err != nil {
+				groups := v.regex(p, raw)
+
+				needsMatches = true
+				if groups >= 0 && nodeMatches >= 0 && groups != nodeMatches {
+					v.errorf(p, "has %d capturing groups but the matches element of the node has %d matches", groups, nodeMatches)
+				}
+
+				continue
+			}
+
+			v.checkKeys(p, alternative, "regex", "matches")
+
+			groups := -1
+			if alternative["regex"] == nil {
+				v.errorf(p, "alternative needs a regex element")
+			} else {
+				groups = v.regex(joinPath(p, "regex"), alternative["regex"])
+			}
+
+			if alternative["matches"] == nil {
+				needsMatches = true
+				if groups >= 0 && nodeMatches >= 0 && groups != nodeMatches {
+					v.errorf(p, "has %d capturing groups but the matches element of the node has %d matches", groups, nodeMatches)
+				}
+			} else if count := v.matches(joinPath(p, "matches"), alternative["matches"]); groups >= 0 && count >= 0 && groups != count {
+				v.errorf(joinPath(p, "matches"), "has %d matches but the regex has %d capturing groups", count, groups)
+			}
+		}
+
+		if needsMatches && node["matches"] == nil {
+			v.errorf(path, "regex node needs a matches element for the alternatives without their own matches")
+		}
+	}
+}
+
+// cleanOptions checks the options of a storing node or of the store-defaults element which clean the values before they are stored
+func (v *validator) cleanOptions(path string, node map[string]*json.RawMessage) {
+	for _, key := range []string{"collapse-whitespace", "trim"} {
+		if node[key] != nil {
+			v.bool(joinPath(path, key), node[key])
+		}
+	}
+	for _, key := range []string{"strip-prefix", "strip-suffix"} {
+		if node[key] != nil {
+			v.string(joinPath(path, key), node[key])
+		}
+	}
+
+	if node["case"] != nil {
+		if c, ok := v.string(joinPath(path, "case"), node["case"]); ok {
+			known := false
+			for _, k := range CleanCases {
+				if c == k {
+					known = true
+
+					break
+				}
+			}
+			if !known {
+				v.errorf(joinPath(path, "case"), "unknown case %q, allowed are %s", c, strings.Join(CleanCases, ", "))
+			}
+		}
+	}
+}
+
+// selector checks a CSS selector
+func (v *validator) selector(path string, selector string) {
+	_, err := cascadia.Compile(selector)
+	if err != nil {
+		v.errorf(path, "cannot parse selector: %s", err.Error())
+	}
+}
+
+// regex checks a regex and returns the count of its capturing groups or -1 if it is invalid
+func (v *validator) regex(path string, raw *json.RawMessage) int {
+	reg, ok := v.string(path, raw)
+	if !ok {
+		return -1
+	}
+
+	re, err := regexp.Compile(reg)
+	if err != nil {
+		v.errorf(path, "cannot compile regex: %s", err.Error())
+
+		return -1
+	}
+
+	return re.NumSubexp()
+}
+
+// matches checks the matches of a regex and returns their count or -1 if they are invalid
+func (v *validator) matches(path string, raw *json.RawMessage) int {
+	matches, ok := v.array(path, raw)
+	if !ok {
+		return -1
+	}
+
+	for i, match := range matches {
+		p := fmt.Sprintf("%s[%d]", path, i)
+
+		v.checkKeys(p, match, "name", "type")
+		v.storedValue(p, match, "match")
+	}
+
+	return len(matches)
+}
+
+// storedValue checks the name and the type of a stored value and marks its name as stored
+func (v *validator) storedValue(path string, node map[string]*json.RawMessage, kind string) {
+	if node["name"] == nil {
+		v.errorf(path, "%s needs a name element", kind)
+	} else if name, ok := v.string(joinPath(path, "name"), node["name"]); ok {
+		if name == "" {
+			v.errorf(joinPath(path, "name"), "must not be empty")
+		}
+
+		v.stored[name] = true
+	}
+
+	if node["type"] == nil {
+		v.errorf(path, "%s needs a type element", kind)
+	} else if typ, ok := v.string(joinPath(path, "type"), node["type"]); ok && typ != "int" && typ != "relative-date" && typ != "string" {
+		v.errorf(joinPath(path, "type"), "unknown type %q, must be int, relative-date or string", typ)
+	}
+}
+
+func (v *validator) filter(path string, raw *json.RawMessage) {
+	filter, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash")
+
+		return
+	}
+
+	v.checkKeys(path, filter, "field", "regex", "action")
+
+	if filter["field"] == nil {
+		v.errorf(path, "filter needs a field element")
+	} else {
+		v.string(joinPath(path, "field"), filter["field"])
+	}
+
+	if filter["regex"] != nil {
+		if reg, ok := v.string(joinPath(path, "regex"), filter["regex"]); ok {
+			_, err = regexp.Compile(reg)
+			if err != nil {
+				v.errorf(joinPath(path, "regex"), "cannot compile regex: %s", err.Error())
+			}
+		}
+	}
+
+	if filter["action"] != nil {
+		if action, ok := v.string(joinPath(path, "action"), filter["action"]); ok && action != "" && action != "drop" && action != "keep" {
+			v.errorf(joinPath(path, "action"), "unknown action %q, must be drop or keep", action)
+		}
+	}
+}
+
+// transform checks the templates of the transform element
+func (v *validator) transform(path string, raw *json.RawMessage) {
+	templates, err := jsonHash(raw)
+	if err != nil {
+		v.errorf(path, "must be a hash of templates")
+
+		return
+	}
+
+	// extra fields are available to the templates of item fields
+	hasExtraFields := false
+	for name := range templates {
+		if !isItemField(name) {
+			hasExtraFields = true
+		}
+	}
+
+	for _, name := range jsonKeys(templates) {
+		p := joinPath(path, name)
+
+		// such templates would be stored as extra fields, e.g. misspelled fields
+		if !isItemField(name) && v.strict {
+			v.errorf(p, "unknown field, allowed are %s", strings.Join(Fields, ", "))
+		}
+
+		tem, ok := v.string(p, templates[name])
+		if !ok {
+			continue
+		}
+
+		t, err := template.New(name).Funcs(templateFuncMap()).Parse(tem)
+		if err != nil {
+			v.errorf(p, "cannot parse template: %s", err.Error())
+
+			continue
+		}
+
+		for _, identifier := range templateIdentifiers(t.Tree.Root) {
+			if identifier == "fields" && hasExtraFields && isItemField(name) {
+				continue
+			}
+
+			if !v.stored[identifier] {
+				v.errorf(p, "uses .%s which is never stored", identifier)
+			}
+		}
+	}
+}
+
+// nodeKind returns which of the given elements the node holds
+func (v *validator) nodeKind(path string, node map[string]*json.RawMessage, kinds ...string) string {
+	var found []string
+
+	for _, kind := range kinds {
+		if node[kind] != nil {
+			found = append(found, kind)
+		}
+	}
+
+	// a node with more than one of them is reported
+	if len(found) > 1 {
+		v.errorf(path, "node can only be one of %s", strings.Join(found, ", "))
+	}
+
+	if len(found) == 0 {
+		return ""
+	}
+
+	return found[0]
+}
+
+// templateIdentifiers returns the identifiers of the item values which are used by the template
+func templateIdentifiers(node parse.Node) []string {
+	var identifiers []string
+
+	seen := make(map[string]bool)
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if !seen[n.Ident[0]] {
+				seen[n.Ident[0]] = true
+
+				identifiers = append(identifiers, n.Ident[0])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		// fields inside range and with actions are ignored as they do not belong to the item values
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+
+	walk(node)
+
+	return identifiers
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func jsonKeys(node map[string]*json.RawMessage) []string {
+	keys := make([]string, 0, len(node))
+	for key := range node {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}